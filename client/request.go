@@ -42,6 +42,7 @@ type Request struct {
 	body               interface{}
 	bodyStream         io.Reader
 	responseBody       interface{}
+	responseStream     io.Writer
 	responseHeaderPtr  **http.Header
 	handler            ResponseBodyHandler
 	parameters         url.Values
@@ -206,6 +207,14 @@ func (r *Request) ResponseBody(content interface{}) *Request {
 	return r
 }
 
+// ResponseStream sets a writer that the body of a successful response is
+// copied to as it is received, whatever its content type. Bodies of error
+// responses are still read as JSON. It returns the *Request so it can be chained.
+func (r *Request) ResponseStream(w io.Writer) *Request {
+	r.responseStream = w
+	return r
+}
+
 // ResponseHeader sets a pointer that will be directed to the response header.
 // It returns the *Request so it can be chained.
 func (r *Request) ResponseHeader(headerPtr **http.Header) *Request {
@@ -296,6 +305,13 @@ func (r *Request) Execute() (*Response, error) {
 		*r.responseHeaderPtr = &httpRsp.Header
 	}
 	rsp := NewResponse(httpRsp)
+	if r.responseStream != nil &&
+		(r.expectedStatusCode == nil || *r.expectedStatusCode == httpRsp.StatusCode) {
+		defer httpRsp.Body.Close()
+		_, err = io.Copy(r.responseStream, httpRsp.Body)
+		return rsp, err
+	}
+
 	contentType := contentTypeJson
 	if len(httpRsp.Header["Content-Type"]) > 0 {
 		contentType = httpRsp.Header["Content-Type"][0]
@@ -0,0 +1,266 @@
+package command
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	bundleTypeJar   = "JAR"
+	bundleTypeZip   = "ZIP"
+	bundleTypeTarGz = "TAR_GZ"
+
+	// jarManifest and bundleManifest must be at the root of bundles that are
+	// packaged from a directory.
+	jarManifest    = "META-INF/MANIFEST.MF"
+	bundleManifest = "manifest.yaml"
+)
+
+var bundleTypes = []string{bundleTypeJar, bundleTypeZip, bundleTypeTarGz}
+
+// bundleEpoch is used as the modification time of all packaged files, so the
+// archive (and its checksum) only depends on file names and contents.
+var bundleEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// detectBundleType returns the bundle type of a file based on its extension.
+// Files with other extensions are assumed to be JARs.
+func detectBundleType(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return bundleTypeZip
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return bundleTypeTarGz
+	}
+	return bundleTypeJar
+}
+
+// bundleExtension returns the file extension used for archives of type t.
+func bundleExtension(t string) string {
+	switch t {
+	case bundleTypeJar:
+		return ".jar"
+	case bundleTypeZip:
+		return ".zip"
+	default:
+		return ".tar.gz"
+	}
+}
+
+func manifestFor(t string) string {
+	if t == bundleTypeJar {
+		return jarManifest
+	}
+	return bundleManifest
+}
+
+// bundleFiles returns the paths of all regular files in dir, relative to dir,
+// using '/' as separator and sorted.
+func bundleFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("Cannot package '%s': only regular files and directories are supported.", path)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// bundleFileMode returns the mode stored for a packaged file, keeping only
+// whether it is executable.
+func bundleFileMode(info os.FileInfo) os.FileMode {
+	if info.Mode()&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// packageBundle packages dir into a reproducible archive of type t written
+// to w. The directory must contain the manifest for the bundle type.
+func packageBundle(dir, t string, w io.Writer) error {
+	files, err := bundleFiles(dir)
+	if err != nil {
+		return err
+	}
+	if !isInList(manifestFor(t), files) {
+		return fmt.Errorf("Directory '%s' has no %s, which is required for %s bundles.", dir, manifestFor(t), t)
+	}
+
+	if t == bundleTypeTarGz {
+		return writeTarGz(dir, files, w)
+	}
+	if t == bundleTypeJar {
+		files = jarOrder(files)
+	}
+	return writeZip(dir, files, w)
+}
+
+// jarOrder returns the sorted files of a JAR with the META-INF/ directory
+// and the manifest moved to the front, where JarInputStream expects them.
+func jarOrder(files []string) []string {
+	ordered := []string{path.Dir(jarManifest) + "/", jarManifest}
+	for _, name := range files {
+		if name != jarManifest {
+			ordered = append(ordered, name)
+		}
+	}
+	return ordered
+}
+
+func writeZip(dir string, files []string, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for _, name := range files {
+		if strings.HasSuffix(name, "/") {
+			header := &zip.FileHeader{Name: name, Method: zip.Store, Modified: bundleEpoch}
+			header.SetMode(os.ModeDir | 0755)
+			if _, err := zw.CreateHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: bundleEpoch}
+		header.SetMode(bundleFileMode(info))
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := copyFile(fw, path); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(dir string, files []string, w io.Writer) error {
+	gw, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(gw)
+	for _, name := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:     name,
+			Mode:     int64(bundleFileMode(info)),
+			Size:     info.Size(),
+			ModTime:  bundleEpoch,
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := copyFile(tw, path); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// bundleArgs are the arguments for the bundle of an app.
+type bundleArgs struct {
+	bundleType string
+}
+
+func (a *bundleArgs) IsValid() bool {
+	return len(a.bundleType) == 0 || isInList(a.bundleType, bundleTypes)
+}
+
+func (a *bundleArgs) setBundleFlags(flags *flag.FlagSet) {
+	flags.StringVar(&a.bundleType, "type", "",
+		"Bundle type: "+strings.Join(bundleTypes, ", ")+" (detected from the file extension by default; "+
+			"other files and directories default to "+bundleTypeJar+").")
+}
+
+// prepareBundle determines the bundle type of the file or directory at
+// args.path. Directories are packaged into a temporary archive, and
+// args.path is changed to point to it; the returned function removes it.
+func (a *bundleArgs) prepareBundle(args *uploadFileArgs) (func(), error) {
+	noop := func() {}
+	info, err := os.Stat(args.path)
+	if err != nil {
+		return noop, err
+	}
+
+	if !info.IsDir() {
+		if len(a.bundleType) == 0 {
+			a.bundleType = detectBundleType(args.path)
+		}
+		return noop, nil
+	}
+
+	if len(a.bundleType) == 0 {
+		a.bundleType = bundleTypeJar
+	}
+	tmpDir, err := ioutil.TempDir("", "iobeam-bundle")
+	if err != nil {
+		return noop, err
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
+
+	dir := filepath.Clean(args.path)
+	out := filepath.Join(tmpDir, filepath.Base(dir)+bundleExtension(a.bundleType))
+	f, err := os.Create(out)
+	if err != nil {
+		cleanup()
+		return noop, err
+	}
+	err = packageBundle(dir, a.bundleType, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return noop, err
+	}
+
+	fmt.Printf("Packaged '%s' as %s bundle.\n", dir, a.bundleType)
+	args.path = out
+	return cleanup, nil
+}
@@ -0,0 +1,181 @@
+package command
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectBundleType(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{in: "app.jar", want: bundleTypeJar},
+		{in: "app.ZIP", want: bundleTypeZip},
+		{in: "dist/app.tar.gz", want: bundleTypeTarGz},
+		{in: "app.tgz", want: bundleTypeTarGz},
+		{in: "app.out", want: bundleTypeJar},
+	}
+	for _, c := range cases {
+		if got := detectBundleType(c.in); got != c.want {
+			t.Errorf("detectBundleType(%s) = %s, want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestBundleArgsIsValid(t *testing.T) {
+	cases := []dataTestCase{
+		{desc: "valid, detected type", in: &bundleArgs{}, want: true},
+		{desc: "valid, explicit type", in: &bundleArgs{bundleType: bundleTypeTarGz}, want: true},
+		{desc: "invalid type", in: &bundleArgs{bundleType: "EGG"}, want: false},
+	}
+	runDataTestCase(t, cases)
+}
+
+func writeTestBundleDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "iobeam-bundle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPackageBundleReproducible(t *testing.T) {
+	files := map[string]string{
+		bundleManifest: "main: src/main.py\n",
+		"src/main.py":  "print('hi')\n",
+		"src/util.py":  "x = 1\n",
+	}
+
+	for _, bundleType := range []string{bundleTypeZip, bundleTypeTarGz} {
+		dir := writeTestBundleDir(t, files)
+		defer os.RemoveAll(dir)
+
+		var first bytes.Buffer
+		if err := packageBundle(dir, bundleType, &first); err != nil {
+			t.Fatalf("%s: unexpected error: %v", bundleType, err)
+		}
+
+		// Changing modification times must not change the archive.
+		later := time.Now().Add(time.Hour)
+		os.Chtimes(filepath.Join(dir, "src", "main.py"), later, later)
+		var second bytes.Buffer
+		if err := packageBundle(dir, bundleType, &second); err != nil {
+			t.Fatalf("%s: unexpected error: %v", bundleType, err)
+		}
+		if !bytes.Equal(first.Bytes(), second.Bytes()) {
+			t.Errorf("%s: archives differ", bundleType)
+		}
+
+		names := archiveNames(t, bundleType, first.Bytes())
+		want := "manifest.yaml,src/main.py,src/util.py"
+		if got := strings.Join(names, ","); got != want {
+			t.Errorf("%s: got files %s, want %s", bundleType, got, want)
+		}
+	}
+}
+
+func TestPackageJarManifestFirst(t *testing.T) {
+	dir := writeTestBundleDir(t, map[string]string{
+		jarManifest:         "Main-Class: App\n",
+		"App.class":         "x",
+		"util/Helper.class": "y",
+	})
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	if err := packageBundle(dir, bundleTypeJar, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := archiveNames(t, bundleTypeZip, buf.Bytes())
+	want := "META-INF/,META-INF/MANIFEST.MF,App.class,util/Helper.class"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("got files %s, want %s", got, want)
+	}
+}
+
+func archiveNames(t *testing.T, bundleType string, data []byte) []string {
+	var names []string
+	if bundleType == bundleTypeZip {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, h.Name)
+	}
+	return names
+}
+
+func TestPackageBundleRequiresManifest(t *testing.T) {
+	dir := writeTestBundleDir(t, map[string]string{"Main.class": "x"})
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	if err := packageBundle(dir, bundleTypeJar, &buf); err == nil {
+		t.Errorf("expected error for JAR directory without %s", jarManifest)
+	}
+	if err := packageBundle(dir, bundleTypeZip, &buf); err == nil {
+		t.Errorf("expected error for ZIP directory without %s", bundleManifest)
+	}
+}
+
+func TestPrepareBundleDirectory(t *testing.T) {
+	dir := writeTestBundleDir(t, map[string]string{jarManifest: "Main-Class: App\n", "App.class": "x"})
+	defer os.RemoveAll(dir)
+
+	bundle := &bundleArgs{}
+	upload := &uploadFileArgs{projectId: 1, path: dir}
+	cleanup, err := bundle.prepareBundle(upload)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bundle.bundleType != bundleTypeJar {
+		t.Errorf("expected %s, got %s", bundleTypeJar, bundle.bundleType)
+	}
+	if filepath.Base(upload.path) != filepath.Base(dir)+".jar" {
+		t.Errorf("unexpected archive path: %s", upload.path)
+	}
+	if _, err := os.Stat(upload.path); err != nil {
+		t.Errorf("archive missing: %v", err)
+	}
+	cleanup()
+	if _, err := os.Stat(upload.path); !os.IsNotExist(err) {
+		t.Errorf("archive not removed by cleanup")
+	}
+}
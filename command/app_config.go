@@ -0,0 +1,163 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// appConfigFile is the format of files given with -config-file, e.g.:
+//
+//	config:
+//	  threshold: 25.0
+//	secrets:
+//	  api_key: abc123
+type appConfigFile struct {
+	Config  map[string]interface{} `yaml:"config"`
+	Secrets map[string]interface{} `yaml:"secrets"`
+}
+
+// appConfigArgs are the arguments for setting the runtime configuration of
+// an app.
+type appConfigArgs struct {
+	config     keyValueFlags
+	secrets    keyValueFlags
+	unset      []string
+	configFile string
+}
+
+func (a *appConfigArgs) setConfigFlags(flags *flag.FlagSet, update bool) {
+	a.config = make(keyValueFlags)
+	a.secrets = make(keyValueFlags)
+	flags.Var(a.config, "config", "Config value passed to the app, as key=value (can be repeated).")
+	flags.Var(a.secrets, "secret", "Secret config value passed to the app, as key=value (can be repeated). Shown redacted.")
+	flags.StringVar(&a.configFile, "config-file", "",
+		"YAML file with 'config' and 'secrets' sections of key/value pairs. -config and -secret values override it.")
+	if update {
+		flags.Var(newListFlags(&a.unset), "unset", "Config or secret key to remove (can be repeated).")
+	}
+}
+
+// isSet reports whether any config changes were requested.
+func (a *appConfigArgs) isSet() bool {
+	return len(a.config) > 0 || len(a.secrets) > 0 || len(a.unset) > 0 || len(a.configFile) > 0
+}
+
+// apply merges the requested config changes into app. Values from the config
+// file are applied first, then -config and -secret values, then -unset.
+// Without config changes the config and secrets are left out of app, so an
+// update does not send back values the server may have redacted.
+func (a *appConfigArgs) apply(app *appData) error {
+	if !a.isSet() {
+		app.Config = nil
+		app.Secrets = nil
+		return nil
+	}
+	if app.Config == nil {
+		app.Config = make(map[string]string)
+	}
+	if app.Secrets == nil {
+		app.Secrets = make(map[string]string)
+	}
+
+	if len(a.configFile) > 0 {
+		data, err := ioutil.ReadFile(a.configFile)
+		if err != nil {
+			return fmt.Errorf("Could not read config file: %v", err)
+		}
+		file, err := parseAppConfigFile(data)
+		if err != nil {
+			return fmt.Errorf("Invalid config file '%s': %v", a.configFile, err)
+		}
+		mergeConfig(app.Config, file.config)
+		mergeConfig(app.Secrets, file.secrets)
+	}
+	mergeConfig(app.Config, a.config)
+	mergeConfig(app.Secrets, a.secrets)
+
+	for _, k := range a.unset {
+		delete(app.Config, k)
+		delete(app.Secrets, k)
+	}
+
+	for k := range app.Secrets {
+		if _, ok := app.Config[k]; ok {
+			return fmt.Errorf("Key '%s' is set both as config and as secret.", k)
+		}
+	}
+	return nil
+}
+
+// mergeConfig copies all values of src into dst.
+func mergeConfig(dst, src map[string]string) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+type parsedAppConfig struct {
+	config  map[string]string
+	secrets map[string]string
+}
+
+// parseAppConfigFile parses a YAML config file. Values must be scalars; they
+// are passed to the app as strings.
+func parseAppConfigFile(data []byte) (*parsedAppConfig, error) {
+	file := new(appConfigFile)
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return nil, err
+	}
+
+	config, err := configStrings("config", file.Config)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := configStrings("secrets", file.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	return &parsedAppConfig{config: config, secrets: secrets}, nil
+}
+
+func configStrings(section string, values map[string]interface{}) (map[string]string, error) {
+	res := make(map[string]string)
+	for k, v := range values {
+		switch v.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			return nil, fmt.Errorf("value of '%s' in '%s' must be a string, number or boolean", k, section)
+		case nil:
+			res[k] = ""
+		default:
+			res[k] = fmt.Sprint(v)
+		}
+	}
+	return res, nil
+}
+
+// printAppConfig prints the config of an app, with secret values redacted.
+func printAppConfig(config, secrets map[string]string) {
+	if len(config) == 0 && len(secrets) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("CONFIG")
+	for _, k := range sortedKeys(config) {
+		fmt.Printf("%s = %s\n", k, config[k])
+	}
+	for _, k := range sortedKeys(secrets) {
+		fmt.Printf("%s = %s (secret)\n", k, maskSecret(secrets[k]))
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
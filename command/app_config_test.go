@@ -0,0 +1,197 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iobeam/iobeam/config"
+)
+
+func TestKeyValueFlags(t *testing.T) {
+	m := make(keyValueFlags)
+	for _, v := range []string{"a=1", "b = x=y", "a=2", "empty="} {
+		if err := m.Set(v); err != nil {
+			t.Errorf("Set(%s) failed: %v", v, err)
+		}
+	}
+	if m["a"] != "2" || m["b"] != " x=y" || m["empty"] != "" {
+		t.Errorf("unexpected values: %v", m)
+	}
+	if got := m.String(); got != "a=2,b= x=y,empty=" {
+		t.Errorf("unexpected String(): %s", got)
+	}
+
+	for _, v := range []string{"novalue", "=1", " =1"} {
+		if err := m.Set(v); err == nil {
+			t.Errorf("Set(%s) should fail", v)
+		}
+	}
+}
+
+func TestParseAppConfigFile(t *testing.T) {
+	data := []byte("config:\n  threshold: 25.5\n  enabled: true\n  name: staging\nsecrets:\n  api_key: abc\n")
+	parsed, err := parseAppConfigFile(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.config["threshold"] != "25.5" || parsed.config["enabled"] != "true" || parsed.config["name"] != "staging" {
+		t.Errorf("unexpected config: %v", parsed.config)
+	}
+	if parsed.secrets["api_key"] != "abc" {
+		t.Errorf("unexpected secrets: %v", parsed.secrets)
+	}
+
+	bad := []string{
+		"config:\n  nested:\n    a: 1\n",
+		"config:\n  list: [1, 2]\n",
+		"settings:\n  a: 1\n",
+	}
+	for _, b := range bad {
+		if _, err := parseAppConfigFile([]byte(b)); err == nil {
+			t.Errorf("expected error for %q", b)
+		}
+	}
+}
+
+func TestAppConfigArgsApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iobeam-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.yaml")
+	content := "config:\n  threshold: 20\n  mode: fast\nsecrets:\n  token: file-token\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	args := &appConfigArgs{
+		config:     keyValueFlags{"threshold": "30"},
+		secrets:    keyValueFlags{},
+		unset:      []string{"old"},
+		configFile: path,
+	}
+	app := &appData{Config: map[string]string{"old": "1", "keep": "yes"}}
+	if err := args.apply(app); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{"threshold": "30", "mode": "fast", "keep": "yes"}
+	if len(app.Config) != len(want) {
+		t.Errorf("unexpected config: %v", app.Config)
+	}
+	for k, v := range want {
+		if app.Config[k] != v {
+			t.Errorf("config %s: got '%s', want '%s'", k, app.Config[k], v)
+		}
+	}
+	if app.Secrets["token"] != "file-token" {
+		t.Errorf("unexpected secrets: %v", app.Secrets)
+	}
+
+	conflict := &appConfigArgs{config: keyValueFlags{"token": "x"}, secrets: keyValueFlags{}}
+	if err := conflict.apply(app); err == nil {
+		t.Errorf("expected error for key set as both config and secret")
+	}
+}
+
+func TestAppDataJSONSendsClearedConfig(t *testing.T) {
+	app := &appData{AppName: "a", Config: map[string]string{"old": "1"}}
+	args := &appConfigArgs{config: keyValueFlags{}, secrets: keyValueFlags{}, unset: []string{"old"}}
+	if err := args.apply(app); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"config":{}`) || !strings.Contains(string(b), `"secrets":{}`) {
+		t.Errorf("expected empty config and secrets in %s", b)
+	}
+
+	b, _ = json.Marshal(&appData{AppName: "a"})
+	if strings.Contains(string(b), "config") || strings.Contains(string(b), "secrets") {
+		t.Errorf("expected unset config and secrets to be left out of %s", b)
+	}
+}
+
+func TestRenameAppLeavesOutSecrets(t *testing.T) {
+	var put map[string]interface{}
+	ctx := newTestContext(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "PUT" {
+			json.NewDecoder(r.Body).Decode(&put)
+		}
+		fmt.Fprint(w, `{"app_id": 1, "project_id": 1, "app_name": "old", `+
+			`"config": {"mode": "fast"}, "secrets": {"token": "********"}}`)
+	}))
+
+	args := &updateAppArgs{id: 1}
+	args.projectId = 1
+	args.name = "new"
+	args.config = keyValueFlags{}
+	args.secrets = keyValueFlags{}
+	if err := updateApp(&Command{Data: args}, ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if put["app_name"] != "new" {
+		t.Errorf("app was not renamed: %v", put)
+	}
+	if _, ok := put["secrets"]; ok {
+		t.Errorf("rename sent secrets: %v", put)
+	}
+	if _, ok := put["config"]; ok {
+		t.Errorf("rename sent config: %v", put)
+	}
+}
+
+func TestUpdateAppFlags(t *testing.T) {
+	ctx := &Context{Profile: &config.Profile{ActiveProject: 1}}
+	cmd := newUpdateAppCmd(ctx)
+	if err := cmd.flags.Parse([]string{"-name", "old", "-newName", "new"}); err != nil {
+		t.Fatal(err)
+	}
+	args := cmd.Data.(*updateAppArgs)
+	if args.appName != "old" || args.name != "new" {
+		t.Errorf("-name should select the app and -newName rename it, got %q and %q", args.appName, args.name)
+	}
+}
+
+func TestUpdateAppArgsIsValid(t *testing.T) {
+	configOnly := &updateAppArgs{id: 1}
+	configOnly.config = keyValueFlags{"a": "1"}
+	cases := []dataTestCase{
+		{
+			desc: "valid, only config changed",
+			in:   configOnly,
+			want: true,
+		},
+		{
+			desc: "valid, name changed",
+			in:   &updateAppArgs{id: 1, launchAppArgs: launchAppArgs{name: "new"}},
+			want: true,
+		},
+		{
+			desc: "valid, selected by name",
+			in:   &updateAppArgs{appName: "app", launchAppArgs: launchAppArgs{name: "new"}},
+			want: true,
+		},
+		{
+			desc: "invalid, no app selected",
+			in:   &updateAppArgs{launchAppArgs: launchAppArgs{name: "new"}},
+			want: false,
+		},
+		{
+			desc: "invalid, nothing changed",
+			in:   &updateAppArgs{id: 1},
+			want: false,
+		},
+	}
+	runDataTestCase(t, cases)
+}
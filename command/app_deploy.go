@@ -0,0 +1,185 @@
+package command
+
+import (
+	"fmt"
+	"time"
+)
+
+type appRestartArgs struct {
+	baseAppArgs
+	waitArgs
+}
+
+func (a *appRestartArgs) IsValid() bool {
+	return a.baseAppArgs.IsValid() && a.waitArgs.IsValid()
+}
+
+func newAppRestartCmd(ctx *Context) *Command {
+	args := new(appRestartArgs)
+
+	cmd := &Command{
+		Name: "restart",
+		// ApiPath determined by flags
+		Usage:  "Stop an app and start it again.",
+		Data:   args,
+		Action: restartApp,
+	}
+	flags := cmd.newFlagSetApp()
+	flags.Uint64Var(&args.id, "id", 0, "App ID (this or -name is required)")
+	flags.StringVar(&args.name, "name", "", "App name (this or -id is required)")
+	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject,
+		"Project ID of app (defaults to active project)")
+	args.setWaitFlags(flags, true)
+
+	return cmd
+}
+
+func restartApp(c *Command, ctx *Context) error {
+	args := c.Data.(*appRestartArgs)
+	app, err := _getApp(ctx, &args.baseAppArgs)
+	if err != nil {
+		return err
+	}
+
+	if err := _stopApp(ctx, app, args.timeout); err != nil {
+		return err
+	}
+	return _startApp(ctx, app, &args.waitArgs)
+}
+
+// _stopApp stops app if it is not stopped already, and waits until it is.
+// Stopping always waits, since the app must be stopped before it can be
+// started or changed.
+func _stopApp(ctx *Context, app *appData, timeout time.Duration) error {
+	app.RequestedStatus = appStatusStopped
+	modified, err := _putApp(ctx, app)
+	if err != nil || !modified {
+		return err
+	}
+	return waitForAppStatus(ctx, &baseAppArgs{projectId: app.ProjectId, id: app.AppId}, appStatusStopped, timeout)
+}
+
+// _startApp requests app to run, and waits until it does if args says so.
+func _startApp(ctx *Context, app *appData, args *waitArgs) error {
+	app.RequestedStatus = appStatusRunning
+	if _, err := _putApp(ctx, app); err != nil {
+		return err
+	}
+	fmt.Printf("Requested status: %s.\n", appStatusRunning)
+	if !args.shouldWait() {
+		return nil
+	}
+	return waitForAppStatus(ctx, &baseAppArgs{projectId: app.ProjectId, id: app.AppId}, appStatusRunning, args.timeout)
+}
+
+type appDeployArgs struct {
+	uploadFileArgs
+	bundleArgs
+	baseApp    baseAppArgs
+	timeout    time.Duration
+	noRollback bool
+}
+
+func (a *appDeployArgs) IsValid() bool {
+	appOk := a.baseApp.id > 0 || len(a.baseApp.name) > 0
+	return a.uploadFileArgs.IsValid() && a.bundleArgs.IsValid() && appOk && a.timeout >= 0
+}
+
+func newAppDeployCmd(ctx *Context) *Command {
+	args := new(appDeployArgs)
+
+	cmd := &Command{
+		Name: "deploy",
+		// ApiPath determined by flags
+		Usage: "Deploy a new bundle: upload it, stop the app, switch bundles and start the app again. " +
+			"If the new version fails, the previous bundle is restored.",
+		Data:   args,
+		Action: deployApp,
+	}
+	flags := cmd.newFlagSetApp()
+	flags.Uint64Var(&args.baseApp.id, "id", 0, "App ID (this or -name is required)")
+	flags.StringVar(&args.baseApp.name, "name", "", "App name (this or -id is required)")
+	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject,
+		"Project ID of app (defaults to active project)")
+	flags.StringVar(&args.path, "path", "", "Path to app file or directory to deploy. (REQUIRED)")
+	args.setBundleFlags(flags)
+	args.setChunkSizeFlag(flags)
+	flags.DurationVar(&args.timeout, "timeout", defaultWaitTimeout,
+		"How long to wait for each status change of the app (ex. 90s, 5m; 0 = no limit).")
+	flags.BoolVar(&args.noRollback, "no-rollback", false, "Do not restore the previous bundle if the new one fails.")
+
+	return cmd
+}
+
+func deployApp(c *Command, ctx *Context) error {
+	args := c.Data.(*appDeployArgs)
+	args.baseApp.projectId = args.projectId
+	app, err := _getApp(ctx, &args.baseApp)
+	if err != nil {
+		return err
+	}
+	previous := app.Bundle
+
+	cleanup, err := args.prepareBundle(&args.uploadFileArgs)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	args.versioned = true
+	digest, err := _uploadFile(ctx, &args.uploadFileArgs)
+	if err != nil {
+		return err
+	}
+	version := newBundleVersion(ctx, &args.uploadFileArgs, args.bundleType, digest)
+
+	if err := _stopApp(ctx, app, args.timeout); err != nil {
+		return err
+	}
+
+	app.Bundle = version.bundle()
+	if _, err := _putApp(ctx, app); err != nil {
+		return err
+	}
+	recordBundle(ctx, app.AppId, version)
+	fmt.Printf("App %d now uses bundle '%s'.\n", app.AppId, version.LocalFile)
+
+	err = _startApp(ctx, app, &waitArgs{wait: true, timeout: args.timeout})
+	if err == nil || ExitCode(err) != ExitAppError || args.noRollback {
+		return err
+	}
+
+	fmt.Printf("Deploy failed: %v\n", err)
+	fmt.Println("Rolling back to the previous bundle...")
+	if rbErr := _restoreBundle(ctx, app, previous, args.timeout); rbErr != nil {
+		return &ExitError{
+			Code: ExitAppError,
+			Err:  fmt.Errorf("Deploy failed and rollback failed too: %v", rbErr),
+		}
+	}
+	return &ExitError{
+		Code: ExitAppError,
+		Err:  fmt.Errorf("Deploy failed, app %d was rolled back to its previous bundle.", app.AppId),
+	}
+}
+
+// _restoreBundle switches app back to bundle b after a failed deploy and
+// starts it again.
+func _restoreBundle(ctx *Context, app *appData, b bundle, timeout time.Duration) error {
+	if err := _stopApp(ctx, app, timeout); err != nil {
+		return err
+	}
+
+	app.Bundle = b
+	if _, err := _putApp(ctx, app); err != nil {
+		return err
+	}
+
+	// The bundle may have been deployed before history was kept.
+	if history, err := readAppHistory(ctx); err == nil {
+		if v, ok := history.findBundle(app.AppId, b); ok {
+			recordRollback(ctx, app.AppId, v)
+		}
+	}
+
+	return _startApp(ctx, app, &waitArgs{wait: true, timeout: timeout})
+}
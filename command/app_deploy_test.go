@@ -0,0 +1,152 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// appStubHandler serves app 1, which immediately reaches whatever status is
+// requested. It records the requested statuses in order.
+func appStubHandler(t *testing.T, requested *[]string) http.Handler {
+	app := appData{AppId: 1, ProjectId: 1, AppName: "test", CurrentStatus: appStatusRunning}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/apps/1" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "PUT" {
+			var body appData
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("invalid body: %v", err)
+			}
+			*requested = append(*requested, body.RequestedStatus)
+			if body.RequestedStatus == app.CurrentStatus {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			app.RequestedStatus = body.RequestedStatus
+			app.CurrentStatus = body.RequestedStatus
+		}
+		json.NewEncoder(w).Encode(app)
+	})
+}
+
+func TestRestartApp(t *testing.T) {
+	var requested []string
+	ctx := newTestContext(t, appStubHandler(t, &requested))
+	cmd := &Command{Data: &appRestartArgs{
+		baseAppArgs: baseAppArgs{projectId: 1, id: 1},
+		waitArgs:    waitArgs{wait: true, timeout: time.Minute},
+	}}
+
+	if err := restartApp(cmd, ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requested) != 2 || requested[0] != appStatusStopped || requested[1] != appStatusRunning {
+		t.Errorf("unexpected requested statuses: %v", requested)
+	}
+}
+
+func TestAppDeployArgsIsValid(t *testing.T) {
+	cases := []dataTestCase{
+		{
+			desc: "valid, by id",
+			in: &appDeployArgs{
+				uploadFileArgs: uploadFileArgs{projectId: 1, path: "app.jar"},
+				baseApp:        baseAppArgs{id: 1},
+			},
+			want: true,
+		},
+		{
+			desc: "valid, by name",
+			in: &appDeployArgs{
+				uploadFileArgs: uploadFileArgs{projectId: 1, path: "app.jar"},
+				baseApp:        baseAppArgs{name: "app"},
+			},
+			want: true,
+		},
+		{
+			desc: "invalid, no app",
+			in: &appDeployArgs{
+				uploadFileArgs: uploadFileArgs{projectId: 1, path: "app.jar"},
+			},
+			want: false,
+		},
+		{
+			desc: "invalid, no path",
+			in: &appDeployArgs{
+				uploadFileArgs: uploadFileArgs{projectId: 1},
+				baseApp:        baseAppArgs{id: 1},
+			},
+			want: false,
+		},
+	}
+	runDataTestCase(t, cases)
+}
+
+// slowAppStubHandler serves app 1, which starts in status initial and
+// reaches a requested status only after it was polled polls times. It
+// updates last_modified on every status change.
+func slowAppStubHandler(t *testing.T, initial string, polls int) http.Handler {
+	app := appData{AppId: 1, ProjectId: 1, AppName: "test", CurrentStatus: initial, LastMod: "0"}
+	changes := 0
+	pending := 0
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "PUT" {
+			var body appData
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("invalid body: %v", err)
+			}
+			if body.RequestedStatus != app.RequestedStatus {
+				app.RequestedStatus = body.RequestedStatus
+				pending = polls
+			}
+		} else if pending > 0 {
+			pending--
+			if pending == 0 {
+				changes++
+				app.CurrentStatus = app.RequestedStatus
+				app.LastMod = fmt.Sprint(changes)
+			}
+		}
+		json.NewEncoder(w).Encode(app)
+	})
+}
+
+func fastAppStatusWaiter(t *testing.T) func() {
+	saved := appStatusWaiter
+	appStatusWaiter = &waiter{initial: time.Millisecond, max: time.Millisecond}
+	return func() { appStatusWaiter = saved }
+}
+
+func TestRestoreBundleFromError(t *testing.T) {
+	defer fastAppStatusWaiter(t)()
+	ctx := newTestContext(t, slowAppStubHandler(t, appStatusError, 3))
+
+	app := &appData{AppId: 1, ProjectId: 1, AppName: "test", CurrentStatus: appStatusError}
+	if err := _restoreBundle(ctx, app, bundle{URI: bundleUriPrefix + "old.jar", Type: "JAR"}, time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWaitForAppStatusFailsOnNewError(t *testing.T) {
+	defer fastAppStatusWaiter(t)()
+	ctx := newTestContext(t, slowAppStubHandler(t, appStatusStopped, 2))
+
+	// The app goes from STOPPED to ERROR after the request.
+	app := &appData{AppId: 1, ProjectId: 1, RequestedStatus: appStatusError}
+	if _, err := _putApp(ctx, app); err != nil {
+		t.Fatal(err)
+	}
+	err := waitForAppStatus(ctx, &baseAppArgs{projectId: 1, id: 1}, appStatusRunning, time.Minute)
+	if ExitCode(err) != ExitAppError {
+		t.Errorf("expected an app error, got %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// appHistoryFile is stored in the profile directory and keeps the
+	// bundles that have been deployed for each app.
+	appHistoryFile = "app_history.json"
+
+	checksumAlgSha  = "SHA256"
+	bundleUriPrefix = "file://"
+)
+
+// bundleVersion is a bundle that was deployed for an app.
+type bundleVersion struct {
+	Version    int       `json:"version"`
+	Checksum   string    `json:"checksum"`
+	LocalFile  string    `json:"local_file"`
+	ServerFile string    `json:"server_file"`
+	Type       string    `json:"type"`
+	At         time.Time `json:"at"`
+	By         string    `json:"by"`
+	RollbackOf int       `json:"rollback_of,omitempty"`
+}
+
+func (v *bundleVersion) bundle() bundle {
+	return bundle{
+		Type: v.Type,
+		URI:  bundleUriPrefix + v.ServerFile,
+		Checksum: checksum{
+			Sum:       v.Checksum,
+			Algorithm: checksumAlgSha,
+		},
+	}
+}
+
+// appHistory maps app IDs to the bundles deployed for them, oldest first.
+type appHistory map[string][]bundleVersion
+
+func appKey(appId uint64) string {
+	return strconv.FormatUint(appId, 10)
+}
+
+func readAppHistory(ctx *Context) (appHistory, error) {
+	history := make(appHistory)
+	err := ctx.Profile.ReadData(appHistoryFile, &history)
+	if os.IsNotExist(err) {
+		return history, nil
+	}
+	return history, err
+}
+
+func (h appHistory) save(ctx *Context) error {
+	return ctx.Profile.SaveData(appHistoryFile, h)
+}
+
+// find returns the given version of an app's bundle.
+func (h appHistory) find(appId uint64, version int) (*bundleVersion, bool) {
+	for i, v := range h[appKey(appId)] {
+		if v.Version == version {
+			return &h[appKey(appId)][i], true
+		}
+	}
+	return nil, false
+}
+
+// findBundle returns the most recent version of an app's bundle that is b.
+func (h appHistory) findBundle(appId uint64, b bundle) (*bundleVersion, bool) {
+	versions := h[appKey(appId)]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].Checksum == b.Checksum.Sum && bundleUriPrefix+versions[i].ServerFile == b.URI {
+			return &versions[i], true
+		}
+	}
+	return nil, false
+}
+
+// previous returns the most recent version of an app's bundle that differs
+// from the bundle with checksum current.
+func (h appHistory) previous(appId uint64, current string) (*bundleVersion, bool) {
+	versions := h[appKey(appId)]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].Checksum != current {
+			return &versions[i], true
+		}
+	}
+	return nil, false
+}
+
+// add appends v to the history of an app, giving it the next version number.
+func (h appHistory) add(appId uint64, v bundleVersion) bundleVersion {
+	key := appKey(appId)
+	v.Version = 1
+	if n := len(h[key]); n > 0 {
+		v.Version = h[key][n-1].Version + 1
+	}
+	h[key] = append(h[key], v)
+	return v
+}
+
+// newBundleVersion describes a bundle of type bundleType uploaded from args
+// with the given digest.
+func newBundleVersion(ctx *Context, args *uploadFileArgs, bundleType, digest string) bundleVersion {
+	return bundleVersion{
+		Checksum:   digest,
+		LocalFile:  filepath.Base(args.path),
+		ServerFile: args.serverFileName(digest),
+		Type:       bundleType,
+		At:         time.Now(),
+		By:         currentUser(ctx),
+	}
+}
+
+// recordRollback adds an entry for rolling back to version v to the local
+// history of an app.
+func recordRollback(ctx *Context, appId uint64, v *bundleVersion) {
+	entry := *v
+	entry.RollbackOf = v.Version
+	entry.At = time.Now()
+	entry.By = currentUser(ctx)
+	recordBundle(ctx, appId, entry)
+}
+
+// recordBundle adds a deployed bundle to the local history of an app. Failing
+// to record it does not fail the deployment, so only a warning is printed.
+func recordBundle(ctx *Context, appId uint64, v bundleVersion) {
+	history, err := readAppHistory(ctx)
+	if err == nil {
+		history.add(appId, v)
+		err = history.save(ctx)
+	}
+	if err != nil {
+		fmt.Printf("Warning: could not save app bundle history: %v\n", err)
+	}
+}
+
+type appHistoryArgs struct {
+	baseAppArgs
+}
+
+func (a *appHistoryArgs) IsValid() bool {
+	return a.baseAppArgs.IsValid()
+}
+
+func newAppHistoryCmd(ctx *Context) *Command {
+	args := new(appHistoryArgs)
+
+	cmd := &Command{
+		Name: "history",
+		// ApiPath determined by flags
+		Usage:  "Show the bundles that have been deployed for an app from this profile.",
+		Data:   args,
+		Action: showAppHistory,
+	}
+	flags := cmd.newFlagSetApp()
+	flags.Uint64Var(&args.id, "id", 0, "App ID (this or -name is required)")
+	flags.StringVar(&args.name, "name", "", "App name (this or -id is required)")
+	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject,
+		"Project ID of app (defaults to active project)")
+
+	return cmd
+}
+
+func showAppHistory(c *Command, ctx *Context) error {
+	args := c.Data.(*appHistoryArgs)
+	app, err := _getApp(ctx, &args.baseAppArgs)
+	if err != nil {
+		return err
+	}
+	history, err := readAppHistory(ctx)
+	if err != nil {
+		return err
+	}
+
+	versions := history[appKey(app.AppId)]
+	if len(versions) == 0 {
+		fmt.Printf("No bundle history for app %d.\n", app.AppId)
+		return nil
+	}
+
+	for _, v := range versions {
+		marker := " "
+		if v.Checksum == app.Bundle.Checksum.Sum && app.Bundle.URI == bundleUriPrefix+v.ServerFile {
+			marker = "*"
+		}
+		note := ""
+		if v.RollbackOf > 0 {
+			note = fmt.Sprintf(" (rollback to v%d)", v.RollbackOf)
+		}
+		fmt.Printf("%s v%-3d %s  %s  %s by %s%s\n", marker, v.Version, v.Checksum[:minInt(12, len(v.Checksum))],
+			v.LocalFile, v.At.Format(stateTimeFormat), v.By, note)
+	}
+	fmt.Println()
+	fmt.Println("* = currently deployed")
+	return nil
+}
+
+type appRollbackArgs struct {
+	baseAppArgs
+	version int
+}
+
+func (a *appRollbackArgs) IsValid() bool {
+	return a.baseAppArgs.IsValid() && a.version >= 0
+}
+
+func newAppRollbackCmd(ctx *Context) *Command {
+	args := new(appRollbackArgs)
+
+	cmd := &Command{
+		Name: "rollback",
+		// ApiPath determined by flags
+		Usage:  "Deploy a previously deployed bundle of an app again (see 'iobeam app history').",
+		Data:   args,
+		Action: rollbackApp,
+	}
+	flags := cmd.newFlagSetApp()
+	flags.Uint64Var(&args.id, "id", 0, "App ID (this or -name is required)")
+	flags.StringVar(&args.name, "name", "", "App name (this or -id is required)")
+	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject,
+		"Project ID of app (defaults to active project)")
+	flags.IntVar(&args.version, "to", 0, "Version to roll back to (defaults to the version before the current one).")
+
+	return cmd
+}
+
+func rollbackApp(c *Command, ctx *Context) error {
+	args := c.Data.(*appRollbackArgs)
+	app, err := _getApp(ctx, &args.baseAppArgs)
+	if err != nil {
+		return err
+	}
+
+	v, err := _rollbackApp(ctx, app, args.version)
+	if err == nil {
+		fmt.Printf("App %d rolled back to version %d (%s).\n", app.AppId, v.Version, v.LocalFile)
+	}
+	return err
+}
+
+// _rollbackApp points the bundle of app to the given version from its
+// history, or to the previous version if version is 0. It returns the
+// version that was deployed.
+func _rollbackApp(ctx *Context, app *appData, version int) (*bundleVersion, error) {
+	history, err := readAppHistory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *bundleVersion
+	var ok bool
+	if version > 0 {
+		target, ok = history.find(app.AppId, version)
+		if !ok {
+			return nil, fmt.Errorf("App %d has no version %d, see 'iobeam app history -id %d'.",
+				app.AppId, version, app.AppId)
+		}
+	} else {
+		target, ok = history.previous(app.AppId, app.Bundle.Checksum.Sum)
+		if !ok {
+			return nil, fmt.Errorf("App %d has no previous version to roll back to.", app.AppId)
+		}
+	}
+
+	app.Bundle = target.bundle()
+	if _, err := _putApp(ctx, app); err != nil {
+		return nil, err
+	}
+
+	recordRollback(ctx, app.AppId, target)
+	return target, nil
+}
@@ -0,0 +1,64 @@
+package command
+
+import "testing"
+
+func TestVersionedFileName(t *testing.T) {
+	digest := "0123456789abcdef0123"
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{in: "build/app.jar", want: "app-0123456789ab.jar"},
+		{in: "app", want: "app-0123456789ab"},
+		{in: "/tmp/my.app.jar", want: "my.app-0123456789ab.jar"},
+		{in: "dist/app.tar.gz", want: "app-0123456789ab.tar.gz"},
+	}
+	for _, c := range cases {
+		if got := versionedFileName(c.in, digest); got != c.want {
+			t.Errorf("versionedFileName(%s) = %s, want %s", c.in, got, c.want)
+		}
+	}
+
+	args := &uploadFileArgs{path: "build/app.jar"}
+	if got := args.serverFileName(digest); got != "app.jar" {
+		t.Errorf("unversioned server file name: got %s", got)
+	}
+	args.versioned = true
+	if got := args.serverFileName(digest); got != "app-0123456789ab.jar" {
+		t.Errorf("versioned server file name: got %s", got)
+	}
+}
+
+func TestAppHistory(t *testing.T) {
+	h := make(appHistory)
+	v1 := h.add(7, bundleVersion{Checksum: "aaa"})
+	v2 := h.add(7, bundleVersion{Checksum: "bbb", ServerFile: "app-bbb.jar"})
+	other := h.add(8, bundleVersion{Checksum: "ccc"})
+	if v1.Version != 1 || v2.Version != 2 || other.Version != 1 {
+		t.Errorf("unexpected version numbers: %d, %d, %d", v1.Version, v2.Version, other.Version)
+	}
+
+	if v, ok := h.find(7, 1); !ok || v.Checksum != "aaa" {
+		t.Errorf("find(7, 1) failed: %v %v", v, ok)
+	}
+	if _, ok := h.find(7, 3); ok {
+		t.Errorf("find(7, 3) should fail")
+	}
+
+	if v, ok := h.previous(7, "bbb"); !ok || v.Version != 1 {
+		t.Errorf("previous(7, bbb) failed: %v %v", v, ok)
+	}
+	// After rolling back to v1, the previous version is v2 again.
+	h.add(7, bundleVersion{Checksum: "aaa", RollbackOf: 1})
+	if v, ok := h.previous(7, "aaa"); !ok || v.Version != 2 {
+		t.Errorf("previous(7, aaa) after rollback failed: %v %v", v, ok)
+	}
+	if _, ok := h.previous(8, "ccc"); ok {
+		t.Errorf("previous(8, ccc) should fail")
+	}
+
+	b := v2.bundle()
+	if b.URI != "file://app-bbb.jar" || b.Checksum.Sum != "bbb" || b.Checksum.Algorithm != checksumAlgSha {
+		t.Errorf("unexpected bundle: %+v", b)
+	}
+}
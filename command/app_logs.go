@@ -0,0 +1,279 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iobeam/iobeam/client"
+)
+
+const (
+	logSourceAll      = "all"
+	logSourceDriver   = "driver"
+	logSourceExecutor = "executor"
+	logSourceEvents   = "events"
+
+	logTimeFormat = time.RFC3339Nano
+
+	// logPollInterval is how often new logs are fetched with -follow.
+	logPollInterval = 2 * time.Second
+)
+
+var logSources = []string{logSourceAll, logSourceDriver, logSourceExecutor, logSourceEvents}
+
+// appLogLine is a single line of output from an app's driver or executors.
+type appLogLine struct {
+	Time       time.Time `json:"time"`
+	Source     string    `json:"source"`
+	ExecutorId string    `json:"executor_id,omitempty"`
+	Level      string    `json:"level,omitempty"`
+	Message    string    `json:"message"`
+}
+
+// appEvent is a state transition of an app, e.g. RUNNING -> ERROR.
+type appEvent struct {
+	Time       time.Time `json:"time"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Message    string    `json:"message,omitempty"`
+}
+
+// logEntry is either a log line or an event, so both can be printed in
+// time order.
+type logEntry struct {
+	time time.Time
+	text string
+}
+
+func (l *appLogLine) entry() logEntry {
+	source := l.Source
+	if len(l.ExecutorId) > 0 {
+		source += " " + l.ExecutorId
+	}
+	level := ""
+	if len(l.Level) > 0 {
+		level = l.Level + " "
+	}
+	return logEntry{
+		time: l.Time,
+		text: fmt.Sprintf("%s [%s] %s%s", l.Time.Format(logTimeFormat), source, level, l.Message),
+	}
+}
+
+func (e *appEvent) entry() logEntry {
+	text := fmt.Sprintf("%s [event] %s -> %s", e.Time.Format(logTimeFormat), e.FromStatus, e.ToStatus)
+	if len(e.Message) > 0 {
+		text += ": " + e.Message
+	}
+	return logEntry{time: e.Time, text: text}
+}
+
+// mergeLogEntries returns the entries of logs and events sorted by time.
+// Entries with equal times keep their order, with log lines first.
+func mergeLogEntries(logs []appLogLine, events []appEvent) []logEntry {
+	entries := make([]logEntry, 0, len(logs)+len(events))
+	for i := range logs {
+		entries = append(entries, logs[i].entry())
+	}
+	for i := range events {
+		entries = append(entries, events[i].entry())
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].time.Before(entries[j].time)
+	})
+	return entries
+}
+
+// parseTimeArg parses s either as an RFC 3339 timestamp or as a duration
+// before now (ex. 10m, 2h).
+func parseTimeArg(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("Invalid time '%s': use a timestamp (ex. 2016-01-02T15:04:05Z) or a duration (ex. 10m)", s)
+	}
+	return now.Add(-d), nil
+}
+
+type appLogsArgs struct {
+	baseAppArgs
+	follow bool
+	since  string
+	until  string
+	source string
+}
+
+func (a *appLogsArgs) IsValid() bool {
+	now := time.Now()
+	sinceOk := len(a.since) == 0
+	if !sinceOk {
+		_, err := parseTimeArg(a.since, now)
+		sinceOk = err == nil
+	}
+	untilOk := len(a.until) == 0
+	if !untilOk {
+		_, err := parseTimeArg(a.until, now)
+		untilOk = err == nil && !a.follow
+	}
+	return a.baseAppArgs.IsValid() && sinceOk && untilOk && isInList(a.source, logSources)
+}
+
+func newAppLogsCmd(ctx *Context) *Command {
+	args := new(appLogsArgs)
+
+	cmd := &Command{
+		Name: "logs",
+		// ApiPath determined by flags
+		Usage:  "Show the driver and executor logs and state changes of an app.",
+		Data:   args,
+		Action: showAppLogs,
+	}
+	flags := cmd.newFlagSetApp()
+	flags.Uint64Var(&args.id, "id", 0, "App ID (this or -name is required)")
+	flags.StringVar(&args.name, "name", "", "App name (this or -id is required)")
+	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject,
+		"Project ID of app (defaults to active project)")
+	flags.BoolVar(&args.follow, "follow", false, "Keep printing new logs until the app stops.")
+	flags.StringVar(&args.since, "since", "",
+		"Only show logs after this time, either a timestamp (ex. 2016-01-02T15:04:05Z) or a duration before now (ex. 10m).")
+	flags.StringVar(&args.until, "until", "",
+		"Only show logs before this time, in the same format as -since (cannot be used with -follow).")
+	flags.StringVar(&args.source, "source", logSourceAll,
+		"Which logs to show. Valid values: "+strings.Join(logSources, ", ")+".")
+
+	return cmd
+}
+
+func showAppLogs(c *Command, ctx *Context) error {
+	args := c.Data.(*appLogsArgs)
+	return streamAppLogs(ctx, args, os.Stdout, logPollInterval)
+}
+
+// appLogQuery is the time range and source of logs to fetch.
+type appLogQuery struct {
+	since  time.Time
+	until  time.Time
+	source string
+}
+
+func (q *appLogQuery) wantLogs() bool {
+	return q.source != logSourceEvents
+}
+
+func (q *appLogQuery) wantEvents() bool {
+	return q.source == logSourceAll || q.source == logSourceEvents
+}
+
+// streamAppLogs prints the logs of an app to w. With -follow, it polls for
+// new logs every interval until the app is stopped or has failed.
+func streamAppLogs(ctx *Context, args *appLogsArgs, w io.Writer, interval time.Duration) error {
+	if err := args.resolve(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	query := &appLogQuery{source: args.source}
+	if len(args.since) > 0 {
+		query.since, _ = parseTimeArg(args.since, now)
+	}
+	if len(args.until) > 0 {
+		query.until, _ = parseTimeArg(args.until, now)
+	}
+
+	// Polls overlap by the time of the last printed entry, so entries at that
+	// time are remembered to avoid printing them twice.
+	printed := make(map[string]bool)
+	for {
+		entries, err := _getAppLogs(ctx, args.projectId, args.id, query)
+		if err != nil {
+			return err
+		}
+
+		seen := make(map[string]bool)
+		for _, e := range entries {
+			if !printed[e.text] {
+				fmt.Fprintln(w, e.text)
+			}
+			if e.time.Equal(entries[len(entries)-1].time) {
+				seen[e.text] = true
+			}
+		}
+		if len(entries) > 0 {
+			query.since = entries[len(entries)-1].time
+			printed = seen
+		}
+
+		if !args.follow {
+			return nil
+		}
+
+		app, err := _getApp(ctx, &args.baseAppArgs)
+		if err != nil {
+			return err
+		}
+		if app.CurrentStatus == appStatusStopped || app.CurrentStatus == appStatusError {
+			// Fetch once more to get logs written while the app was stopping.
+			args.follow = false
+			continue
+		}
+		time.Sleep(interval)
+	}
+}
+
+// _getAppLogs fetches the log lines and events of an app matching query,
+// sorted by time.
+func _getAppLogs(ctx *Context, projectId, appId uint64, query *appLogQuery) ([]logEntry, error) {
+	type logsResult struct {
+		Logs []appLogLine `json:"logs"`
+	}
+	type eventsResult struct {
+		Events []appEvent `json:"events"`
+	}
+
+	logs := new(logsResult)
+	if query.wantLogs() {
+		req := ctx.Client.Get(getUrlforAppId(appId) + "/logs")
+		if query.source != logSourceAll {
+			req.Param("source", query.source)
+		}
+		query.setParams(req)
+		_, err := req.Expect(200).
+			ProjectToken(ctx.Profile, projectId).
+			ResponseBody(logs).
+			Execute()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	events := new(eventsResult)
+	if query.wantEvents() {
+		req := ctx.Client.Get(getUrlforAppId(appId) + "/events")
+		query.setParams(req)
+		_, err := req.Expect(200).
+			ProjectToken(ctx.Profile, projectId).
+			ResponseBody(events).
+			Execute()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mergeLogEntries(logs.Logs, events.Events), nil
+}
+
+// setParams adds the time range of q as query parameters of req.
+func (q *appLogQuery) setParams(req *client.Request) {
+	if !q.since.IsZero() {
+		req.Param("since", q.since.Format(logTimeFormat))
+	}
+	if !q.until.IsZero() {
+		req.Param("until", q.until.Format(logTimeFormat))
+	}
+}
@@ -0,0 +1,168 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAppLogsArgsValidity(t *testing.T) {
+	base := baseAppArgs{projectId: 1, id: 1}
+	cases := []dataTestCase{
+		{
+			desc: "valid with defaults",
+			in:   &appLogsArgs{baseAppArgs: base, source: logSourceAll},
+			want: true,
+		},
+		{
+			desc: "valid with duration and timestamp",
+			in:   &appLogsArgs{baseAppArgs: base, source: logSourceDriver, since: "10m", until: "2016-01-02T15:04:05Z"},
+			want: true,
+		},
+		{
+			desc: "invalid, missing app",
+			in:   &appLogsArgs{baseAppArgs: baseAppArgs{projectId: 1}, source: logSourceAll},
+			want: false,
+		},
+		{
+			desc: "invalid source",
+			in:   &appLogsArgs{baseAppArgs: base, source: "stdout"},
+			want: false,
+		},
+		{
+			desc: "invalid since",
+			in:   &appLogsArgs{baseAppArgs: base, source: logSourceAll, since: "yesterday"},
+			want: false,
+		},
+		{
+			desc: "invalid, until with follow",
+			in:   &appLogsArgs{baseAppArgs: base, source: logSourceAll, until: "5m", follow: true},
+			want: false,
+		},
+	}
+
+	runDataTestCase(t, cases)
+}
+
+func TestParseTimeArg(t *testing.T) {
+	now := time.Date(2016, 1, 2, 15, 0, 0, 0, time.UTC)
+	cases := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "10m", want: now.Add(-10 * time.Minute)},
+		{in: "2016-01-01T00:00:00Z", want: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "-5m", wantErr: true},
+		{in: "soon", wantErr: true},
+	}
+
+	for _, c := range cases {
+		got, err := parseTimeArg(c.in, now)
+		if c.wantErr != (err != nil) {
+			t.Errorf("parseTimeArg(%s): unexpected error result: %v", c.in, err)
+		} else if !c.wantErr && !got.Equal(c.want) {
+			t.Errorf("parseTimeArg(%s) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestMergeLogEntries(t *testing.T) {
+	t0 := time.Date(2016, 1, 2, 15, 0, 0, 0, time.UTC)
+	logs := []appLogLine{
+		{Time: t0, Source: logSourceDriver, Message: "starting"},
+		{Time: t0.Add(2 * time.Second), Source: logSourceExecutor, ExecutorId: "1", Level: "ERROR", Message: "boom"},
+	}
+	events := []appEvent{
+		{Time: t0.Add(time.Second), FromStatus: "STARTING", ToStatus: appStatusRunning},
+		{Time: t0.Add(3 * time.Second), FromStatus: appStatusRunning, ToStatus: appStatusError, Message: "executor lost"},
+	}
+
+	got := mergeLogEntries(logs, events)
+	want := []string{
+		"2016-01-02T15:00:00Z [driver] starting",
+		"2016-01-02T15:00:01Z [event] STARTING -> RUNNING",
+		"2016-01-02T15:00:02Z [executor 1] ERROR boom",
+		"2016-01-02T15:00:03Z [event] RUNNING -> ERROR: executor lost",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].text != want[i] {
+			t.Errorf("entry %d: got '%s', want '%s'", i, got[i].text, want[i])
+		}
+	}
+}
+
+// logStubHandler serves the logs of app 1, adding one log line per poll and
+// reporting the app as stopped after the second poll.
+func logStubHandler(t *testing.T) http.Handler {
+	polls := 0
+	lines := []appLogLine{
+		{Time: time.Date(2016, 1, 2, 15, 0, 0, 0, time.UTC), Source: logSourceDriver, Message: "first"},
+		{Time: time.Date(2016, 1, 2, 15, 0, 1, 0, time.UTC), Source: logSourceDriver, Message: "second"},
+		{Time: time.Date(2016, 1, 2, 15, 0, 2, 0, time.UTC), Source: logSourceDriver, Message: "third"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/apps/1/logs", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		var since time.Time
+		if s := r.URL.Query().Get("since"); len(s) > 0 {
+			var err error
+			if since, err = time.Parse(logTimeFormat, s); err != nil {
+				t.Errorf("invalid since parameter: %s", s)
+			}
+		}
+
+		// Like the real server, lines at exactly the since time are included.
+		out := []appLogLine{}
+		for _, l := range lines[:minInt(polls, len(lines))] {
+			if !l.Time.Before(since) {
+				out = append(out, l)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]appLogLine{"logs": out})
+	})
+	mux.HandleFunc("/v1/apps/1/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if len(r.URL.Query().Get("since")) == 0 {
+			fmt.Fprint(w, `{"events": [{"time": "2016-01-02T15:00:00.5Z", "from_status": "STARTING", "to_status": "RUNNING"}]}`)
+		} else {
+			fmt.Fprint(w, `{"events": []}`)
+		}
+	})
+	mux.HandleFunc("/v1/apps/1", func(w http.ResponseWriter, r *http.Request) {
+		status := appStatusRunning
+		if polls >= 2 {
+			status = appStatusStopped
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"app_id": 1, "app_name": "test", "current_status": "%s"}`, status)
+	})
+
+	return mux
+}
+
+func TestStreamAppLogsFollow(t *testing.T) {
+	ctx := newTestContext(t, logStubHandler(t))
+	args := &appLogsArgs{baseAppArgs: baseAppArgs{projectId: 1, id: 1}, follow: true, source: logSourceAll}
+
+	var out bytes.Buffer
+	if err := streamAppLogs(ctx, args, &out, time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "2016-01-02T15:00:00Z [driver] first\n" +
+		"2016-01-02T15:00:00.5Z [event] STARTING -> RUNNING\n" +
+		"2016-01-02T15:00:01Z [driver] second\n" +
+		"2016-01-02T15:00:02Z [driver] third\n"
+	if out.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
@@ -1,12 +1,10 @@
 package command
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
-	"path/filepath"
-	"time"
-
-	"github.com/iobeam/iobeam/client"
+	"strconv"
 )
 
 const (
@@ -15,10 +13,6 @@ const (
 	appStatusError   = "ERROR"
 
 	keyApp = "app"
-
-	maxStatusTries = 20
-	backOffAmt     = 5
-	backOffMax     = 15
 )
 
 func init() {
@@ -58,6 +52,27 @@ type appData struct {
 	RequestedStatus string `json:"requested_status,omitempty"`
 	CurrentStatus   string `json:"current_status,omitempty"`
 	Error           string `json:"error,omitempty"`
+
+	Config  map[string]string `json:"config,omitempty"`
+	Secrets map[string]string `json:"secrets,omitempty"`
+}
+
+// MarshalJSON leaves out Config and Secrets only when they are nil, so that
+// a map emptied with -unset is sent and clears the values on the server.
+func (i appData) MarshalJSON() ([]byte, error) {
+	type plainApp appData
+	out := struct {
+		plainApp
+		Config  *map[string]string `json:"config,omitempty"`
+		Secrets *map[string]string `json:"secrets,omitempty"`
+	}{plainApp: plainApp(i)}
+	if i.Config != nil {
+		out.Config = &i.Config
+	}
+	if i.Secrets != nil {
+		out.Secrets = &i.Secrets
+	}
+	return json.Marshal(out)
 }
 
 func (i *appData) Print() {
@@ -78,6 +93,7 @@ func (i *appData) Print() {
 	fmt.Println()
 	fmt.Println("BUNDLE INFO")
 	i.Bundle.Print()
+	printAppConfig(i.Config, i.Secrets)
 }
 
 // NewAppsCommand returns the base 'app' command.
@@ -86,13 +102,18 @@ func NewAppsCommand(ctx *Context) *Command {
 		Name:  keyApp,
 		Usage: "Commands for managing apps.",
 		SubCommands: Mux{
-			"create": newLaunchAppCmd(ctx),
-			"delete": newDeleteAppCmd(ctx),
-			"get":    newGetAppCmd(ctx),
-			"list":   newListAppsCmd(ctx),
-			"start":  newStartAppCmd(ctx),
-			"stop":   newStopAppCmd(ctx),
-			"update": newUpdateAppCmd(ctx),
+			"create":   newLaunchAppCmd(ctx),
+			"delete":   newDeleteAppCmd(ctx),
+			"deploy":   newAppDeployCmd(ctx),
+			"get":      newGetAppCmd(ctx),
+			"history":  newAppHistoryCmd(ctx),
+			"list":     newListAppsCmd(ctx),
+			"logs":     newAppLogsCmd(ctx),
+			"restart":  newAppRestartCmd(ctx),
+			"rollback": newAppRollbackCmd(ctx),
+			"start":    newStartAppCmd(ctx),
+			"stop":     newStopAppCmd(ctx),
+			"update":   newUpdateAppCmd(ctx),
 		},
 	}
 	cmd.NewFlagSet(flagSetNames[keyApp])
@@ -103,11 +124,14 @@ func NewAppsCommand(ctx *Context) *Command {
 // launchAppArgs are the arguments for the 'launch' subcommand
 type launchAppArgs struct {
 	uploadFileArgs
+	waitArgs
+	appConfigArgs
+	bundleArgs
 	name string
 }
 
 func (a *launchAppArgs) IsValid() bool {
-	return a.uploadFileArgs.IsValid() && len(a.name) > 0
+	return a.uploadFileArgs.IsValid() && a.waitArgs.IsValid() && a.bundleArgs.IsValid() && len(a.name) > 0
 }
 
 func newLaunchAppCmd(ctx *Context) *Command {
@@ -123,32 +147,39 @@ func newLaunchAppCmd(ctx *Context) *Command {
 	flags := cmd.newFlagSetApp()
 	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject, "Project ID (defaults to active project).")
 	flags.StringVar(&args.name, "name", "", "Name of the app. (REQUIRED)")
-	flags.StringVar(&args.path, "path", "", "Path to app to upload. (REQUIRED)")
+	flags.StringVar(&args.path, "path", "", "Path to app file or directory to upload. (REQUIRED)")
+	args.setBundleFlags(flags)
+	args.setChunkSizeFlag(flags)
+	args.setConfigFlags(flags, false)
+	args.setWaitFlags(flags, false)
 
 	return cmd
 }
 
 func launchApp(c *Command, ctx *Context) error {
 	args := c.Data.(*launchAppArgs)
-	digest, err := _uploadFile(ctx, &args.uploadFileArgs)
-	if err != nil {
-		return err
-	}
-
 	data := &appData{
 		AppName:         args.name,
 		ProjectId:       args.projectId,
 		RequestedStatus: appStatusRunning,
-		Bundle: bundle{
-			Type: "JAR",
-			URI:  "file://" + filepath.Base(args.path),
-			Checksum: checksum{
-				Sum:       digest,
-				Algorithm: "SHA256",
-			},
-		},
+	}
+	if err := args.apply(data); err != nil {
+		return err
 	}
 
+	cleanup, err := args.prepareBundle(&args.uploadFileArgs)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	args.versioned = true
+	digest, err := _uploadFile(ctx, &args.uploadFileArgs)
+	if err != nil {
+		return err
+	}
+	version := newBundleVersion(ctx, &args.uploadFileArgs, args.bundleType, digest)
+	data.Bundle = version.bundle()
+
 	_, err = ctx.Client.
 		Post(c.ApiPath).
 		Expect(201).
@@ -166,17 +197,30 @@ func launchApp(c *Command, ctx *Context) error {
 			return nil
 		}).Execute()
 
+	if err == nil {
+		recordBundle(ctx, data.AppId, version)
+	}
+	if err == nil && args.shouldWait() {
+		app := &baseAppArgs{projectId: args.projectId, id: data.AppId}
+		err = waitForAppStatus(ctx, app, appStatusRunning, args.timeout)
+	}
+
 	return err
 }
 
-// updateAppArgs are the arguments for the 'update' subcommand
+// updateAppArgs are the arguments for the 'update' subcommand. id or
+// appName (the -name flag, as in the other app commands) select the app to
+// update, while the embedded name is its new name (the -newName flag).
 type updateAppArgs struct {
 	launchAppArgs
-	id uint64
+	id      uint64
+	appName string
 }
 
 func (a *updateAppArgs) IsValid() bool {
-	return a.id > 0 && (len(a.name) > 0 || len(a.path) > 0)
+	changed := len(a.name) > 0 || len(a.path) > 0 || a.appConfigArgs.isSet()
+	selected := a.id > 0 || len(a.appName) > 0
+	return selected && changed && a.waitArgs.IsValid() && a.bundleArgs.IsValid()
 }
 
 func newUpdateAppCmd(ctx *Context) *Command {
@@ -185,15 +229,20 @@ func newUpdateAppCmd(ctx *Context) *Command {
 	cmd := &Command{
 		Name: "update",
 		// ApiPath determined by flags
-		Usage:  "Update an app, including replacing the JAR.",
+		Usage:  "Update an app, including replacing the JAR and changing its config. Use -newName to rename it.",
 		Data:   args,
 		Action: updateApp,
 	}
 	flags := cmd.newFlagSetApp()
 	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject, "Project ID (defaults to active project).")
-	flags.Uint64Var(&args.id, "id", 0, "App ID to update. (REQUIRED)")
-	flags.StringVar(&args.name, "name", "", "Name of the app.")
-	flags.StringVar(&args.path, "path", "", "Path to app to upload.")
+	flags.Uint64Var(&args.id, "id", 0, "App ID to update (this or -name is required).")
+	flags.StringVar(&args.appName, "name", "", "Name of the app to update (this or -id is required).")
+	flags.StringVar(&args.name, "newName", "", "New name of the app.")
+	flags.StringVar(&args.path, "path", "", "Path to app file or directory to upload.")
+	args.setBundleFlags(flags)
+	args.setChunkSizeFlag(flags)
+	args.setConfigFlags(flags, true)
+	args.setWaitFlags(flags, false)
 
 	return cmd
 }
@@ -202,10 +251,12 @@ func updateApp(c *Command, ctx *Context) error {
 	args := c.Data.(*updateAppArgs)
 
 	// Get app info to do PUT
-	app, err := _getApp(ctx, &baseAppArgs{
+	base := &baseAppArgs{
 		id:        args.id,
+		name:      args.appName,
 		projectId: args.projectId,
-	})
+	}
+	app, err := _getApp(ctx, base)
 	if err != nil {
 		return err
 	}
@@ -213,34 +264,47 @@ func updateApp(c *Command, ctx *Context) error {
 	if len(args.name) > 0 {
 		app.AppName = args.name
 	}
+	if err := args.apply(app); err != nil {
+		return err
+	}
 
+	var version *bundleVersion
 	if len(args.path) > 0 {
-		digest, err := _uploadFile(ctx, &args.uploadFileArgs)
+		cleanup, err := args.prepareBundle(&args.uploadFileArgs)
+		defer cleanup()
 		if err != nil {
 			return err
 		}
-		app.Bundle = bundle{
-			Type: "JAR",
-			URI:  "file://" + filepath.Base(args.path),
-			Checksum: checksum{
-				Sum:       digest,
-				Algorithm: "SHA256",
-			},
+		args.versioned = true
+		digest, err := _uploadFile(ctx, &args.uploadFileArgs)
+		if err != nil {
+			return err
 		}
+		v := newBundleVersion(ctx, &args.uploadFileArgs, args.bundleType, digest)
+		version = &v
+		app.Bundle = version.bundle()
 	}
 
 	rsp, err := ctx.Client.
-		Put(getUrlforAppId(args.id)).
+		Put(getUrlforAppId(base.id)).
 		Expect(200).
 		ProjectToken(ctx.Profile, args.projectId).
 		Body(app).
 		Execute()
 
 	if err == nil {
+		ctx.forgetNames(keyApp)
 		fmt.Println("App successfully updated.")
-	} else if rsp.Http().StatusCode == 204 {
+		if version != nil {
+			recordBundle(ctx, base.id, *version)
+		}
+	} else if rsp != nil && rsp.Http().StatusCode == 204 {
 		fmt.Println("App not modified.")
-		return nil
+		err = nil
+	}
+
+	if err == nil && args.shouldWait() && len(app.RequestedStatus) > 0 {
+		err = waitForAppStatus(ctx, base, app.RequestedStatus, args.timeout)
 	}
 
 	return err
@@ -294,16 +358,34 @@ func getApp(c *Command, ctx *Context) error {
 	return err
 }
 
+// resolve looks up the ID of the app when it was selected by name.
+func (a *baseAppArgs) resolve(ctx *Context) error {
+	if a.id > 0 {
+		return nil
+	}
+
+	id, err := resolveName(ctx, keyApp, a.projectId, a.name, func() ([]resourceRef, error) {
+		apps, err := _getApps(ctx, a.projectId)
+		refs := make([]resourceRef, len(apps))
+		for i, app := range apps {
+			refs[i] = resourceRef{id: strconv.FormatUint(app.AppId, 10), name: app.AppName}
+		}
+		return refs, err
+	})
+	if err != nil {
+		return err
+	}
+	a.id, err = strconv.ParseUint(id, 10, 64)
+	return err
+}
+
 func _getApp(ctx *Context, args *baseAppArgs) (*appData, error) {
-	var req *client.Request
-	if args.id > 0 {
-		req = ctx.Client.Get(getUrlforAppId(args.id))
-	} else {
-		req = ctx.Client.Get(baseApiPath[keyApp]).Param("name", args.name)
+	if err := args.resolve(ctx); err != nil {
+		return nil, err
 	}
 
 	app := new(appData)
-	_, err := req.Expect(200).
+	_, err := ctx.Client.Get(getUrlforAppId(args.id)).Expect(200).
 		ProjectToken(ctx.Profile, args.projectId).
 		ResponseBody(app).
 		ResponseBodyHandler(func(body interface{}) error {
@@ -316,6 +398,7 @@ func _getApp(ctx *Context, args *baseAppArgs) (*appData, error) {
 // deleteAppArgs are the arguments for the 'delete' subcommand
 type deleteAppArgs struct {
 	baseAppArgs
+	force bool
 }
 
 func (a *deleteAppArgs) IsValid() bool {
@@ -333,21 +416,35 @@ func newDeleteAppCmd(ctx *Context) *Command {
 		Action: deleteApp,
 	}
 	flags := cmd.newFlagSetApp()
-	flags.Uint64Var(&args.id, "id", 0, "App ID to delete (REQUIRED)")
+	flags.Uint64Var(&args.id, "id", 0, "App ID to delete (this or -name is required)")
+	flags.StringVar(&args.name, "name", "", "App name to delete (this or -id is required)")
 	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject,
 		"Project ID to delete from (defaults to active project)")
+	flags.BoolVar(&args.force, "force", false, descForce)
 
 	return cmd
 }
 
 func deleteApp(c *Command, ctx *Context) error {
 	args := c.Data.(*deleteAppArgs)
+	byName := args.id == 0
+	if err := args.resolve(ctx); err != nil {
+		return err
+	}
+	if byName {
+		err := confirmByName("delete", keyApp, args.name, strconv.FormatUint(args.id, 10), args.force)
+		if err != nil {
+			return err
+		}
+	}
+
 	req := ctx.Client.Delete(getUrlforAppId(args.id))
 
 	_, err := req.Expect(204).
 		ProjectToken(ctx.Profile, args.projectId).Execute()
 
 	if err == nil {
+		ctx.forgetNames(keyApp)
 		fmt.Printf("App %d sucessfully deleted.\n", args.id)
 	}
 
@@ -380,43 +477,53 @@ func newListAppsCmd(ctx *Context) *Command {
 }
 
 func listApps(c *Command, ctx *Context) error {
+	args := c.Data.(*listAppsArgs)
+	apps, err := _getApps(ctx, args.projectId)
+	if err != nil {
+		return err
+	}
+
+	if len(apps) > 0 {
+		spacer := ""
+		for _, info := range apps {
+			fmt.Printf(spacer)
+			info.Print()
+			fmt.Println()
+			spacer = "----------\n\n"
+		}
+	} else {
+		fmt.Printf("No apps found for project %d.\n", args.projectId)
+	}
+
+	return nil
+}
+
+func _getApps(ctx *Context, projectId uint64) ([]appData, error) {
 	type listResult struct {
 		Apps []appData `json:"apps"`
 	}
-	args := c.Data.(*listAppsArgs)
 
+	list := new(listResult)
 	_, err := ctx.Client.
-		Get(c.ApiPath).
+		Get(baseApiPath[keyApp]).
 		Expect(200).
-		ProjectToken(ctx.Profile, args.projectId).
-		ResponseBody(new(listResult)).
+		ProjectToken(ctx.Profile, projectId).
+		ResponseBody(list).
 		ResponseBodyHandler(func(body interface{}) error {
-			list := body.(*listResult)
-			if len(list.Apps) > 0 {
-				spacer := ""
-				for _, info := range list.Apps {
-					fmt.Printf(spacer)
-					info.Print()
-					fmt.Println()
-					spacer = "----------\n\n"
-				}
-			} else {
-				fmt.Printf("No apps found for project %d.\n", args.projectId)
-			}
-
 			return nil
 		}).Execute()
 
-	return err
+	return list.Apps, err
 }
 
 type appStartOrStopArgs struct {
 	baseAppArgs
+	waitArgs
 	isStart bool
 }
 
 func (a *appStartOrStopArgs) IsValid() bool {
-	return a.baseAppArgs.IsValid()
+	return a.baseAppArgs.IsValid() && a.waitArgs.IsValid()
 }
 
 func newStartOrStopAppCmd(ctx *Context, isStart bool) *Command {
@@ -425,10 +532,10 @@ func newStartOrStopAppCmd(ctx *Context, isStart bool) *Command {
 	var desc string
 	if isStart {
 		cmdStr = "start"
-		desc = "Start an app by ID."
+		desc = "Start an app by ID or name."
 	} else {
 		cmdStr = "stop"
-		desc = "Stop an app by ID."
+		desc = "Stop an app by ID or name."
 	}
 
 	cmd := &Command{
@@ -439,10 +546,11 @@ func newStartOrStopAppCmd(ctx *Context, isStart bool) *Command {
 		Action: updateAppStatus,
 	}
 	flags := cmd.newFlagSetApp()
-	flags.Uint64Var(&args.id, "id", 0, "App ID (REQUIRED).")
-	//flags.StringVar(&args.name, "name", "", "App name (this or -id is required)")
+	flags.Uint64Var(&args.id, "id", 0, "App ID (this or -name is required)")
+	flags.StringVar(&args.name, "name", "", "App name (this or -id is required)")
 	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject,
 		"Project ID of app (defaults to active project)")
+	args.setWaitFlags(flags, true)
 
 	return cmd
 }
@@ -462,13 +570,6 @@ func updateAppStatus(c *Command, ctx *Context) error {
 		return err
 	}
 
-	var req *client.Request
-	if args.id > 0 {
-		req = ctx.Client.Put(getUrlforAppId(args.id))
-	} else {
-		req = ctx.Client.Put(baseApiPath[keyApp]).Param("name", args.name)
-	}
-
 	var wantedStatus string
 	if args.isStart {
 		wantedStatus = appStatusRunning
@@ -476,51 +577,36 @@ func updateAppStatus(c *Command, ctx *Context) error {
 		wantedStatus = appStatusStopped
 	}
 	app.RequestedStatus = wantedStatus
-	rsp, err := req.
-		Expect(200).
-		ProjectToken(ctx.Profile, args.projectId).
-		Body(app).
-		Execute()
-
-	if err != nil && rsp.Http().StatusCode == 204 {
+	modified, err := _putApp(ctx, app)
+	if err != nil {
+		return err
+	} else if !modified {
 		fmt.Printf("Requested status is already %s\n", wantedStatus)
 		return nil
-	} else if err != nil {
-		return err
 	}
 
-	fmt.Printf("Requested status: %s. Waiting for current status to change.\n", wantedStatus)
-	tries := 0
-	sleep := 0
-	for true {
-		fmt.Printf("Checking app status...")
-		time.Sleep(time.Duration(sleep) * time.Second)
-
-		app, err := _getApp(ctx, &args.baseAppArgs)
-		if err != nil {
-			return fmt.Errorf("Error while waiting for status change: %v\n", err)
-		}
-		fmt.Printf("%s\n", app.CurrentStatus)
-
-		if app.CurrentStatus == wantedStatus {
-			fmt.Printf("Success!\n")
-			break
-		} else if app.CurrentStatus == appStatusError {
-			fmt.Printf("Unsuccessful, app finished in error state.\n")
-			break
-		}
+	fmt.Printf("Requested status: %s.\n", wantedStatus)
+	if !args.shouldWait() {
+		return nil
+	}
+	return waitForAppStatus(ctx, &args.baseAppArgs, wantedStatus, args.timeout)
+}
 
-		sleep += backOffAmt
-		if sleep > backOffMax {
-			sleep = backOffMax
-		}
+// _putApp updates app on the server. It reports whether the app was modified,
+// since the API responds with 204 if nothing changed.
+func _putApp(ctx *Context, app *appData) (bool, error) {
+	rsp, err := ctx.Client.
+		Put(getUrlforAppId(app.AppId)).
+		Expect(200).
+		ProjectToken(ctx.Profile, app.ProjectId).
+		Body(app).
+		Execute()
 
-		tries++
-		if tries > maxStatusTries {
-			fmt.Printf("Timed out waiting for app status to change.\n")
-			break
-		}
+	if err != nil && rsp != nil && rsp.Http().StatusCode == 204 {
+		return false, nil
 	}
-
-	return nil
+	if err == nil {
+		ctx.forgetNames(keyApp)
+	}
+	return err == nil, err
 }
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strings"
 
 	"github.com/iobeam/iobeam/client"
 	"github.com/iobeam/iobeam/config"
@@ -40,11 +41,68 @@ func (i *setFlags) Set(value string) error {
 	return nil
 }
 
+// listFlags is used to call a flag multiple times to create an ordered list
+// of flag values. The first use of the flag replaces any values the list
+// already had.
+type listFlags struct {
+	list *[]string
+	set  bool
+}
+
+func newListFlags(list *[]string) *listFlags {
+	return &listFlags{list: list}
+}
+
+func (l *listFlags) String() string {
+	if l.list == nil {
+		return ""
+	}
+	return strings.Join(*l.list, ",")
+}
+
+func (l *listFlags) Set(value string) error {
+	if !l.set {
+		*l.list = nil
+		l.set = true
+	}
+	*l.list = append(*l.list, value)
+	return nil
+}
+
+// keyValueFlags is used to call a flag multiple times with key=value pairs,
+// which are collected into a map. Later values for a key replace earlier ones.
+type keyValueFlags map[string]string
+
+func (m keyValueFlags) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m keyValueFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 {
+		return fmt.Errorf("expected key=value, got '%s'", value)
+	}
+	m[strings.TrimSpace(parts[0])] = parts[1]
+	return nil
+}
+
 // Data is an interface for data that is posted to API, generated from command-line input.
 type Data interface {
 	IsValid() bool
 }
 
+// posArgsData is Data that also takes positional arguments, which may appear
+// before, after or between the flags of its command.
+type posArgsData interface {
+	Data
+	setPosArgs(args []string) error
+}
+
 // Context is the current CLI context.
 type Context struct {
 	Cmd     *Command
@@ -52,6 +110,10 @@ type Context struct {
 	Profile *config.Profile
 	Index   int
 	Args    []string
+
+	// resolvedNames caches the IDs of resources looked up by name, see
+	// resolveName.
+	resolvedNames map[string]string
 }
 
 // Mux maps a subcommand name to its Command object.
@@ -67,6 +129,7 @@ type Command struct {
 	Name        string
 	Usage       string
 	ApiPath     string
+	PosArgs     string // name(s) of positional arguments shown in usage, e.g. DIR
 	flags       *flag.FlagSet
 	SubCommands Mux
 	Data        Data
@@ -112,7 +175,7 @@ func (c *Command) printUsage() {
 				temp.Name, temp.Usage)
 		}
 	} else {
-		fmt.Fprintf(os.Stderr, "Usage: %s %s\n\n", c.Name, flagsStr)
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n\n", c.Name, strings.TrimSpace(flagsStr+" "+c.PosArgs))
 		fmt.Fprintf(os.Stderr, "%s\n", c.Usage)
 	}
 
@@ -182,6 +245,10 @@ func (c *Command) Execute(ctx *Context) error {
 }
 
 func (c *Command) parseFlags(ctx *Context) error {
+	if data, ok := c.Data.(posArgsData); ok && c.flags != nil {
+		return c.parsePosArgs(ctx, data)
+	}
+
 	if c.flags != nil {
 		c.flags.Parse(ctx.Args[ctx.Index:])
 		ctx.Index += c.flags.NFlag()
@@ -195,6 +262,30 @@ func (c *Command) parseFlags(ctx *Context) error {
 	return nil
 }
 
+// parsePosArgs parses the flags of c, collecting any arguments that are not
+// flags and passing them to data.
+func (c *Command) parsePosArgs(ctx *Context, data posArgsData) error {
+	var posArgs []string
+	rest := ctx.Args[ctx.Index:]
+	for {
+		c.flags.Parse(rest)
+		rest = c.flags.Args()
+		if len(rest) == 0 {
+			break
+		}
+		posArgs = append(posArgs, rest[0])
+		rest = rest[1:]
+	}
+	ctx.Index = len(ctx.Args)
+
+	if err := data.setPosArgs(posArgs); err != nil {
+		c.printUsage()
+		fmt.Print("\n-----\n")
+		return err
+	}
+	return nil
+}
+
 // isInList looks for a string in a list of strings.
 func isInList(item string, list []string) bool {
 	for _, i := range list {
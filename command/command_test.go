@@ -0,0 +1,23 @@
+package command
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iobeam/iobeam/client"
+	"github.com/iobeam/iobeam/config"
+)
+
+// newTestContext returns a Context whose client talks to a test server
+// running handler. The profile does not exist on disk, so nothing the
+// commands save under test is written out. The server is closed when the
+// test ends.
+func newTestContext(t *testing.T, handler http.Handler) *Context {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &Context{
+		Client:  client.NewClient(&server.URL, "test"),
+		Profile: &config.Profile{Name: "iobeam-test-no-such-profile"},
+	}
+}
@@ -0,0 +1,348 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iobeam/iobeam/client"
+	"github.com/iobeam/iobeam/config"
+)
+
+// copyCheckpointsFile is stored in the directory of the active profile and
+// keeps how far unfinished copies got.
+const copyCheckpointsFile = "copy_checkpoints.json"
+
+// NewDataCommand returns the base 'data' command.
+func NewDataCommand(ctx *Context) *Command {
+	cmd := &Command{
+		Name:  "data",
+		Usage: "Commands for moving data between namespaces.",
+		SubCommands: Mux{
+			"copy": newCopyDataCmd(ctx),
+		},
+	}
+	cmd.NewFlagSet("iobeam data")
+
+	return cmd
+}
+
+// dataEndpoint is one side of a copy: a namespace in a project, accessed
+// with a profile.
+type dataEndpoint struct {
+	profile   string
+	projectId uint64
+	namespace string
+}
+
+func (e *dataEndpoint) IsValid() bool {
+	return len(e.profile) > 0 && e.projectId > 0 && len(e.namespace) > 0
+}
+
+func (e *dataEndpoint) String() string {
+	return fmt.Sprintf("%s/%d/%s", e.profile, e.projectId, e.namespace)
+}
+
+// context returns a Context that uses the server and tokens of the profile
+// of e. ctx is returned as is if it already uses that profile.
+func (e *dataEndpoint) context(ctx *Context) (*Context, error) {
+	if ctx.Profile.Name == e.profile {
+		return ctx, nil
+	}
+	profile, err := config.ReadProfile(e.profile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read profile '%s': %v", e.profile, err)
+	}
+	return &Context{
+		Client:  client.NewClient(&profile.Server, config.CLIVersion),
+		Profile: profile,
+		Args:    ctx.Args,
+		Index:   ctx.Index,
+	}, nil
+}
+
+type copyDataArgs struct {
+	src       dataEndpoint
+	dst       dataEndpoint
+	since     string
+	until     string
+	wheres    setFlags
+	renames   keyValueFlags
+	labels    setFlags
+	window    time.Duration
+	limit     int
+	batchSize int
+	restart   bool
+}
+
+func (a *copyDataArgs) IsValid() bool {
+	now := time.Now()
+	_, sinceErr := parseTimeArg(a.since, now)
+	untilOk := len(a.until) == 0
+	if !untilOk {
+		_, err := parseTimeArg(a.until, now)
+		untilOk = err == nil
+	}
+	return a.src.IsValid() && a.dst.IsValid() && a.src != a.dst && sinceErr == nil && untilOk &&
+		a.window > 0 && a.window <= maxDataWindow && a.limit > 0 && a.batchSize > 0
+}
+
+func newCopyDataCmd(ctx *Context) *Command {
+	args := &copyDataArgs{renames: make(keyValueFlags)}
+
+	cmd := &Command{
+		Name: "copy",
+		Usage: "Copy data from one namespace to another, possibly in another project or profile. " +
+			"Values are converted to the types of the destination namespace, and fields it does not have are left out. " +
+			"An interrupted copy resumes when run again.",
+		Data:   args,
+		Action: copyData,
+	}
+	flags := cmd.NewFlagSet("iobeam data copy")
+	flags.StringVar(&args.src.profile, "fromProfile", ctx.Profile.Name, "Profile to read with (defaults to active profile).")
+	flags.Uint64Var(&args.src.projectId, "fromProject", ctx.Profile.ActiveProject, "Project to read from (defaults to active project).")
+	flags.StringVar(&args.src.namespace, "fromNamespace", "input", "Namespace to read from.")
+	flags.StringVar(&args.dst.profile, "toProfile", ctx.Profile.Name, "Profile to write with (defaults to active profile).")
+	flags.Uint64Var(&args.dst.projectId, "toProject", ctx.Profile.ActiveProject, "Project to write to (defaults to active project).")
+	flags.StringVar(&args.dst.namespace, "toNamespace", "input", "Namespace to write to. It must exist.")
+	flags.StringVar(&args.since, "since", "", "Copy data from this time (ex. 2016-01-02T15:04:05Z or 24h) (REQUIRED)")
+	flags.StringVar(&args.until, "until", "", "Copy data up to this time (defaults to now).")
+	flags.Var(&args.wheres, "where", "Only copy rows matching a predicate, as in 'iobeam query' (ex. eq(device_id,\"a\")). Can occur multiple times.")
+	flags.Var(args.renames, "rename", "Rename a field, on the form old=new. Can occur multiple times.")
+	flags.Var(&args.labels, "label", "Label to set on the copied data (ex. source=\"prod\"). Can occur multiple times.")
+	flags.DurationVar(&args.window, "window", maxDataWindow, "Time range to read per query (at most 24h).")
+	flags.IntVar(&args.limit, "limit", defaultDataLimit, "Maximum rows per query; windows with more rows are split.")
+	flags.IntVar(&args.batchSize, "batchSize", defaultBatchSize, "Rows per import request.")
+	flags.BoolVar(&args.restart, "restart", false, "Start from -since even if an earlier copy was interrupted.")
+
+	return cmd
+}
+
+// checkpointKey identifies a copy, so that running the same copy again
+// resumes it.
+func (a *copyDataArgs) checkpointKey() string {
+	return fmt.Sprintf("%s -> %s since=%s until=%s where=%s rename=%s",
+		&a.src, &a.dst, a.since, a.until, strings.Join(sortedSet(a.wheres), ","), a.renames)
+}
+
+// copyCheckpoint is how far a copy got: all rows before Next were copied.
+type copyCheckpoint struct {
+	Next time.Time `json:"next"`
+	Rows int       `json:"rows"`
+}
+
+// checkpointStore keeps checkpoints of unfinished copies by key.
+type checkpointStore interface {
+	get(key string) (*copyCheckpoint, error)
+	put(key string, c *copyCheckpoint) error
+	remove(key string) error
+}
+
+// profileCheckpointStore keeps checkpoints in the profile directory.
+type profileCheckpointStore struct {
+	ctx *Context
+}
+
+func (s *profileCheckpointStore) load() (map[string]*copyCheckpoint, error) {
+	checkpoints := make(map[string]*copyCheckpoint)
+	err := s.ctx.Profile.ReadData(copyCheckpointsFile, &checkpoints)
+	if os.IsNotExist(err) {
+		return checkpoints, nil
+	}
+	return checkpoints, err
+}
+
+func (s *profileCheckpointStore) get(key string) (*copyCheckpoint, error) {
+	checkpoints, err := s.load()
+	return checkpoints[key], err
+}
+
+func (s *profileCheckpointStore) put(key string, c *copyCheckpoint) error {
+	checkpoints, err := s.load()
+	if err != nil {
+		return err
+	}
+	checkpoints[key] = c
+	return s.ctx.Profile.SaveData(copyCheckpointsFile, checkpoints)
+}
+
+func (s *profileCheckpointStore) remove(key string) error {
+	checkpoints, err := s.load()
+	if err != nil {
+		return err
+	}
+	delete(checkpoints, key)
+	return s.ctx.Profile.SaveData(copyCheckpointsFile, checkpoints)
+}
+
+// renameFields returns row with its fields renamed according to renames.
+func renameFields(row dataRow, renames map[string]string) dataRow {
+	if len(renames) == 0 {
+		return row
+	}
+	out := make(dataRow, len(row))
+	for name, v := range row {
+		if renamed, ok := renames[name]; ok {
+			name = renamed
+		}
+		out[name] = v
+	}
+	return out
+}
+
+// checkRenames checks that renames do not involve time and do not rename two
+// fields to the same name.
+func checkRenames(renames map[string]string) error {
+	targets := make(map[string]string)
+	for _, from := range sortedKeys(renames) {
+		to := renames[from]
+		if from == fieldTime || to == fieldTime {
+			return fmt.Errorf("The field '%s' cannot be renamed.", fieldTime)
+		}
+		if other, ok := targets[to]; ok {
+			return fmt.Errorf("Both '%s' and '%s' are renamed to '%s'.", other, from, to)
+		}
+		targets[to] = from
+	}
+	return nil
+}
+
+func copyData(c *Command, ctx *Context) error {
+	args := c.Data.(*copyDataArgs)
+	if err := checkRenames(args.renames); err != nil {
+		return err
+	}
+	labels, err := parseLabels(args.labels)
+	if err != nil {
+		return err
+	}
+
+	srcCtx, err := args.src.context(ctx)
+	if err != nil {
+		return err
+	}
+	dstCtx, err := args.dst.context(ctx)
+	if err != nil {
+		return err
+	}
+
+	return runCopy(srcCtx, dstCtx, args, labels, &profileCheckpointStore{ctx: ctx}, time.Now())
+}
+
+// runCopy copies the data selected by args from srcCtx to dstCtx, saving a
+// checkpoint in store after every import batch and window.
+func runCopy(srcCtx, dstCtx *Context, args *copyDataArgs, labels map[string]interface{}, store checkpointStore, now time.Time) error {
+	start, _ := parseTimeArg(args.since, now)
+	end := now
+	if len(args.until) > 0 {
+		end, _ = parseTimeArg(args.until, now)
+	}
+	if !start.Before(end) {
+		return fmt.Errorf("Nothing to copy: -since is not before -until.")
+	}
+
+	dstNs, err := _getNamespaceByName(dstCtx, args.dst.projectId, args.dst.namespace)
+	if err != nil {
+		return err
+	}
+
+	key := args.checkpointKey()
+	checkpoint := &copyCheckpoint{Next: start}
+	if saved, err := store.get(key); err != nil {
+		return fmt.Errorf("Could not read copy checkpoint: %v", err)
+	} else if saved != nil && !args.restart {
+		checkpoint = saved
+		fmt.Printf("Resuming copy at %s (%d rows copied before).\n", checkpoint.Next.UTC().Format(time.RFC3339), checkpoint.Rows)
+	}
+
+	fmt.Printf("Copying %s -> %s\n", &args.src, &args.dst)
+	dropped := make(map[string]bool)
+	stream := &dataStream{
+		projectId: args.src.projectId,
+		namespace: args.src.namespace,
+		from:      checkpoint.Next,
+		to:        end,
+		window:    args.window,
+		limit:     args.limit,
+		wheres:    sortedSet(args.wheres),
+	}
+	err = stream.run(srcCtx, func(rows []dataRow, windowEnd time.Time) error {
+		converted := make([]dataRow, len(rows))
+		for i, row := range rows {
+			row = renameFields(row, args.renames)
+			for name := range row {
+				if _, ok := dstNs.Fields[name]; !ok && name != fieldTime && !dropped[name] {
+					dropped[name] = true
+					fmt.Printf("Warning: '%s' has no field '%s', its values are not copied.\n", dstNs.Name, name)
+				}
+			}
+			out, err := convertRow(row, dstNs.Fields)
+			if err != nil {
+				return fmt.Errorf("Cannot convert row at time %v: %v", row[fieldTime], err)
+			}
+			converted[i] = out
+		}
+		for _, batch := range timeBatches(converted, args.batchSize) {
+			if err := _importRows(dstCtx, args.dst.projectId, args.dst.namespace, batch, labels, len(batch)); err != nil {
+				return err
+			}
+			// The rows are in time order, so everything before the next
+			// millisecond has been imported.
+			last, _ := toInt64(batch[len(batch)-1][fieldTime])
+			checkpoint.Next = time.Unix(0, (last+1)*int64(time.Millisecond))
+			checkpoint.Rows += len(batch)
+			if err := store.put(key, checkpoint); err != nil {
+				return fmt.Errorf("Could not save copy checkpoint: %v", err)
+			}
+		}
+
+		checkpoint.Next = windowEnd
+		if err := store.put(key, checkpoint); err != nil {
+			return fmt.Errorf("Could not save copy checkpoint: %v", err)
+		}
+		if len(rows) > 0 {
+			fmt.Printf("Copied %d rows up to %s (%.0f%% of time range)\n",
+				checkpoint.Rows, windowEnd.UTC().Format(time.RFC3339), timeProgress(start, end, windowEnd)*100)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Copy stopped after %d rows: %v\nRun the same command again to resume.", checkpoint.Rows, err)
+	}
+
+	if err := store.remove(key); err != nil {
+		fmt.Printf("Warning: could not clear copy checkpoint: %v\n", err)
+	}
+	fmt.Printf("Copy done: %d rows copied.\n", checkpoint.Rows)
+	return nil
+}
+
+// timeBatches splits rows, sorted by time, into batches of size rows. Rows
+// with the same time are kept in one batch, which may make it larger, so
+// that a checkpoint after a batch never falls between them.
+func timeBatches(rows []dataRow, size int) [][]dataRow {
+	var batches [][]dataRow
+	for start := 0; start < len(rows); {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		for end < len(rows) && rows[end][fieldTime] == rows[end-1][fieldTime] {
+			end++
+		}
+		batches = append(batches, rows[start:end])
+		start = end
+	}
+	return batches
+}
+
+func sortedSet(s setFlags) []string {
+	items := make([]string, 0, len(s))
+	for item := range s {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return items
+}
@@ -0,0 +1,223 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func validCopyDataArgs() *copyDataArgs {
+	return &copyDataArgs{
+		src:       dataEndpoint{profile: "prod", projectId: 1, namespace: "input"},
+		dst:       dataEndpoint{profile: "staging", projectId: 2, namespace: "input"},
+		since:     "24h",
+		window:    time.Hour,
+		limit:     10,
+		batchSize: 10,
+	}
+}
+
+func TestCopyDataArgsValidity(t *testing.T) {
+	same := validCopyDataArgs()
+	same.dst = same.src
+	noSince := validCopyDataArgs()
+	noSince.since = ""
+	badUntil := validCopyDataArgs()
+	badUntil.until = "later"
+	noNamespace := validCopyDataArgs()
+	noNamespace.dst.namespace = ""
+
+	cases := []dataTestCase{
+		{desc: "valid", in: validCopyDataArgs(), want: true},
+		{desc: "invalid, same source and destination", in: same, want: false},
+		{desc: "invalid, no since", in: noSince, want: false},
+		{desc: "invalid, bad until", in: badUntil, want: false},
+		{desc: "invalid, no destination namespace", in: noNamespace, want: false},
+	}
+	runDataTestCase(t, cases)
+}
+
+func TestRenameFields(t *testing.T) {
+	row := dataRow{"time": 1, "temp": 2, "hum": 3}
+	got := renameFields(row, map[string]string{"temp": "temperature"})
+	if fmt.Sprint(got) != "map[hum:3 temperature:2 time:1]" {
+		t.Errorf("unexpected row: %v", got)
+	}
+
+	if err := checkRenames(map[string]string{"time": "t"}); err == nil {
+		t.Errorf("expected error renaming time")
+	}
+	if err := checkRenames(map[string]string{"a": "c", "b": "c"}); err == nil {
+		t.Errorf("expected error for two fields renamed to the same name")
+	}
+	if err := checkRenames(map[string]string{"a": "b", "b": "a"}); err != nil {
+		t.Errorf("unexpected error swapping fields: %v", err)
+	}
+}
+
+func TestCheckpointKey(t *testing.T) {
+	a := validCopyDataArgs()
+	a.wheres = setFlags{"eq(a,1)": {}, "eq(b,2)": {}}
+	want := "prod/1/input -> staging/2/input since=24h until= where=eq(a,1),eq(b,2) rename="
+	if got := a.checkpointKey(); got != want {
+		t.Errorf("got key '%s', want '%s'", got, want)
+	}
+}
+
+type memCheckpointStore struct {
+	checkpoints map[string]copyCheckpoint
+}
+
+func (s *memCheckpointStore) get(key string) (*copyCheckpoint, error) {
+	if c, ok := s.checkpoints[key]; ok {
+		return &c, nil
+	}
+	return nil, nil
+}
+
+func (s *memCheckpointStore) put(key string, c *copyCheckpoint) error {
+	s.checkpoints[key] = *c
+	return nil
+}
+
+func (s *memCheckpointStore) remove(key string) error {
+	delete(s.checkpoints, key)
+	return nil
+}
+
+// importStub serves the namespace 'input' and records imported rows.
+// failAfter makes imports fail once that many have succeeded (< 0 never).
+type importStub struct {
+	http.Handler
+	imports   []importObj
+	failAfter int
+}
+
+func newImportStub() *importStub {
+	s := &importStub{failAfter: -1}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/namespaces/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"namespaces": [{"namespace_name": "input", "namespace_id": 3, `+
+			`"fields": {"temperature": "DOUBLE", "device_id": "STRING"}}]}`)
+	})
+	mux.HandleFunc("/v1/imports", func(w http.ResponseWriter, r *http.Request) {
+		if s.failAfter >= 0 && len(s.imports) >= s.failAfter {
+			w.WriteHeader(500)
+			return
+		}
+		var obj importObj
+		json.NewDecoder(r.Body).Decode(&obj)
+		s.imports = append(s.imports, obj)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{}`)
+	})
+	s.Handler = mux
+	return s
+}
+
+func TestRunCopy(t *testing.T) {
+	var queries []string
+	srcCtx := newTestContext(t, dataStubHandler([]int64{1000, 2000, 3600*1000 + 5}, &queries))
+	dst := newImportStub()
+	dst.failAfter = 1
+	dstCtx := newTestContext(t, dst)
+
+	args := validCopyDataArgs()
+	args.since = "1970-01-01T00:00:00Z"
+	args.until = "1970-01-01T02:00:00Z"
+	args.renames = keyValueFlags{"n": "temperature"}
+	labels := map[string]interface{}{"source": "prod"}
+	store := &memCheckpointStore{checkpoints: make(map[string]copyCheckpoint)}
+	now := time.Unix(0, 0).Add(48 * time.Hour)
+
+	// The first window is imported, the second fails.
+	if err := runCopy(srcCtx, dstCtx, args, labels, store, now); err == nil {
+		t.Fatalf("expected copy to fail")
+	}
+	saved := store.checkpoints[args.checkpointKey()]
+	if saved.Rows != 2 || !saved.Next.Equal(time.Unix(3600, 0)) {
+		t.Errorf("unexpected checkpoint: %+v", saved)
+	}
+
+	// Running again resumes at the checkpoint.
+	dst.failAfter = -1
+	queries = nil
+	if err := runCopy(srcCtx, dstCtx, args, labels, store, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if queries[0] != "3600000,7199999" {
+		t.Errorf("copy did not resume at checkpoint, queries: %v", queries)
+	}
+	if len(store.checkpoints) != 0 {
+		t.Errorf("checkpoint was not removed: %v", store.checkpoints)
+	}
+
+	if len(dst.imports) != 2 {
+		t.Fatalf("expected 2 imports, got %d", len(dst.imports))
+	}
+	first := dst.imports[0]
+	if fmt.Sprint(first.Data.Fields) != "[time temperature]" || fmt.Sprint(first.Data.Values) != "[[1000 1] [2000 2]]" {
+		t.Errorf("unexpected first import: %+v", first.Data)
+	}
+	if first.Labels["source"] != "prod" || first.ProjectId != 2 {
+		t.Errorf("unexpected labels or project: %+v", first)
+	}
+}
+
+func TestRunCopyResumesWithinWindow(t *testing.T) {
+	var queries []string
+	srcCtx := newTestContext(t, dataStubHandler([]int64{1000, 2000, 3600*1000 + 5}, &queries))
+	dst := newImportStub()
+	dst.failAfter = 1
+	dstCtx := newTestContext(t, dst)
+
+	args := validCopyDataArgs()
+	args.since = "1970-01-01T00:00:00Z"
+	args.until = "1970-01-01T02:00:00Z"
+	args.batchSize = 1
+	store := &memCheckpointStore{checkpoints: make(map[string]copyCheckpoint)}
+	now := time.Unix(0, 0).Add(48 * time.Hour)
+
+	// The first batch of the first window is imported, the second fails.
+	if err := runCopy(srcCtx, dstCtx, args, nil, store, now); err == nil {
+		t.Fatalf("expected copy to fail")
+	}
+	saved := store.checkpoints[args.checkpointKey()]
+	if saved.Rows != 1 || !saved.Next.Equal(time.Unix(0, 1001*int64(time.Millisecond))) {
+		t.Errorf("unexpected checkpoint: %+v", saved)
+	}
+
+	dst.failAfter = -1
+	queries = nil
+	if err := runCopy(srcCtx, dstCtx, args, nil, store, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if queries[0] != "1001,3601000" {
+		t.Errorf("copy did not resume after the imported row, queries: %v", queries)
+	}
+	var times []int64
+	for _, obj := range dst.imports {
+		ms, _ := toInt64(obj.Data.Values[0].([]interface{})[0])
+		times = append(times, ms)
+	}
+	if fmt.Sprint(times) != "[1000 2000 3600005]" {
+		t.Errorf("expected each row imported once, got times %v", times)
+	}
+}
+
+func TestTimeBatches(t *testing.T) {
+	var rows []dataRow
+	for _, ms := range []int64{1, 2, 2, 2, 3, 4} {
+		rows = append(rows, dataRow{fieldTime: ms})
+	}
+	var sizes []int
+	for _, batch := range timeBatches(rows, 2) {
+		sizes = append(sizes, len(batch))
+	}
+	if fmt.Sprint(sizes) != "[4 2]" {
+		t.Errorf("got batch sizes %v, want [4 2]", sizes)
+	}
+}
@@ -0,0 +1,311 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	fieldTime = "time"
+
+	// maxDataWindow is the longest time range the query API accepts.
+	maxDataWindow    = 24 * time.Hour
+	minDataWindow    = time.Second
+	defaultDataLimit = 10000
+	defaultBatchSize = 1000
+)
+
+// dataRow is a single row of a namespace, by field name. Times are in
+// milliseconds.
+type dataRow map[string]interface{}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// _queryDataWindow returns the rows of namespace with a time in [from, to)
+// that match all wheres (see 'iobeam query -where').
+func _queryDataWindow(ctx *Context, projectId uint64, namespace string, from, to time.Time, limit int, wheres []string) ([]dataRow, error) {
+	type queryResult struct {
+		Result []struct {
+			Fields []string        `json:"fields"`
+			Values [][]interface{} `json:"values"`
+		} `json:"result"`
+	}
+
+	result := new(queryResult)
+	// Both ends of the time range are inclusive.
+	req := ctx.Client.
+		Get("/v1/data/"+namespace+"/").
+		Expect(200).
+		ProjectToken(ctx.Profile, projectId).
+		Param("time", fmt.Sprintf("%d,%d", millis(from), millis(to)-1)).
+		ParamInt("limit", limit).
+		Param("timefmt", timeFmtMsec).
+		Param("output", outputJson)
+	for _, where := range wheres {
+		req = req.Param("where", where)
+	}
+	_, err := req.ResponseBody(result).Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []dataRow
+	for _, r := range result.Result {
+		for _, values := range r.Values {
+			if len(values) != len(r.Fields) {
+				return nil, fmt.Errorf("Query returned %d values for %d fields", len(values), len(r.Fields))
+			}
+			row := make(dataRow, len(values))
+			for i, v := range values {
+				row[r.Fields[i]] = v
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// dataStream reads all rows of a namespace between two times, one time
+// window at a time.
+type dataStream struct {
+	projectId uint64
+	namespace string
+	from      time.Time
+	to        time.Time
+	window    time.Duration
+	limit     int
+	wheres    []string
+}
+
+// run calls fn with the rows of each window, in time order, together with
+// the end of the window. A window that returns limit rows may have been
+// truncated, so it is split in half and read again; the window grows back
+// after windows that were not full.
+func (s *dataStream) run(ctx *Context, fn func(rows []dataRow, end time.Time) error) error {
+	maxWindow := s.window
+	if maxWindow <= 0 || maxWindow > maxDataWindow {
+		maxWindow = maxDataWindow
+	}
+	window := maxWindow
+	limit := s.limit
+	if limit <= 0 {
+		limit = defaultDataLimit
+	}
+
+	for start := s.from; start.Before(s.to); {
+		end := start.Add(window)
+		if end.After(s.to) {
+			end = s.to
+		}
+
+		rows, err := _queryDataWindow(ctx, s.projectId, s.namespace, start, end, limit, s.wheres)
+		if err != nil {
+			return err
+		}
+		if len(rows) >= limit {
+			if window <= minDataWindow {
+				return fmt.Errorf("More than %d rows between %s and %s, use a higher limit.",
+					limit, start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+			}
+			window /= 2
+			continue
+		}
+
+		sortRowsByTime(rows)
+		if err := fn(rows, end); err != nil {
+			return err
+		}
+		start = end
+		if len(rows) < limit/4 && window < maxWindow {
+			window *= 2
+			if window > maxWindow {
+				window = maxWindow
+			}
+		}
+	}
+	return nil
+}
+
+func sortRowsByTime(rows []dataRow) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, _ := toInt64(rows[i][fieldTime])
+		b, _ := toInt64(rows[j][fieldTime])
+		return a < b
+	})
+}
+
+// toInt64 converts a number decoded from JSON to an int64, failing if it has
+// a fractional part.
+func toInt64(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return 0, err
+		}
+		return toInt64(f)
+	case int64:
+		return n, nil
+	case int:
+		return int64(n), nil
+	case float64:
+		if n != math.Trunc(n) || math.Abs(n) > math.MaxInt64 {
+			return 0, fmt.Errorf("%v is not a whole number", n)
+		}
+		return int64(n), nil
+	}
+	return 0, fmt.Errorf("%v is not a number", v)
+}
+
+// convertValue converts v to iobeam type t. Nil values stay nil. It fails
+// for values that cannot be represented in t, e.g. 1.5 as LONG.
+func convertValue(v interface{}, t string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch t {
+	case typeString:
+		switch x := v.(type) {
+		case string:
+			return x, nil
+		case json.Number:
+			return x.String(), nil
+		case float64:
+			return strconv.FormatFloat(x, 'g', -1, 64), nil
+		}
+		return fmt.Sprint(v), nil
+
+	case typeLong:
+		if s, ok := v.(string); ok {
+			v = json.Number(strings.TrimSpace(s))
+		}
+		if _, ok := v.(bool); ok {
+			break
+		}
+		return toInt64(v)
+
+	case typeDouble:
+		switch x := v.(type) {
+		case json.Number:
+			return x.Float64()
+		case string:
+			return strconv.ParseFloat(strings.TrimSpace(x), 64)
+		case float64:
+			return x, nil
+		case int64:
+			return float64(x), nil
+		case int:
+			return float64(x), nil
+		}
+
+	case typeBoolean:
+		switch x := v.(type) {
+		case bool:
+			return x, nil
+		case string:
+			return strconv.ParseBool(strings.TrimSpace(x))
+		default:
+			if n, err := toInt64(v); err == nil && (n == 0 || n == 1) {
+				return n == 1, nil
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("Unknown type %s", t)
+	}
+	return nil, fmt.Errorf("cannot convert %v to %s", v, t)
+}
+
+// convertRow returns row with the fields of schema converted to their type.
+// Fields not in schema are left out; time is always kept.
+func convertRow(row dataRow, schema map[string]string) (dataRow, error) {
+	out := make(dataRow, len(schema)+1)
+	t, err := toInt64(row[fieldTime])
+	if err != nil {
+		return nil, fmt.Errorf("bad time: %v", err)
+	}
+	out[fieldTime] = t
+
+	for name, typ := range schema {
+		v, ok := row[name]
+		if !ok || v == nil {
+			continue
+		}
+		converted, err := convertValue(v, typ)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %v", name, err)
+		}
+		out[name] = converted
+	}
+	return out, nil
+}
+
+// rowsTable returns rows as a table: time followed by the other fields of
+// the rows in sorted order, with nil for missing values.
+func rowsTable(rows []dataRow) dataObj {
+	names := make(map[string]bool)
+	for _, row := range rows {
+		for name := range row {
+			if name != fieldTime {
+				names[name] = true
+			}
+		}
+	}
+	fields := []string{fieldTime}
+	for name := range names {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields[1:])
+
+	values := make([]interface{}, len(rows))
+	for i, row := range rows {
+		v := make([]interface{}, len(fields))
+		for j, name := range fields {
+			v[j] = row[name]
+		}
+		values[i] = v
+	}
+	return dataObj{Fields: fields, Values: values}
+}
+
+// _importRows imports rows into namespace, batchSize rows per request.
+func _importRows(ctx *Context, projectId uint64, namespace string, rows []dataRow, labels map[string]interface{}, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		obj := importObj{
+			ProjectId: projectId,
+			Namespace: namespace,
+			Data:      rowsTable(rows[start:end]),
+			Labels:    labels,
+		}
+		_, err := ctx.Client.
+			Post("/v1/imports").
+			Expect(200).
+			ProjectToken(ctx.Profile, projectId).
+			Param("fmt", "table").
+			Body(obj).
+			Execute()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvertValue(t *testing.T) {
+	cases := []struct {
+		in      interface{}
+		typ     string
+		want    interface{}
+		wantErr bool
+	}{
+		{in: nil, typ: typeLong, want: nil},
+		{in: json.Number("12"), typ: typeLong, want: int64(12)},
+		{in: json.Number("12.0"), typ: typeLong, want: int64(12)},
+		{in: json.Number("12.5"), typ: typeLong, wantErr: true},
+		{in: "42", typ: typeLong, want: int64(42)},
+		{in: "x", typ: typeLong, wantErr: true},
+		{in: true, typ: typeLong, wantErr: true},
+		{in: json.Number("12"), typ: typeDouble, want: float64(12)},
+		{in: " 1.5", typ: typeDouble, want: 1.5},
+		{in: int64(3), typ: typeDouble, want: float64(3)},
+		{in: json.Number("12"), typ: typeString, want: "12"},
+		{in: true, typ: typeString, want: "true"},
+		{in: 1.5, typ: typeString, want: "1.5"},
+		{in: "true", typ: typeBoolean, want: true},
+		{in: json.Number("0"), typ: typeBoolean, want: false},
+		{in: json.Number("2"), typ: typeBoolean, wantErr: true},
+		{in: "x", typ: "FLOAT", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := convertValue(c.in, c.typ)
+		if (err != nil) != c.wantErr {
+			t.Errorf("convertValue(%v, %s): unexpected error: %v", c.in, c.typ, err)
+			continue
+		}
+		if !c.wantErr && got != c.want {
+			t.Errorf("convertValue(%v, %s): got %v (%T), want %v (%T)", c.in, c.typ, got, got, c.want, c.want)
+		}
+	}
+}
+
+func TestConvertRow(t *testing.T) {
+	row := dataRow{"time": json.Number("1000"), "temp": json.Number("21"), "old": "x"}
+	got, err := convertRow(row, map[string]string{"temp": typeDouble, "new": typeLong})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(got) != "map[temp:21 time:1000]" {
+		t.Errorf("unexpected row: %v", got)
+	}
+	if _, ok := got["temp"].(float64); !ok {
+		t.Errorf("temp was not converted to float64: %T", got["temp"])
+	}
+
+	if _, err := convertRow(dataRow{"temp": json.Number("1")}, nil); err == nil {
+		t.Errorf("expected error for row without time")
+	}
+}
+
+func TestRowsTable(t *testing.T) {
+	rows := []dataRow{
+		{"time": int64(1), "b": 2, "a": 1},
+		{"time": int64(2), "c": 3},
+	}
+	table := rowsTable(rows)
+	if fmt.Sprint(table.Fields) != "[time a b c]" {
+		t.Errorf("unexpected fields: %v", table.Fields)
+	}
+	if fmt.Sprint(table.Values) != "[[1 1 2 <nil>] [2 <nil> <nil> 3]]" {
+		t.Errorf("unexpected values: %v", table.Values)
+	}
+}
+
+// dataStubHandler serves rows at the given times (in ms) from /v1/data, and
+// records the time ranges it was queried for.
+func dataStubHandler(times []int64, queries *[]string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/data/input/", func(w http.ResponseWriter, r *http.Request) {
+		timeRange := r.URL.Query().Get("time")
+		*queries = append(*queries, timeRange)
+		parts := strings.Split(timeRange, ",")
+		from, _ := strconv.ParseInt(parts[0], 10, 64)
+		to, _ := strconv.ParseInt(parts[1], 10, 64)
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		var values []string
+		for _, t := range times {
+			if t >= from && t <= to && len(values) < limit {
+				values = append(values, fmt.Sprintf("[%d, %d]", t, t/1000))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"result": [{"fields": ["time", "n"], "values": [%s]}]}`, strings.Join(values, ","))
+	})
+	return mux
+}
+
+func TestDataStream(t *testing.T) {
+	base := time.Unix(0, 0)
+	// Three rows close together make the first window too big for a limit of 2.
+	times := []int64{1000, 2000, 3000, 50000}
+	var queries []string
+	ctx := newTestContext(t, dataStubHandler(times, &queries))
+	stream := &dataStream{
+		projectId: 1,
+		namespace: "input",
+		from:      base,
+		to:        base.Add(60 * time.Second),
+		window:    60 * time.Second,
+		limit:     3,
+	}
+
+	var got []string
+	var ends []int64
+	err := stream.run(ctx, func(rows []dataRow, end time.Time) error {
+		for _, row := range rows {
+			got = append(got, fmt.Sprint(row[fieldTime]))
+		}
+		ends = append(ends, millis(end))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(got) != "[1000 2000 3000 50000]" {
+		t.Errorf("got rows at %v", got)
+	}
+	if ends[len(ends)-1] != 60000 {
+		t.Errorf("stream did not end at 60000: %v", ends)
+	}
+	if queries[0] != "0,59999" || queries[1] != "0,29999" {
+		t.Errorf("expected the first window to be split, queries: %v", queries)
+	}
+}
@@ -0,0 +1,256 @@
+package command
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultDeviceWorkers = 4
+
+	bulkCreated = "created"
+	bulkExists  = "exists"
+	bulkFailed  = "failed"
+)
+
+// deviceCsvColumns are the columns of a device CSV file, in the order used
+// when the file has no header row.
+var deviceCsvColumns = []string{"id", "name", "type"}
+
+// deviceRow is a device read from line of a CSV file.
+type deviceRow struct {
+	line   int
+	device deviceData
+}
+
+// bulkResult is the outcome of creating the device of row. For devices that
+// were created or already existed, row.device.DeviceId is set.
+type bulkResult struct {
+	row    deviceRow
+	status string
+	err    error
+}
+
+// parseDeviceCsv reads devices from a CSV file with the columns id, name
+// and type. A header row naming the columns may give them in another order
+// or leave some out. Empty IDs are assigned by the server.
+func parseDeviceCsv(r io.Reader) ([]deviceRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	columns := deviceCsvColumns
+	var rows []deviceRow
+	ids := make(map[string]int)
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if first && isDeviceCsvHeader(record) {
+			columns = make([]string, len(record))
+			for i, name := range record {
+				columns[i] = strings.ToLower(strings.TrimSpace(name))
+			}
+			continue
+		}
+
+		if len(record) > len(columns) {
+			return nil, fmt.Errorf("Line %d has %d columns, expected at most %d (%s).",
+				line, len(record), len(columns), strings.Join(columns, ", "))
+		}
+		row := deviceRow{line: line}
+		for j, value := range record {
+			value = strings.TrimSpace(value)
+			switch columns[j] {
+			case "id":
+				row.device.DeviceId = value
+			case "name":
+				row.device.DeviceName = value
+			case "type":
+				row.device.DeviceType = value
+			}
+		}
+		d := &row.device
+		if len(d.DeviceId) == 0 && len(d.DeviceName) == 0 && len(d.DeviceType) == 0 {
+			continue
+		}
+		if len(d.DeviceId) > 0 {
+			if other, ok := ids[d.DeviceId]; ok {
+				return nil, fmt.Errorf("Device ID '%s' is on both line %d and line %d.", d.DeviceId, other, line)
+			}
+			ids[d.DeviceId] = line
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func isDeviceCsvHeader(record []string) bool {
+	for _, cell := range record {
+		if !isInList(strings.ToLower(strings.TrimSpace(cell)), deviceCsvColumns) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitExistingDevices returns the rows that need to be created, and results
+// for those that already exist in existing. A row without an ID exists if a
+// device has its name, so that running the same file again creates nothing.
+func splitExistingDevices(rows []deviceRow, existing []deviceData) ([]deviceRow, []bulkResult) {
+	byId := make(map[string]bool)
+	byName := make(map[string]string)
+	for _, d := range existing {
+		byId[d.DeviceId] = true
+		if len(d.DeviceName) > 0 {
+			byName[d.DeviceName] = d.DeviceId
+		}
+	}
+
+	var create []deviceRow
+	var exists []bulkResult
+	for _, row := range rows {
+		d := &row.device
+		if len(d.DeviceId) == 0 && len(d.DeviceName) > 0 {
+			if id, ok := byName[d.DeviceName]; ok {
+				d.DeviceId = id
+			}
+		}
+		if byId[d.DeviceId] {
+			exists = append(exists, bulkResult{row: row, status: bulkExists})
+		} else {
+			create = append(create, row)
+		}
+	}
+	return create, exists
+}
+
+// createDeviceRows creates the devices of rows in project projectId using
+// workers goroutines.
+func createDeviceRows(ctx *Context, projectId uint64, rows []deviceRow, workers int) []bulkResult {
+	jobs := make(chan deviceRow)
+	var mu sync.Mutex
+	var results []bulkResult
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range jobs {
+				row.device.ProjectId = projectId
+				result := bulkResult{row: row, status: bulkCreated}
+				created, err := _postDevice(ctx, &row.device)
+				if err != nil {
+					result.status = bulkFailed
+					result.err = err
+				} else {
+					result.row.device.DeviceId = created.DeviceId
+				}
+				mu.Lock()
+				results = append(results, result)
+				if err != nil {
+					fmt.Printf("Line %d: could not create device: %v\n", row.line, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, row := range rows {
+		jobs <- row
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func _postDevice(ctx *Context, device *deviceData) (*deviceData, error) {
+	created := new(deviceData)
+	_, err := ctx.Client.
+		Post("/v1/devices").
+		Expect(201).
+		ProjectToken(ctx.Profile, device.ProjectId).
+		Body(device).
+		ResponseBody(created).
+		Execute()
+	return created, err
+}
+
+func sortBulkResults(results []bulkResult) {
+	sort.Slice(results, func(i, j int) bool { return results[i].row.line < results[j].row.line })
+}
+
+// bulkSummary counts results by status.
+func bulkSummary(results []bulkResult) string {
+	counts := make(map[string]int)
+	for _, r := range results {
+		counts[r.status]++
+	}
+	return fmt.Sprintf("%d created, %d already existed, %d failed", counts[bulkCreated], counts[bulkExists], counts[bulkFailed])
+}
+
+// writeDeviceCsv writes results as CSV with a header row, in the order of
+// the input file.
+func writeDeviceCsv(w io.Writer, results []bulkResult) error {
+	writer := csv.NewWriter(w)
+	writer.Write(append(append([]string{}, deviceCsvColumns...), "status"))
+	for _, r := range results {
+		d := r.row.device
+		writer.Write([]string{d.DeviceId, d.DeviceName, d.DeviceType, r.status})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func createDevicesFromFile(ctx *Context, data *deviceData) error {
+	f, err := os.Open(data.file)
+	if err != nil {
+		return err
+	}
+	rows, err := parseDeviceCsv(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("Invalid device file '%s': %v", data.file, err)
+	}
+
+	existing, err := _getDevices(ctx, data.ProjectId)
+	if err != nil {
+		return err
+	}
+	create, results := splitExistingDevices(rows, existing)
+	fmt.Printf("%d devices in '%s', %d to create.\n", len(rows), data.file, len(create))
+	results = append(results, createDeviceRows(ctx, data.ProjectId, create, data.workers)...)
+	sortBulkResults(results)
+
+	if len(data.out) > 0 {
+		out, err := os.Create(data.out)
+		if err != nil {
+			return err
+		}
+		err = writeDeviceCsv(out, results)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Device IDs written to '%s'.\n", data.out)
+	}
+
+	fmt.Printf("Devices: %s.\n", bulkSummary(results))
+	for _, r := range results {
+		if r.status == bulkFailed {
+			return fmt.Errorf("Some devices could not be created; run the same command again to retry them.")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDeviceDataIsValidWithFile(t *testing.T) {
+	cases := []dataTestCase{
+		{desc: "valid, file", in: &deviceData{ProjectId: 1, file: "d.csv", workers: 4}, want: true},
+		{desc: "valid, file and out", in: &deviceData{ProjectId: 1, file: "d.csv", out: "ids.csv", workers: 4}, want: true},
+		{desc: "invalid, file and id", in: &deviceData{ProjectId: 1, file: "d.csv", DeviceId: "x", workers: 4}, want: false},
+		{desc: "invalid, no workers", in: &deviceData{ProjectId: 1, file: "d.csv"}, want: false},
+		{desc: "invalid, out without file", in: &deviceData{ProjectId: 1, out: "ids.csv"}, want: false},
+	}
+	runDataTestCase(t, cases)
+}
+
+func deviceRowsString(rows []deviceRow) string {
+	var parts []string
+	for _, r := range rows {
+		parts = append(parts, fmt.Sprintf("%d:%s/%s/%s", r.line, r.device.DeviceId, r.device.DeviceName, r.device.DeviceType))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestParseDeviceCsv(t *testing.T) {
+	cases := []struct {
+		desc    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{
+			desc: "no header",
+			in:   "dev-a,kitchen,sensor\n,hall\n",
+			want: "1:dev-a/kitchen/sensor 2:/hall/",
+		},
+		{
+			desc: "header in other order",
+			in:   "name, ID\nkitchen, dev-a\n\nhall,\n",
+			want: "2:dev-a/kitchen/ 4:/hall/",
+		},
+		{
+			desc: "empty rows skipped",
+			in:   "id,name,type\n,,\ndev-a,,\n",
+			want: "3:dev-a//",
+		},
+		{
+			desc:    "too many columns",
+			in:      "dev-a,kitchen,sensor,extra\n",
+			wantErr: true,
+		},
+		{
+			desc:    "duplicate id",
+			in:      "dev-a,kitchen\ndev-a,hall\n",
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		rows, err := parseDeviceCsv(strings.NewReader(c.in))
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		if got := deviceRowsString(rows); !c.wantErr && got != c.want {
+			t.Errorf("%s: got '%s', want '%s'", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestSplitExistingDevices(t *testing.T) {
+	rows := []deviceRow{
+		{line: 1, device: deviceData{DeviceId: "dev-a"}},
+		{line: 2, device: deviceData{DeviceName: "hall"}},
+		{line: 3, device: deviceData{DeviceName: "garage"}},
+		{line: 4, device: deviceData{DeviceId: "dev-d"}},
+	}
+	existing := []deviceData{{DeviceId: "dev-a"}, {DeviceId: "dev-h", DeviceName: "hall"}}
+
+	create, exists := splitExistingDevices(rows, existing)
+	if got := deviceRowsString(create); got != "3:/garage/ 4:dev-d//" {
+		t.Errorf("unexpected rows to create: %s", got)
+	}
+	if len(exists) != 2 || exists[1].row.device.DeviceId != "dev-h" || exists[1].status != bulkExists {
+		t.Errorf("unexpected existing results: %+v", exists)
+	}
+}
+
+func TestCreateDeviceRows(t *testing.T) {
+	var mu sync.Mutex
+	assigned := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/devices", func(w http.ResponseWriter, r *http.Request) {
+		var d deviceData
+		json.NewDecoder(r.Body).Decode(&d)
+		if d.DeviceId == "taken" {
+			w.WriteHeader(409)
+			return
+		}
+		if len(d.DeviceId) == 0 {
+			mu.Lock()
+			assigned++
+			d.DeviceId = fmt.Sprintf("assigned-%d", assigned)
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		json.NewEncoder(w).Encode(d)
+	})
+	ctx := newTestContext(t, mux)
+
+	rows := []deviceRow{
+		{line: 1, device: deviceData{DeviceId: "dev-a", DeviceName: "kitchen"}},
+		{line: 2, device: deviceData{DeviceName: "hall", DeviceType: "sensor"}},
+		{line: 3, device: deviceData{DeviceId: "taken"}},
+	}
+	results := createDeviceRows(ctx, 1, rows, 2)
+	results = append(results, bulkResult{row: deviceRow{line: 4, device: deviceData{DeviceId: "dev-e"}}, status: bulkExists})
+	sortBulkResults(results)
+
+	if got := bulkSummary(results); got != "2 created, 1 already existed, 1 failed" {
+		t.Errorf("unexpected summary: %s", got)
+	}
+	if results[2].err == nil {
+		t.Errorf("expected an error for the taken device ID")
+	}
+
+	var buf bytes.Buffer
+	if err := writeDeviceCsv(&buf, results); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "id,name,type,status\n" +
+		"dev-a,kitchen,,created\n" +
+		"assigned-1,hall,sensor,created\n" +
+		"taken,,,failed\n" +
+		"dev-e,,,exists\n"
+	if buf.String() != want {
+		t.Errorf("got CSV\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,271 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/iobeam/iobeam/client"
+)
+
+const (
+	provisionFormatJson   = "json"
+	provisionFormatEnv    = "env"
+	provisionFormatHeader = "header"
+)
+
+var provisionFormats = []string{provisionFormatJson, provisionFormatEnv, provisionFormatHeader}
+
+// provisionTemplates are the built-in templates for the device config, by
+// format. The token can be exchanged for a new one before it expires by
+// posting it as refresh_token to /v1/tokens/project.
+var provisionTemplates = map[string]string{
+	provisionFormatJson: `{
+  "project_id": {{.ProjectId}},
+  "device_id": {{json .DeviceId}},
+  "api_server": {{json .Server}},
+  "token": {{json .Token}},
+  "token_expires": {{json .TokenExpires}}
+}
+`,
+	provisionFormatEnv: `IOBEAM_PROJECT_ID={{.ProjectId}}
+IOBEAM_DEVICE_ID={{env .DeviceId}}
+IOBEAM_API_SERVER={{env .Server}}
+IOBEAM_TOKEN={{env .Token}}
+IOBEAM_TOKEN_EXPIRES={{env .TokenExpires}}
+`,
+	provisionFormatHeader: `/* iobeam device configuration. Contains a project token, keep it secret. */
+#ifndef IOBEAM_DEVICE_CONFIG_H
+#define IOBEAM_DEVICE_CONFIG_H
+
+#define IOBEAM_PROJECT_ID {{.ProjectId}}ULL
+#define IOBEAM_DEVICE_ID {{quote .DeviceId}}
+#define IOBEAM_API_SERVER {{quote .Server}}
+#define IOBEAM_TOKEN {{quote .Token}}
+#define IOBEAM_TOKEN_EXPIRES {{quote .TokenExpires}}
+
+#endif /* IOBEAM_DEVICE_CONFIG_H */
+`,
+}
+
+// provisionConfig is everything a device needs to send data, and the data
+// available to config templates.
+type provisionConfig struct {
+	ProjectId    uint64
+	DeviceId     string
+	DeviceName   string
+	DeviceType   string
+	Server       string
+	Token        string
+	TokenExpires string
+}
+
+// provisionFuncs are the functions available to config templates for
+// writing values safely in each format.
+var provisionFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"quote": strconv.Quote,
+	"env":   envQuote,
+}
+
+// envQuote returns s as the value of an env file line, single-quoted if it
+// has characters a shell would interpret.
+func envQuote(s string) string {
+	safe := len(s) > 0
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_-.:/@+=,", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// detectProvisionFormat returns the config format for a file based on its
+// extension, or "" if it is not known.
+func detectProvisionFormat(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".json"):
+		return provisionFormatJson
+	case strings.HasSuffix(lower, ".env"):
+		return provisionFormatEnv
+	case strings.HasSuffix(lower, ".h"):
+		return provisionFormatHeader
+	}
+	return ""
+}
+
+// renderProvisionConfig executes the template text with config.
+func renderProvisionConfig(text string, config *provisionConfig) ([]byte, error) {
+	tmpl, err := template.New("config").Funcs(provisionFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, config); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type provisionDeviceArgs struct {
+	projectId  uint64
+	id         string
+	name       string
+	deviceType string
+	out        string
+	format     string
+	template   string
+}
+
+func (a *provisionDeviceArgs) IsValid() bool {
+	formatOk := len(a.format) == 0 || isInList(a.format, provisionFormats)
+	return a.projectId != 0 && (len(a.id) > 0 || len(a.name) > 0) && len(a.out) > 0 && formatOk
+}
+
+func newProvisionDeviceCmd(ctx *Context) *Command {
+	args := new(provisionDeviceArgs)
+
+	cmd := &Command{
+		Name: "provision",
+		Usage: "Create a device if it does not exist and write a config file for it, " +
+			"with a write-only project token.",
+		Data:   args,
+		Action: provisionDevice,
+	}
+	flags := cmd.NewFlagSet("iobeam device provision")
+	flags.StringVar(&args.id, "id", "", "Device ID to provision (this or -name is required)")
+	flags.StringVar(&args.name, "name", "", "Device name, used to find or create the device (this or -id is required)")
+	flags.StringVar(&args.deviceType, "type", "", "Device type, if the device is created")
+	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject,
+		"Project ID of the device (defaults to active project)")
+	flags.StringVar(&args.out, "out", "", "File to write the device config to (REQUIRED)")
+	flags.StringVar(&args.format, "format", "", "Format of the config: "+strings.Join(provisionFormats, ", ")+
+		" (detected from the -out extension by default)")
+	flags.StringVar(&args.template, "template", "", "Go text/template file to render instead of a built-in format. "+
+		"It can use .ProjectId, .DeviceId, .DeviceName, .DeviceType, .Server, .Token and .TokenExpires, "+
+		"and the functions json, quote and env to escape values.")
+
+	return cmd
+}
+
+// findDevice returns the device in devices with the ID id, or if id is
+// empty, with the name name.
+func findDevice(devices []deviceData, id, name string) *deviceData {
+	for i := range devices {
+		d := &devices[i]
+		if (len(id) > 0 && d.DeviceId == id) || (len(id) == 0 && d.DeviceName == name) {
+			return d
+		}
+	}
+	return nil
+}
+
+// _getWriteToken gets a write-only token for project projectId. Unlike
+// 'token project' it does not save the token, so the one in the profile
+// is left alone.
+func _getWriteToken(ctx *Context, projectId uint64) (*client.AuthToken, error) {
+	token := new(client.AuthToken)
+	_, err := ctx.Client.
+		Get("/v1/tokens/project").
+		ParamUint64("project_id", projectId).
+		ParamBool("read", false).
+		ParamBool("write", true).
+		ParamBool("admin", false).
+		ParamBool("include_user", false).
+		UserToken(ctx.Profile).
+		Expect(200).
+		ResponseBody(token).
+		Execute()
+	return token, err
+}
+
+// provisionConfigFor finds or creates the device of args and gets a token
+// for it.
+func provisionConfigFor(ctx *Context, args *provisionDeviceArgs) (*provisionConfig, error) {
+	devices, err := _getDevices(ctx, args.projectId)
+	if err != nil {
+		return nil, err
+	}
+	device := findDevice(devices, args.id, args.name)
+	if device != nil {
+		fmt.Printf("Device '%s' already exists.\n", device.DeviceId)
+	} else {
+		device, err = _postDevice(ctx, &deviceData{
+			ProjectId:  args.projectId,
+			DeviceId:   args.id,
+			DeviceName: args.name,
+			DeviceType: args.deviceType,
+		})
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Device '%s' created.\n", device.DeviceId)
+	}
+
+	token, err := _getWriteToken(ctx, args.projectId)
+	if err != nil {
+		return nil, err
+	}
+	return &provisionConfig{
+		ProjectId:    args.projectId,
+		DeviceId:     device.DeviceId,
+		DeviceName:   device.DeviceName,
+		DeviceType:   device.DeviceType,
+		Server:       ctx.Profile.Server,
+		Token:        token.Token,
+		TokenExpires: token.Expires,
+	}, nil
+}
+
+func provisionDevice(c *Command, ctx *Context) error {
+	args := c.Data.(*provisionDeviceArgs)
+
+	// Settle on the template before touching the project.
+	var text string
+	if len(args.template) > 0 {
+		b, err := ioutil.ReadFile(args.template)
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	} else {
+		format := args.format
+		if len(format) == 0 {
+			format = detectProvisionFormat(args.out)
+		}
+		if len(format) == 0 {
+			return fmt.Errorf("Cannot tell the format of '%s', use -format or -template.", args.out)
+		}
+		text = provisionTemplates[format]
+	}
+	if _, err := renderProvisionConfig(text, &provisionConfig{}); err != nil {
+		return fmt.Errorf("Invalid template: %v", err)
+	}
+
+	config, err := provisionConfigFor(ctx, args)
+	if err != nil {
+		return err
+	}
+	out, err := renderProvisionConfig(text, config)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(args.out, out, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("Config for device '%s' written to '%s'.\n", config.DeviceId, args.out)
+	fmt.Printf("It contains a write-only project token that expires %s; keep the file secret.\n", config.TokenExpires)
+	return nil
+}
@@ -0,0 +1,127 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProvisionDeviceArgsValidity(t *testing.T) {
+	cases := []dataTestCase{
+		{desc: "valid, id", in: &provisionDeviceArgs{projectId: 1, id: "dev-a", out: "d.json"}, want: true},
+		{desc: "valid, name and format", in: &provisionDeviceArgs{projectId: 1, name: "kitchen", out: "d.cfg", format: provisionFormatEnv}, want: true},
+		{desc: "invalid, no device", in: &provisionDeviceArgs{projectId: 1, out: "d.json"}, want: false},
+		{desc: "invalid, no out", in: &provisionDeviceArgs{projectId: 1, id: "dev-a"}, want: false},
+		{desc: "invalid, bad format", in: &provisionDeviceArgs{projectId: 1, id: "dev-a", out: "d.json", format: "xml"}, want: false},
+	}
+	runDataTestCase(t, cases)
+}
+
+func TestEnvQuote(t *testing.T) {
+	cases := map[string]string{
+		"dev-a":                  "dev-a",
+		"https://api.iobeam.com": "https://api.iobeam.com",
+		"":                       "''",
+		"2016-01-02 15:04:05":    "'2016-01-02 15:04:05'",
+		"it's $HOME":             `'it'\''s $HOME'`,
+	}
+	for in, want := range cases {
+		if got := envQuote(in); got != want {
+			t.Errorf("envQuote(%q): got %s, want %s", in, got, want)
+		}
+	}
+}
+
+func testProvisionConfig() *provisionConfig {
+	return &provisionConfig{
+		ProjectId:    1,
+		DeviceId:     `dev "a"`,
+		Server:       "https://api.iobeam.com",
+		Token:        "abc.def",
+		TokenExpires: "2016-01-02 15:04:05 +0000",
+	}
+}
+
+func TestRenderProvisionConfig(t *testing.T) {
+	cfg := testProvisionConfig()
+
+	out, err := renderProvisionConfig(provisionTemplates[provisionFormatJson], cfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if parsed["device_id"] != `dev "a"` || parsed["project_id"] != 1.0 || parsed["token"] != "abc.def" {
+		t.Errorf("unexpected JSON config: %v", parsed)
+	}
+
+	want := "IOBEAM_PROJECT_ID=1\n" +
+		"IOBEAM_DEVICE_ID='dev \"a\"'\n" +
+		"IOBEAM_API_SERVER=https://api.iobeam.com\n" +
+		"IOBEAM_TOKEN=abc.def\n" +
+		"IOBEAM_TOKEN_EXPIRES='2016-01-02 15:04:05 +0000'\n"
+	if out, _ := renderProvisionConfig(provisionTemplates[provisionFormatEnv], cfg); string(out) != want {
+		t.Errorf("got env config\n%s\nwant\n%s", out, want)
+	}
+
+	out, _ = renderProvisionConfig(provisionTemplates[provisionFormatHeader], cfg)
+	if !strings.Contains(string(out), `#define IOBEAM_DEVICE_ID "dev \"a\""`) ||
+		!strings.Contains(string(out), "#define IOBEAM_PROJECT_ID 1ULL") {
+		t.Errorf("unexpected header config:\n%s", out)
+	}
+
+	if _, err := renderProvisionConfig("{{.Secret}}", cfg); err == nil {
+		t.Errorf("expected error for unknown template field")
+	}
+}
+
+func TestProvisionConfigFor(t *testing.T) {
+	var created []deviceData
+	var tokenQuery string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/devices", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "POST" {
+			var d deviceData
+			json.NewDecoder(r.Body).Decode(&d)
+			created = append(created, d)
+			w.WriteHeader(201)
+			json.NewEncoder(w).Encode(d)
+			return
+		}
+		fmt.Fprint(w, `{"devices": [{"project_id": 1, "device_id": "dev-a", "device_name": "kitchen"}]}`)
+	})
+	mux.HandleFunc("/v1/tokens/project", func(w http.ResponseWriter, r *http.Request) {
+		tokenQuery = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"token": "abc.def", "expires": "2016-01-02 15:04:05 +0000", "project_id": 1, "write": true}`)
+	})
+	ctx := newTestContext(t, mux)
+	ctx.Profile.Server = "https://api.iobeam.com"
+
+	cfg, err := provisionConfigFor(ctx, &provisionDeviceArgs{projectId: 1, name: "kitchen"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(created) != 0 || cfg.DeviceId != "dev-a" {
+		t.Errorf("expected existing device dev-a to be used, created %+v", created)
+	}
+	if cfg.Token != "abc.def" || cfg.Server != "https://api.iobeam.com" {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if tokenQuery != "admin=false&include_user=false&project_id=1&read=false&write=true" {
+		t.Errorf("unexpected token request: %s", tokenQuery)
+	}
+
+	cfg, err = provisionConfigFor(ctx, &provisionDeviceArgs{projectId: 1, id: "dev-b", deviceType: "sensor"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(created) != 1 || created[0].DeviceId != "dev-b" || created[0].DeviceType != "sensor" || cfg.DeviceId != "dev-b" {
+		t.Errorf("expected dev-b to be created, created %+v, config %+v", created, cfg)
+	}
+}
@@ -1,11 +1,15 @@
 package command
 
 import (
+	"encoding/csv"
 	"fmt"
+	"io"
+	"os"
+	"path"
 	"sort"
 	"strings"
-
-	"github.com/iobeam/iobeam/client"
+	"text/tabwriter"
+	"time"
 )
 
 type deviceData struct {
@@ -16,6 +20,11 @@ type deviceData struct {
 	Created    string `json:"created,omitempty"`
 	// Private fields, not marshalled into JSON
 	isUpdate bool
+	// file is a CSV file of devices to create, with out the file to write
+	// their IDs to and workers the number of devices created at once.
+	file    string
+	out     string
+	workers int
 }
 
 func (d *deviceData) IsValid() bool {
@@ -23,7 +32,11 @@ func (d *deviceData) IsValid() bool {
 		return len(d.DeviceId) > 0 &&
 			(len(d.DeviceName) > 0 || len(d.DeviceType) > 0)
 	}
-	return d.ProjectId != 0
+	if len(d.file) > 0 {
+		return d.ProjectId != 0 && d.workers > 0 &&
+			len(d.DeviceId) == 0 && len(d.DeviceName) == 0 && len(d.DeviceType) == 0
+	}
+	return d.ProjectId != 0 && len(d.out) == 0
 }
 
 func (d *deviceData) Print() {
@@ -53,11 +66,12 @@ func NewDevicesCommand(ctx *Context) *Command {
 		Name:  "device",
 		Usage: "Commands for managing devices.",
 		SubCommands: Mux{
-			"create": newCreateDeviceCmd(ctx),
-			"delete": newDeleteDeviceCmd(ctx),
-			"get":    newGetDeviceCmd(ctx),
-			"list":   newListDevicesCmd(ctx),
-			"update": newUpdateDeviceCmd(ctx),
+			"create":    newCreateDeviceCmd(ctx),
+			"delete":    newDeleteDeviceCmd(ctx),
+			"get":       newGetDeviceCmd(ctx),
+			"list":      newListDevicesCmd(ctx),
+			"provision": newProvisionDeviceCmd(ctx),
+			"update":    newUpdateDeviceCmd(ctx),
 		},
 	}
 	cmd.NewFlagSet("iobeam device")
@@ -88,6 +102,12 @@ func newCreateOrUpdateDeviceCmd(ctx *Context, update bool, name string, action A
 	flags.StringVar(&device.DeviceName, "name", "", "The device name")
 	flags.StringVar(&device.DeviceType, "type", "", "The type of device")
 	flags.Uint64Var(&device.ProjectId, "projectId", ctx.Profile.ActiveProject, "Project ID associated with the device (if omitted, defaults to active project).")
+	if !update {
+		flags.StringVar(&device.file, "file", "", "CSV file with columns id, name and type to create many devices at once. "+
+			"Devices that already exist are skipped.")
+		flags.StringVar(&device.out, "out", "", "With -file, write a CSV of the devices with their IDs, including server-assigned ones, to this file.")
+		flags.IntVar(&device.workers, "workers", defaultDeviceWorkers, "With -file, number of devices to create at the same time.")
+	}
 
 	return cmd
 }
@@ -102,6 +122,9 @@ func newUpdateDeviceCmd(ctx *Context) *Command {
 
 func createDevice(c *Command, ctx *Context) error {
 	data := c.Data.(*deviceData)
+	if len(data.file) > 0 {
+		return createDevicesFromFile(ctx, data)
+	}
 	_, err := ctx.Client.
 		Post(c.ApiPath).
 		Expect(201).
@@ -134,6 +157,7 @@ func updateDevice(c *Command, ctx *Context) error {
 		Execute()
 
 	if err == nil {
+		ctx.forgetNames(kindDevice)
 		fmt.Println("Device successfully updated")
 	} else if rsp.Http().StatusCode == 204 {
 		fmt.Println("Device not modified")
@@ -164,15 +188,13 @@ func newGetDeviceCmd(ctx *Context) *Command {
 
 func getDevice(c *Command, ctx *Context) error {
 	data := c.Data.(*baseDeviceArgs)
-	var req *client.Request
-	if len(data.id) > 0 {
-		req = ctx.Client.Get(c.ApiPath + "/" + data.id)
-	} else {
-		req = ctx.Client.Get(c.ApiPath).Param("name", data.name)
+	if err := data.resolve(ctx); err != nil {
+		return err
 	}
 
 	device := new(deviceData)
-	_, err := req.Expect(200).
+	_, err := ctx.Client.Get(c.ApiPath+"/"+data.id).
+		Expect(200).
 		ProjectToken(ctx.Profile, data.projectId).
 		ResponseBody(device).
 		ResponseBodyHandler(func(body interface{}) error {
@@ -184,6 +206,24 @@ func getDevice(c *Command, ctx *Context) error {
 	return err
 }
 
+// resolve looks up the ID of the device when it was selected by name.
+func (d *baseDeviceArgs) resolve(ctx *Context) error {
+	if len(d.id) > 0 {
+		return nil
+	}
+
+	var err error
+	d.id, err = resolveName(ctx, kindDevice, d.projectId, d.name, func() ([]resourceRef, error) {
+		devices, err := _getDevices(ctx, d.projectId)
+		refs := make([]resourceRef, len(devices))
+		for i, device := range devices {
+			refs[i] = resourceRef{id: device.DeviceId, name: device.DeviceName}
+		}
+		return refs, err
+	})
+	return err
+}
+
 const (
 	orderName        = "name"
 	orderNameReverse = orderName + "-r"
@@ -191,20 +231,34 @@ const (
 	orderIdReverse   = orderId + "-r"
 	orderDate        = "date"
 	orderDateReverse = orderDate + "-r"
+
+	// devicePageSize is the number of devices fetched per request.
+	devicePageSize = 1000
 )
 
 var orders = []string{orderName, orderNameReverse, orderId, orderIdReverse,
 	orderDate, orderDateReverse}
 
+var deviceListOutputs = []string{outputTable, outputCsv, outputJson}
+
 type listData struct {
-	projectId uint64
-	order     string
+	projectId     uint64
+	order         string
+	deviceType    string
+	name          string
+	createdAfter  string
+	createdBefore string
+	limit         int
+	page          int
+	output        string
 }
 
 func (d *listData) IsValid() bool {
 	pidOk := d.projectId > 0
 	orderOk := isInList(d.order, orders)
-	return pidOk && orderOk
+	_, err := d.filter(time.Now())
+	pageOk := d.limit >= 0 && d.page > 0
+	return pidOk && orderOk && err == nil && pageOk && isInList(d.output, deviceListOutputs)
 }
 
 func newListDevicesCmd(ctx *Context) *Command {
@@ -222,10 +276,100 @@ func newListDevicesCmd(ctx *Context) *Command {
 		"Project ID to get devices from (if omitted, defaults to active project)")
 	flags.StringVar(&data.order, "order", orderDate,
 		"Sort order for results. Valid values: date(-r), id(-r), name(-r). Values ending with -r are reverse ordering.")
+	flags.StringVar(&data.deviceType, "type", "", "Only list devices of this type.")
+	flags.StringVar(&data.name, "name", "", "Only list devices with names matching this pattern (ex. 'kitchen-*').")
+	flags.StringVar(&data.createdAfter, "createdAfter", "",
+		"Only list devices created after this time, a timestamp (ex. 2016-01-02T15:04:05Z) or a duration before now (ex. 24h).")
+	flags.StringVar(&data.createdBefore, "createdBefore", "",
+		"Only list devices created before this time, a timestamp or a duration before now.")
+	flags.IntVar(&data.limit, "limit", 0, "Number of devices per page (0 lists all of them). "+
+		"Paging is done locally, after all devices are fetched and filtered.")
+	flags.IntVar(&data.page, "page", 1, "With -limit, the page of results to list.")
+	flags.StringVar(&data.output, "output", outputTable, "Output format: table, csv or json.")
 
 	return cmd
 }
 
+// deviceFilter selects devices by type, name pattern and creation time.
+// Empty fields and zero times match every device.
+type deviceFilter struct {
+	deviceType string
+	name       string
+	after      time.Time
+	before     time.Time
+}
+
+// filter returns the device filter of the list arguments, relative to now.
+func (d *listData) filter(now time.Time) (*deviceFilter, error) {
+	f := &deviceFilter{deviceType: d.deviceType, name: d.name}
+	if _, err := path.Match(d.name, ""); err != nil {
+		return nil, fmt.Errorf("Invalid name pattern '%s': %v", d.name, err)
+	}
+	var err error
+	if len(d.createdAfter) > 0 {
+		if f.after, err = parseTimeArg(d.createdAfter, now); err != nil {
+			return nil, err
+		}
+	}
+	if len(d.createdBefore) > 0 {
+		if f.before, err = parseTimeArg(d.createdBefore, now); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (f *deviceFilter) match(d *deviceData) (bool, error) {
+	if len(f.deviceType) > 0 && d.DeviceType != f.deviceType {
+		return false, nil
+	}
+	if len(f.name) > 0 {
+		if ok, _ := path.Match(f.name, d.DeviceName); !ok {
+			return false, nil
+		}
+	}
+	if f.after.IsZero() && f.before.IsZero() {
+		return true, nil
+	}
+	created, ok := parseCreated(d.Created)
+	if !ok {
+		return false, fmt.Errorf("Cannot tell when device '%s' was created ('%s').", d.DeviceId, d.Created)
+	}
+	return (f.after.IsZero() || created.After(f.after)) && (f.before.IsZero() || created.Before(f.before)), nil
+}
+
+// filterDevices returns the devices that match f.
+func filterDevices(devices []deviceData, f *deviceFilter) ([]deviceData, error) {
+	var matched []deviceData
+	for i := range devices {
+		ok, err := f.match(&devices[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, devices[i])
+		}
+	}
+	return matched, nil
+}
+
+// pageDevices returns page (starting at 1) of devices with limit devices per
+// page, or all of them if limit is 0.
+func pageDevices(devices []deviceData, limit, page int) []deviceData {
+	if limit == 0 {
+		return devices
+	}
+	start := (page - 1) * limit
+	if start >= len(devices) {
+		return nil
+	}
+	end := start + limit
+	if end > len(devices) {
+		end = len(devices)
+	}
+	return devices[start:end]
+}
+
 type deviceSort struct {
 	items []deviceData
 	order string
@@ -242,7 +386,7 @@ func (a deviceSort) Less(i, j int) bool {
 	case orderId:
 		return a.items[i].DeviceId < a.items[j].DeviceId
 	case orderIdReverse:
-		return a.items[i].DeviceId < a.items[j].DeviceId
+		return a.items[j].DeviceId < a.items[i].DeviceId
 	case orderDateReverse:
 		return a.items[j].Created < a.items[i].Created
 	case orderDate:
@@ -253,41 +397,125 @@ func (a deviceSort) Less(i, j int) bool {
 	return false
 }
 
-func listDevices(c *Command, ctx *Context) error {
-	type deviceList struct {
-		Devices []deviceData
+// writeDeviceTable writes devices as a table with a header row.
+func writeDeviceTable(w io.Writer, devices []deviceData) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE ID\tNAME\tTYPE\tCREATED")
+	for _, d := range devices {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d.DeviceId, d.DeviceName, d.DeviceType, d.Created)
 	}
+	return tw.Flush()
+}
 
+// writeDeviceListCsv writes devices as CSV with a header row.
+func writeDeviceListCsv(w io.Writer, devices []deviceData) error {
+	writer := csv.NewWriter(w)
+	writer.Write(append(append([]string{}, deviceCsvColumns...), "created"))
+	for _, d := range devices {
+		writer.Write([]string{d.DeviceId, d.DeviceName, d.DeviceType, d.Created})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func listDevices(c *Command, ctx *Context) error {
 	cmdArgs := c.Data.(*listData)
 	pid := cmdArgs.projectId
 
-	_, err := ctx.Client.
-		Get(c.ApiPath).
-		ParamUint64("project_id", pid).
-		Expect(200).
-		ProjectToken(ctx.Profile, pid).
-		ResponseBody(new(deviceList)).
-		ResponseBodyHandler(func(body interface{}) error {
-
-		list := body.(*deviceList)
+	filter, err := cmdArgs.filter(time.Now())
+	if err != nil {
+		return err
+	}
+	devices, err := _getDevices(ctx, pid)
+	if err != nil {
+		return err
+	}
+	devices, err = filterDevices(devices, filter)
+	if err != nil {
+		return err
+	}
 
-		fmt.Printf("Devices in project %v\n", pid)
-		fmt.Println("-----")
+	sort.Stable(&deviceSort{items: devices, order: cmdArgs.order})
+	page := pageDevices(devices, cmdArgs.limit, cmdArgs.page)
 
-		sorted := &deviceSort{items: list.Devices, order: cmdArgs.order}
-		sort.Sort(sorted)
-		for _, device := range sorted.items {
-			device.Print()
+	switch cmdArgs.output {
+	case outputJson:
+		if page == nil {
+			page = []deviceData{}
 		}
+		return printStructured(page, outputJson)
+	case outputCsv:
+		return writeDeviceListCsv(os.Stdout, page)
+	}
 
+	if len(page) == 0 {
+		fmt.Printf("No devices found in project %v.\n", pid)
 		return nil
-	}).Execute()
+	}
+	if err := writeDeviceTable(os.Stdout, page); err != nil {
+		return err
+	}
+	if cmdArgs.limit > 0 {
+		pages := (len(devices) + cmdArgs.limit - 1) / cmdArgs.limit
+		fmt.Printf("\nPage %d of %d, %d devices in total.\n", cmdArgs.page, pages, len(devices))
+		if cmdArgs.page < pages {
+			fmt.Printf("Use -page %d for the next page.\n", cmdArgs.page+1)
+		}
+	}
 
-	return err
+	return nil
+}
+
+// _getDevices gets all devices of project projectId. It asks for
+// devicePageSize at a time with the limit and offset parameters, which older
+// servers do not have and ignore by returning every device. Paging stops at
+// a page that is not full, or with no new devices, so both kinds of server
+// give the full list.
+func _getDevices(ctx *Context, projectId uint64) ([]deviceData, error) {
+	type deviceList struct {
+		Devices []deviceData
+	}
+
+	var devices []deviceData
+	seen := make(map[string]bool)
+	for {
+		list := new(deviceList)
+		_, err := ctx.Client.
+			Get("/v1/devices").
+			ParamUint64("project_id", projectId).
+			ParamInt("limit", devicePageSize).
+			ParamInt("offset", len(devices)).
+			Expect(200).
+			ProjectToken(ctx.Profile, projectId).
+			ResponseBody(list).
+			ResponseBodyHandler(func(body interface{}) error {
+				return nil
+			}).Execute()
+		if err != nil {
+			return devices, err
+		}
+
+		added := 0
+		for _, d := range list.Devices {
+			if !seen[d.DeviceId] {
+				seen[d.DeviceId] = true
+				devices = append(devices, d)
+				added++
+			}
+		}
+		if added == 0 || len(list.Devices) != devicePageSize {
+			return devices, nil
+		}
+	}
+}
+
+type deleteDeviceArgs struct {
+	baseDeviceArgs
+	force bool
 }
 
 func newDeleteDeviceCmd(ctx *Context) *Command {
-	data := new(baseDeviceArgs)
+	data := new(deleteDeviceArgs)
 
 	cmd := &Command{
 		Name:    "delete",
@@ -297,14 +525,26 @@ func newDeleteDeviceCmd(ctx *Context) *Command {
 		Action:  deleteDevice,
 	}
 	flags := cmd.NewFlagSet("iobeam device delete")
-	flags.StringVar(&data.id, "id", "", "The ID of the device to delete (REQUIRED)")
+	flags.StringVar(&data.id, "id", "", "The ID of the device to delete (this or -name is required)")
+	flags.StringVar(&data.name, "name", "", "The name of the device to delete (this or -id is required)")
 	flags.Uint64Var(&data.projectId, "projectId", ctx.Profile.ActiveProject, "The ID of the project the device belongs to (defaults to active project)")
+	flags.BoolVar(&data.force, "force", false, descForce)
 
 	return cmd
 }
 
 func deleteDevice(c *Command, ctx *Context) error {
-	data := c.Data.(*baseDeviceArgs)
+	data := c.Data.(*deleteDeviceArgs)
+	byName := len(data.id) == 0
+	if err := data.resolve(ctx); err != nil {
+		return err
+	}
+	if byName {
+		if err := confirmByName("delete", "device", data.name, data.id, data.force); err != nil {
+			return err
+		}
+	}
+
 	path := c.ApiPath + "/" + data.id
 	_, err := ctx.Client.
 		Delete(path).
@@ -313,6 +553,7 @@ func deleteDevice(c *Command, ctx *Context) error {
 		Execute()
 
 	if err == nil {
+		ctx.forgetNames(kindDevice)
 		fmt.Println("Device successfully deleted")
 	}
 
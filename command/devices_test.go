@@ -1,6 +1,16 @@
 package command
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestBaseDeviceArgsIsValid(t *testing.T) {
 	cases := []struct {
@@ -48,3 +58,197 @@ func TestBaseDeviceArgsIsValid(t *testing.T) {
 		}
 	}
 }
+
+func TestListDataIsValid(t *testing.T) {
+	valid := func() *listData {
+		return &listData{projectId: 1, order: orderDate, page: 1, output: outputTable}
+	}
+	filtered := valid()
+	filtered.name = "kitchen-*"
+	filtered.createdAfter = "24h"
+	filtered.createdBefore = "2016-01-02T15:04:05Z"
+	badPattern := valid()
+	badPattern.name = "[a"
+	badTime := valid()
+	badTime.createdAfter = "yesterday"
+	badPage := valid()
+	badPage.page = 0
+	badOutput := valid()
+	badOutput.output = outputYaml
+
+	cases := []dataTestCase{
+		{desc: "valid", in: valid(), want: true},
+		{desc: "valid, filtered", in: filtered, want: true},
+		{desc: "invalid, bad pattern", in: badPattern, want: false},
+		{desc: "invalid, bad time", in: badTime, want: false},
+		{desc: "invalid, bad page", in: badPage, want: false},
+		{desc: "invalid, bad output", in: badOutput, want: false},
+	}
+	runDataTestCase(t, cases)
+}
+
+func deviceIds(devices []deviceData) string {
+	var ids []string
+	for _, d := range devices {
+		ids = append(ids, d.DeviceId)
+	}
+	return strings.Join(ids, " ")
+}
+
+func testDevices() []deviceData {
+	return []deviceData{
+		{DeviceId: "b", DeviceName: "kitchen-1", DeviceType: "sensor", Created: "2016-01-03 00:00:00"},
+		{DeviceId: "a", DeviceName: "hall", DeviceType: "sensor", Created: "2016-01-01 00:00:00"},
+		{DeviceId: "c", DeviceName: "kitchen-2", DeviceType: "switch", Created: "2016-01-02 00:00:00"},
+	}
+}
+
+func TestDeviceSort(t *testing.T) {
+	cases := map[string]string{
+		orderId:          "a b c",
+		orderIdReverse:   "c b a",
+		orderName:        "a b c",
+		orderNameReverse: "c b a",
+		orderDate:        "a c b",
+		orderDateReverse: "b c a",
+	}
+	for order, want := range cases {
+		devices := testDevices()
+		sort.Sort(&deviceSort{items: devices, order: order})
+		if got := deviceIds(devices); got != want {
+			t.Errorf("order %s: got '%s', want '%s'", order, got, want)
+		}
+	}
+}
+
+func TestFilterDevices(t *testing.T) {
+	now := time.Date(2016, 1, 4, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		desc string
+		in   *listData
+		want string
+	}{
+		{desc: "no filter", in: &listData{}, want: "b a c"},
+		{desc: "type", in: &listData{deviceType: "sensor"}, want: "b a"},
+		{desc: "name pattern", in: &listData{name: "kitchen-*"}, want: "b c"},
+		{desc: "created after", in: &listData{createdAfter: "2016-01-01T12:00:00Z"}, want: "b c"},
+		{desc: "created before, as duration", in: &listData{createdBefore: "36h"}, want: "a c"},
+		{desc: "combined", in: &listData{name: "kitchen-*", deviceType: "sensor", createdBefore: "1h"}, want: "b"},
+	}
+	for _, c := range cases {
+		f, err := c.in.filter(now)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+			continue
+		}
+		got, err := filterDevices(testDevices(), f)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		} else if deviceIds(got) != c.want {
+			t.Errorf("%s: got '%s', want '%s'", c.desc, deviceIds(got), c.want)
+		}
+	}
+
+	f := &deviceFilter{after: now}
+	if _, err := filterDevices([]deviceData{{DeviceId: "x", Created: "?"}}, f); err == nil {
+		t.Errorf("expected error for unknown creation time")
+	}
+}
+
+func TestPageDevices(t *testing.T) {
+	devices := testDevices()
+	cases := []struct {
+		limit, page int
+		want        string
+	}{
+		{limit: 0, page: 1, want: "b a c"},
+		{limit: 2, page: 1, want: "b a"},
+		{limit: 2, page: 2, want: "c"},
+		{limit: 2, page: 3, want: ""},
+	}
+	for _, c := range cases {
+		if got := deviceIds(pageDevices(devices, c.limit, c.page)); got != c.want {
+			t.Errorf("limit %d, page %d: got '%s', want '%s'", c.limit, c.page, got, c.want)
+		}
+	}
+}
+
+func TestWriteDeviceList(t *testing.T) {
+	devices := testDevices()[:2]
+
+	var buf bytes.Buffer
+	if err := writeDeviceTable(&buf, devices); err != nil {
+		t.Fatal(err)
+	}
+	want := "DEVICE ID  NAME       TYPE    CREATED\n" +
+		"b          kitchen-1  sensor  2016-01-03 00:00:00\n" +
+		"a          hall       sensor  2016-01-01 00:00:00\n"
+	if buf.String() != want {
+		t.Errorf("got table\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := writeDeviceListCsv(&buf, devices); err != nil {
+		t.Fatal(err)
+	}
+	want = "id,name,type,created\n" +
+		"b,kitchen-1,sensor,2016-01-03 00:00:00\n" +
+		"a,hall,sensor,2016-01-01 00:00:00\n"
+	if buf.String() != want {
+		t.Errorf("got CSV\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestGetDevicesPages(t *testing.T) {
+	total := devicePageSize + 10
+	var offsets []string
+	ignoreOffset := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/devices", func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		offsets = append(offsets, r.URL.Query().Get("offset"))
+		if ignoreOffset {
+			offset, limit = 0, total
+		}
+		var list struct {
+			Devices []deviceData `json:"devices"`
+		}
+		for i := offset; i < total && i < offset+limit; i++ {
+			list.Devices = append(list.Devices, deviceData{ProjectId: 1, DeviceId: fmt.Sprintf("dev-%d", i)})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+	})
+	ctx := newTestContext(t, mux)
+
+	devices, err := _getDevices(ctx, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(devices) != total || fmt.Sprint(offsets) != fmt.Sprintf("[0 %d]", devicePageSize) {
+		t.Errorf("got %d devices with offsets %v", len(devices), offsets)
+	}
+
+	// A server without paging returns every device for each request.
+	ignoreOffset = true
+	offsets = nil
+	devices, err = _getDevices(ctx, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(devices) != total || len(offsets) != 1 {
+		t.Errorf("got %d devices with offsets %v", len(devices), offsets)
+	}
+
+	// With exactly a page of devices, the repeated page ends the listing.
+	total = devicePageSize
+	offsets = nil
+	devices, err = _getDevices(ctx, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(devices) != total || len(offsets) != 2 {
+		t.Errorf("got %d devices with offsets %v", len(devices), offsets)
+	}
+}
@@ -0,0 +1,118 @@
+package command
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type downloadFileArgs struct {
+	projectId uint64
+	filename  string
+	out       string
+}
+
+func (a *downloadFileArgs) IsValid() bool {
+	return len(a.filename) > 0 && a.projectId > 0
+}
+
+// outPath returns where the file is saved: -out if it is a file path, the
+// file name inside -out if it is a directory, or the file name otherwise.
+func (a *downloadFileArgs) outPath() string {
+	if len(a.out) == 0 {
+		return a.filename
+	}
+	if info, err := os.Stat(a.out); err == nil && info.IsDir() {
+		return filepath.Join(a.out, a.filename)
+	}
+	return a.out
+}
+
+func newDownloadFileCmd(ctx *Context) *Command {
+	args := new(downloadFileArgs)
+
+	cmd := &Command{
+		Name: "download",
+		//ApiPath determined by flags
+		Usage:  "Download a file from iobeam, verifying its checksum.",
+		Data:   args,
+		Action: downloadFile,
+	}
+	flags := cmd.newFlagSetFile()
+	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject, "The ID of the project that contains the file (defaults to active project).")
+	flags.StringVar(&args.filename, "name", "", "Name of the file to download.")
+	flags.StringVar(&args.out, "out", "", "Path or directory to save the file to (defaults to the file name in the current directory).")
+
+	return cmd
+}
+
+func downloadFile(c *Command, ctx *Context) error {
+	args := c.Data.(*downloadFileArgs)
+	info, err := _getFileInfo(ctx, args.projectId, args.filename)
+	if err != nil {
+		return err
+	}
+
+	out := args.outPath()
+	if err := _downloadFile(ctx, args.projectId, info, out); err != nil {
+		return err
+	}
+
+	fmt.Printf("File '%s' downloaded to '%s'.\n", args.filename, out)
+	return nil
+}
+
+// _downloadFile streams the file described by info into a temporary file
+// next to out, and renames it to out only if its checksum matches. A partial
+// or corrupted download never replaces out.
+func _downloadFile(ctx *Context, projectId uint64, info *fileInfo, out string) error {
+	alg := strings.ToUpper(strings.Replace(info.Checksum.Algorithm, "-", "", -1))
+	if alg != checksumAlgSha {
+		return fmt.Errorf("Cannot verify checksum algorithm '%s' of file '%s'.", info.Checksum.Algorithm, info.Name)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(out), "."+filepath.Base(out)+".part-")
+	if err != nil {
+		return err
+	}
+	renamed := false
+	defer func() {
+		if !renamed {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	hash := sha256.New()
+	_, err = ctx.Client.
+		Get(getUrlForFileName(info.Name)).
+		Expect(200).
+		ProjectToken(ctx.Profile, projectId).
+		ResponseStream(io.MultiWriter(tmp, hash)).
+		Execute()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Download of '%s' failed: %v", info.Name, err)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(sum, info.Checksum.Sum) {
+		return fmt.Errorf("Checksum mismatch for '%s': expected %s, got %s. The download was discarded.",
+			info.Name, info.Checksum.Sum, sum)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), out); err != nil {
+		return err
+	}
+	renamed = true
+	return nil
+}
@@ -0,0 +1,85 @@
+package command
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadFileArgsValidity(t *testing.T) {
+	cases := []dataTestCase{
+		{desc: "valid", in: &downloadFileArgs{projectId: 1, filename: "app.jar"}, want: true},
+		{desc: testDescInvalidProjectId, in: &downloadFileArgs{filename: "app.jar"}, want: false},
+		{desc: "invalid, no name", in: &downloadFileArgs{projectId: 1}, want: false},
+	}
+	runDataTestCase(t, cases)
+}
+
+// fileStubHandler serves a single file, app.jar, whose content is body. The
+// checksum reported by the file list is the checksum of content.
+func fileStubHandler(content, body string) http.Handler {
+	sum := sha256.Sum256([]byte(content))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/files", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"files": [{"file_name": "app.jar", "checksum": {"alg": "SHA-256", "sum": "%s"}}]}`,
+			hex.EncodeToString(sum[:]))
+	})
+	mux.HandleFunc("/v1/files/app.jar", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, body)
+	})
+	return mux
+}
+
+func testDownload(t *testing.T, content, body string) (string, error) {
+	dir, err := ioutil.TempDir("", "iobeam-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := newTestContext(t, fileStubHandler(content, body))
+	cmd := &Command{Data: &downloadFileArgs{projectId: 1, filename: "app.jar", out: dir}}
+	return dir, downloadFile(cmd, ctx)
+}
+
+func TestDownloadFile(t *testing.T) {
+	dir, err := testDownload(t, "jar contents", "jar contents")
+	defer os.RemoveAll(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "app.jar"))
+	if err != nil || string(got) != "jar contents" {
+		t.Errorf("unexpected file contents: '%s', %v", got, err)
+	}
+	assertOnlyFiles(t, dir, "app.jar")
+}
+
+func TestDownloadFileCorrupted(t *testing.T) {
+	dir, err := testDownload(t, "jar contents", "jar cont")
+	defer os.RemoveAll(dir)
+	if err == nil {
+		t.Fatalf("expected checksum error")
+	}
+	assertOnlyFiles(t, dir)
+}
+
+func assertOnlyFiles(t *testing.T, dir string, names ...string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, f.Name())
+	}
+	if fmt.Sprint(got) != fmt.Sprint(names) {
+		t.Errorf("expected files %v in download dir, got %v", names, got)
+	}
+}
@@ -0,0 +1,297 @@
+package command
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const defaultSyncWorkers = 4
+
+const (
+	syncNew     = "new"
+	syncChanged = "changed"
+	syncDelete  = "delete"
+)
+
+type syncFilesArgs struct {
+	projectId uint64
+	dir       string
+	delete    bool
+	force     bool
+	dryRun    bool
+	workers   int
+	chunkSize int64
+}
+
+func (a *syncFilesArgs) IsValid() bool {
+	return a.projectId > 0 && len(a.dir) > 0 && a.workers > 0 && a.chunkSize >= 0
+}
+
+func (a *syncFilesArgs) setPosArgs(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("Expected one directory, got: %s", strings.Join(args, " "))
+	}
+	if len(args) == 1 {
+		a.dir = args[0]
+	}
+	return nil
+}
+
+func newSyncFilesCmd(ctx *Context) *Command {
+	args := new(syncFilesArgs)
+
+	cmd := &Command{
+		Name: "sync",
+		//ApiPath determined by flags
+		Usage: "Sync the files in a directory to iobeam, uploading new and changed files " +
+			"(compared by name and SHA-256). Subdirectories are not synced.",
+		PosArgs: "DIR",
+		Data:    args,
+		Action:  syncFiles,
+	}
+	flags := cmd.newFlagSetFile()
+	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject, "The ID of the project to sync files to (defaults to active project).")
+	flags.BoolVar(&args.delete, "delete", false, "Delete files on iobeam that are not in the directory. "+
+		"Files used by an app, now or in its bundle history, are kept.")
+	flags.BoolVar(&args.force, "force", false, "With -delete, do not ask for confirmation before deleting files.")
+	flags.BoolVar(&args.dryRun, "dry-run", false, "Only show what would be uploaded and deleted.")
+	flags.IntVar(&args.workers, "workers", defaultSyncWorkers, "Number of files to upload at the same time.")
+	flags.Int64Var(&args.chunkSize, "chunkSize", defaultChunkSize, "Number of bytes to upload per request.")
+
+	return cmd
+}
+
+// syncAction is a change needed to make a remote file match a local one.
+type syncAction struct {
+	name string
+	path string // local path; empty when deleting
+	kind string
+}
+
+func (a syncAction) String() string {
+	if a.kind == syncDelete {
+		return fmt.Sprintf("delete  %s", a.name)
+	}
+	return fmt.Sprintf("upload  %s (%s)", a.name, a.kind)
+}
+
+// localSyncFiles returns the SHA-256 digests of the regular files directly
+// in dir, by file name.
+func localSyncFiles(dir string) (map[string]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	digests := make(map[string]string)
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		digest, err := fileSha256(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		digests[info.Name()] = digest
+	}
+	return digests, nil
+}
+
+func fileSha256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// remoteMatches reports whether the remote file has the given SHA-256 digest.
+func remoteMatches(info fileInfo, digest string) bool {
+	alg := strings.ToUpper(strings.Replace(info.Checksum.Algorithm, "-", "", -1))
+	return alg == checksumAlgSha && strings.EqualFold(info.Checksum.Sum, digest)
+}
+
+// bundleFileRefs returns the names of the files used as bundles by apps,
+// now or in their bundle history.
+func bundleFileRefs(apps []appData, history appHistory) map[string]bool {
+	refs := make(map[string]bool)
+	for _, app := range apps {
+		if strings.HasPrefix(app.Bundle.URI, bundleUriPrefix) {
+			refs[strings.TrimPrefix(app.Bundle.URI, bundleUriPrefix)] = true
+		}
+		for _, v := range history[appKey(app.AppId)] {
+			refs[v.ServerFile] = true
+		}
+	}
+	return refs
+}
+
+func _getBundleFileRefs(ctx *Context, projectId uint64) (map[string]bool, error) {
+	apps, err := _getApps(ctx, projectId)
+	if err != nil {
+		return nil, err
+	}
+	history, err := readAppHistory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return bundleFileRefs(apps, history), nil
+}
+
+// planSync returns the actions needed to make remote match the local files
+// in dir, sorted by name. Remote files missing locally are only deleted if
+// del is set, and never if they are in keep; those are returned as kept.
+func planSync(dir string, local map[string]string, remote []fileInfo, del bool, keep map[string]bool) ([]syncAction, []string) {
+	remoteByName := make(map[string]fileInfo)
+	for _, info := range remote {
+		remoteByName[info.Name] = info
+	}
+
+	var actions []syncAction
+	for name, digest := range local {
+		info, ok := remoteByName[name]
+		switch {
+		case !ok:
+			actions = append(actions, syncAction{name: name, path: filepath.Join(dir, name), kind: syncNew})
+		case !remoteMatches(info, digest):
+			actions = append(actions, syncAction{name: name, path: filepath.Join(dir, name), kind: syncChanged})
+		}
+	}
+	var kept []string
+	if del {
+		for name := range remoteByName {
+			if _, ok := local[name]; ok {
+				continue
+			}
+			if keep[name] {
+				kept = append(kept, name)
+			} else {
+				actions = append(actions, syncAction{name: name, kind: syncDelete})
+			}
+		}
+	}
+
+	sort.Slice(actions, func(i, j int) bool { return actions[i].name < actions[j].name })
+	sort.Strings(kept)
+	return actions, kept
+}
+
+func syncFiles(c *Command, ctx *Context) error {
+	args := c.Data.(*syncFilesArgs)
+	local, err := localSyncFiles(args.dir)
+	if err != nil {
+		return err
+	}
+	remote, err := _getFiles(ctx, args.projectId)
+	if err != nil {
+		return err
+	}
+
+	var keep map[string]bool
+	if args.delete {
+		if keep, err = _getBundleFileRefs(ctx, args.projectId); err != nil {
+			return err
+		}
+	}
+
+	actions, kept := planSync(args.dir, local, remote, args.delete, keep)
+	for _, name := range kept {
+		fmt.Printf("Keeping '%s', it is used by an app.\n", name)
+	}
+	if len(actions) == 0 {
+		fmt.Printf("Project %d is up to date with '%s'.\n", args.projectId, args.dir)
+		return nil
+	}
+	for _, a := range actions {
+		fmt.Println(a)
+	}
+	if args.dryRun {
+		fmt.Println("Dry run, nothing was changed.")
+		return nil
+	}
+	if n := countSyncDeletes(actions); n > 0 && !confirm(fmt.Sprintf("\nSync, deleting %d files?", n), args.force) {
+		return fmt.Errorf("Aborted, nothing was changed.")
+	}
+
+	failed := runSyncActions(ctx, args, actions)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be synced.", failed, len(actions))
+	}
+	fmt.Printf("Synced %d files.\n", len(actions))
+	return nil
+}
+
+func countSyncDeletes(actions []syncAction) int {
+	n := 0
+	for _, a := range actions {
+		if a.kind == syncDelete {
+			n++
+		}
+	}
+	return n
+}
+
+// runSyncActions runs actions using args.workers goroutines, and returns the
+// number of actions that failed.
+func runSyncActions(ctx *Context, args *syncFilesArgs, actions []syncAction) int {
+	jobs := make(chan syncAction)
+	var mu sync.Mutex
+	failed := 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < args.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for a := range jobs {
+				err := _runSyncAction(ctx, args, a)
+				mu.Lock()
+				if err != nil {
+					failed++
+					fmt.Printf("Failed to %s: %v\n", a, err)
+				} else if a.kind == syncDelete {
+					fmt.Printf("Deleted '%s'.\n", a.name)
+				} else {
+					fmt.Printf("Uploaded '%s'.\n", a.name)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, a := range actions {
+		jobs <- a
+	}
+	close(jobs)
+	wg.Wait()
+	return failed
+}
+
+func _runSyncAction(ctx *Context, args *syncFilesArgs, a syncAction) error {
+	if a.kind == syncDelete {
+		_, err := ctx.Client.
+			Delete(getUrlForFileName(a.name)).
+			Expect(204).
+			ProjectToken(ctx.Profile, args.projectId).
+			Execute()
+		return err
+	}
+
+	// Progress bars of concurrent uploads would overwrite each other.
+	u := newChunkedUpload(ctx, &uploadFileArgs{projectId: args.projectId, path: a.path, chunkSize: args.chunkSize})
+	u.progress = nil
+	_, err := u.run()
+	return err
+}
@@ -0,0 +1,119 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncFilesArgsValidity(t *testing.T) {
+	cases := []dataTestCase{
+		{desc: "valid", in: &syncFilesArgs{projectId: 1, dir: "out", workers: 4}, want: true},
+		{desc: testDescInvalidProjectId, in: &syncFilesArgs{dir: "out", workers: 4}, want: false},
+		{desc: "invalid, no dir", in: &syncFilesArgs{projectId: 1, workers: 4}, want: false},
+		{desc: "invalid, no workers", in: &syncFilesArgs{projectId: 1, dir: "out"}, want: false},
+		{desc: "invalid, negative chunk size", in: &syncFilesArgs{projectId: 1, dir: "out", workers: 4, chunkSize: -1}, want: false},
+	}
+	runDataTestCase(t, cases)
+}
+
+func TestSyncFilesPosArgs(t *testing.T) {
+	args := new(syncFilesArgs)
+	cmd := &Command{Name: "sync", Data: args}
+	flags := cmd.NewFlagSet("sync")
+	flags.BoolVar(&args.delete, "delete", false, "")
+	flags.IntVar(&args.workers, "workers", 1, "")
+
+	ctx := &Context{Args: []string{"sync", "-workers", "2", "artifacts", "-delete"}, Index: 1}
+	if err := cmd.parseFlags(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if args.dir != "artifacts" || !args.delete || args.workers != 2 {
+		t.Errorf("unexpected args: %+v", args)
+	}
+
+	if err := args.setPosArgs([]string{"a", "b"}); err == nil {
+		t.Errorf("expected error for two directories")
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	local := map[string]string{
+		"new.jar":       "aaaa",
+		"changed.jar":   "bbbb",
+		"unchanged.jar": "cccc",
+	}
+	remote := []fileInfo{
+		{Name: "changed.jar", Checksum: checksum{Algorithm: "SHA-256", Sum: "0000"}},
+		{Name: "unchanged.jar", Checksum: checksum{Algorithm: "SHA-256", Sum: "CCCC"}},
+		{Name: "old.jar", Checksum: checksum{Algorithm: "SHA-256", Sum: "dddd"}},
+		{Name: "app-0123456789ab.jar", Checksum: checksum{Algorithm: "SHA-256", Sum: "eeee"}},
+	}
+	keep := map[string]bool{"app-0123456789ab.jar": true}
+
+	cases := []struct {
+		desc string
+		del  bool
+		want string
+	}{
+		{
+			desc: "without delete",
+			want: "[upload  changed.jar (changed) upload  new.jar (new)]",
+		},
+		{
+			desc: "with delete",
+			del:  true,
+			want: "[upload  changed.jar (changed) upload  new.jar (new) delete  old.jar]",
+		},
+	}
+	for _, c := range cases {
+		actions, _ := planSync("dir", local, remote, c.del, keep)
+		if got := fmt.Sprint(actions); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.desc, got, c.want)
+		}
+	}
+
+	actions, kept := planSync("dir", local, remote, true, keep)
+	if fmt.Sprint(kept) != "[app-0123456789ab.jar]" {
+		t.Errorf("unexpected kept files: %v", kept)
+	}
+	if actions[0].path != filepath.Join("dir", "changed.jar") {
+		t.Errorf("unexpected path: %s", actions[0].path)
+	}
+}
+
+func TestBundleFileRefs(t *testing.T) {
+	apps := []appData{
+		{AppId: 1, Bundle: bundle{URI: bundleUriPrefix + "app-2222.jar"}},
+		{AppId: 2, Bundle: bundle{URI: "https://example.com/other.jar"}},
+	}
+	history := appHistory{
+		appKey(1): {{ServerFile: "app-1111.jar"}, {ServerFile: "app-2222.jar"}},
+		appKey(3): {{ServerFile: "not-in-project.jar"}},
+	}
+	refs := bundleFileRefs(apps, history)
+	if len(refs) != 2 || !refs["app-1111.jar"] || !refs["app-2222.jar"] {
+		t.Errorf("unexpected bundle file refs: %v", refs)
+	}
+}
+
+func TestLocalSyncFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iobeam-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "a.jar"), []byte("a"), 0644)
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "b.jar"), []byte("b"), 0644)
+
+	got, err := localSyncFiles(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got["a.jar"] != sha256String("a") {
+		t.Errorf("unexpected local files: %v", got)
+	}
+}
@@ -0,0 +1,344 @@
+package command
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultChunkSize = 8 * 1024 * 1024
+	maxChunkTries    = 4
+	chunkRetryDelay  = time.Second
+
+	// uploadStatesFile is stored in the profile directory and keeps the
+	// progress of unfinished uploads so they can be resumed.
+	uploadStatesFile = "uploads.json"
+)
+
+// errNoUploadSessions is returned when the server does not support upload
+// sessions, in which case the file is uploaded in a single request.
+var errNoUploadSessions = errors.New("upload sessions are not supported")
+
+func getUrlForUpload(uploadId string) string {
+	return fmt.Sprintf("%s/uploads/%s", baseApiPath[keyFile], uploadId)
+}
+
+// uploadState is the progress of an unfinished upload. HashState is the
+// state of the SHA-256 hash of the first Offset bytes, so a resumed upload
+// does not have to read them again.
+type uploadState struct {
+	UploadId  string    `json:"upload_id"`
+	Offset    int64     `json:"offset"`
+	HashState []byte    `json:"hash_state"`
+	Started   time.Time `json:"started"`
+}
+
+// uploadStates maps files (see uploadKey) to the state of their upload.
+type uploadStates map[string]*uploadState
+
+// uploadKey identifies an upload of a file. It includes the size and
+// modification time so that a changed file is uploaded from the start.
+func uploadKey(projectId uint64, path string, info os.FileInfo) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	return fmt.Sprintf("%d:%s:%d:%d", projectId, abs, info.Size(), info.ModTime().UnixNano())
+}
+
+// uploadStateStore keeps the states of unfinished uploads by key. A nil
+// state means there is no unfinished upload.
+type uploadStateStore interface {
+	get(key string) (*uploadState, error)
+	put(key string, state *uploadState) error
+	remove(key string) error
+}
+
+// profileUploadStore keeps upload states in the profile directory. All
+// changes go through uploadStatesMu, since several uploads may run at once.
+type profileUploadStore struct {
+	ctx *Context
+}
+
+var uploadStatesMu sync.Mutex
+
+func (s *profileUploadStore) load() (uploadStates, error) {
+	states := make(uploadStates)
+	err := s.ctx.Profile.ReadData(uploadStatesFile, &states)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	return states, err
+}
+
+func (s *profileUploadStore) update(f func(uploadStates)) error {
+	uploadStatesMu.Lock()
+	defer uploadStatesMu.Unlock()
+	states, err := s.load()
+	if err != nil {
+		return err
+	}
+	f(states)
+	return s.ctx.Profile.SaveData(uploadStatesFile, states)
+}
+
+func (s *profileUploadStore) get(key string) (*uploadState, error) {
+	uploadStatesMu.Lock()
+	defer uploadStatesMu.Unlock()
+	states, err := s.load()
+	return states[key], err
+}
+
+func (s *profileUploadStore) put(key string, state *uploadState) error {
+	return s.update(func(states uploadStates) { states[key] = state })
+}
+
+func (s *profileUploadStore) remove(key string) error {
+	return s.update(func(states uploadStates) { delete(states, key) })
+}
+
+// chunkedUpload uploads a file in chunks, which are retried if they fail.
+// Its progress is saved after every chunk, so an interrupted upload of the
+// same file resumes where it stopped. Servers without upload sessions get
+// the whole file in a single PUT instead.
+type chunkedUpload struct {
+	ctx        *Context
+	args       *uploadFileArgs
+	chunkSize  int64
+	retryDelay time.Duration
+	store      uploadStateStore
+	progress   io.Writer
+}
+
+func newChunkedUpload(ctx *Context, args *uploadFileArgs) *chunkedUpload {
+	u := &chunkedUpload{
+		ctx:        ctx,
+		args:       args,
+		chunkSize:  args.chunkSize,
+		retryDelay: chunkRetryDelay,
+		store:      &profileUploadStore{ctx: ctx},
+	}
+	if u.chunkSize <= 0 {
+		u.chunkSize = defaultChunkSize
+	}
+	if isTerminal(os.Stderr) {
+		u.progress = os.Stderr
+	}
+	return u
+}
+
+// run uploads the file and returns its SHA-256 digest.
+func (u *chunkedUpload) run() (string, error) {
+	f, err := os.Open(u.args.path)
+	if err != nil {
+		return "", fmt.Errorf("Could not open file for upload: %v", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	key := uploadKey(u.args.projectId, u.args.path, info)
+	saved, err := u.store.get(key)
+	if err != nil {
+		return "", fmt.Errorf("Could not read upload state: %v", err)
+	}
+	hash := sha256.New()
+	state := u.resumeState(saved, hash)
+	if state == nil {
+		state, err = u.startUpload()
+		if err == errNoUploadSessions {
+			if saved != nil {
+				u.store.remove(key)
+			}
+			return u.singleUpload(f)
+		} else if err != nil {
+			return "", err
+		}
+		hash.Reset()
+	}
+	if _, err := f.Seek(state.Offset, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	var bar *progressBar
+	if u.progress != nil {
+		bar = newProgressBar(u.progress, info.Size(), state.Offset)
+		bar.update(state.Offset)
+	}
+
+	// Every byte is read once, and hashed while it is read.
+	reader := io.TeeReader(f, hash)
+	buf := make([]byte, u.chunkSize)
+	for state.Offset < info.Size() {
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return "", err
+		}
+		if err := u.putChunk(state, buf[:n]); err != nil {
+			return "", err
+		}
+
+		state.Offset += int64(n)
+		state.HashState, err = hash.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return "", err
+		}
+		if err := u.store.put(key, state); err != nil {
+			return "", fmt.Errorf("Could not save upload state: %v", err)
+		}
+		if bar != nil {
+			bar.update(state.Offset)
+		}
+	}
+	if bar != nil {
+		bar.finish()
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if err := u.complete(state, digest); err != nil {
+		return "", err
+	}
+
+	if err := u.store.remove(key); err != nil {
+		fmt.Printf("Warning: could not clear upload state: %v\n", err)
+	}
+	return digest, nil
+}
+
+// resumeState returns state if the upload it describes can be resumed, after
+// restoring its hash state into hash. Otherwise it returns nil.
+func (u *chunkedUpload) resumeState(state *uploadState, hash hash.Hash) *uploadState {
+	if state == nil {
+		return nil
+	}
+	if err := hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(state.HashState); err != nil {
+		return nil
+	}
+
+	type uploadStatus struct {
+		Offset int64 `json:"offset"`
+	}
+	status := new(uploadStatus)
+	_, err := u.ctx.Client.
+		Get(getUrlForUpload(state.UploadId)).
+		Expect(200).
+		ProjectToken(u.ctx.Profile, u.args.projectId).
+		ResponseBody(status).
+		Execute()
+	if err != nil || status.Offset != state.Offset {
+		return nil
+	}
+
+	fmt.Printf("Resuming upload of '%s' at %s.\n", u.args.path, formatBytes(state.Offset))
+	return state
+}
+
+func (u *chunkedUpload) startUpload() (*uploadState, error) {
+	type uploadSession struct {
+		UploadId string `json:"upload_id"`
+	}
+	session := new(uploadSession)
+	rsp, err := u.ctx.Client.
+		Post(baseApiPath[keyFile]+"/uploads").
+		Expect(201).
+		ProjectToken(u.ctx.Profile, u.args.projectId).
+		ResponseBody(session).
+		Execute()
+	if err != nil && rsp != nil {
+		if code := rsp.Http().StatusCode; code == 404 || code == 405 {
+			return nil, errNoUploadSessions
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &uploadState{UploadId: session.UploadId, Started: time.Now()}, nil
+}
+
+// putChunk uploads chunk at the offset of state, retrying with increasing
+// delays if it fails.
+func (u *chunkedUpload) putChunk(state *uploadState, chunk []byte) error {
+	delay := u.retryDelay
+	var err error
+	for try := 1; try <= maxChunkTries; try++ {
+		_, err = u.ctx.Client.
+			Put(getUrlForUpload(state.UploadId)).
+			Expect(204).
+			ProjectToken(u.ctx.Profile, u.args.projectId).
+			ParamInt64("offset", state.Offset).
+			BodyStream(bytes.NewReader(chunk)).
+			Execute()
+		if err == nil {
+			return nil
+		}
+		if try < maxChunkTries {
+			if u.progress != nil {
+				fmt.Fprintln(u.progress)
+			}
+			fmt.Printf("Upload of chunk at %s failed (%v), retrying...\n", formatBytes(state.Offset), err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return fmt.Errorf("Upload failed after %d tries, run the command again to resume: %v", maxChunkTries, err)
+}
+
+// complete finishes the upload, storing it under its final name.
+func (u *chunkedUpload) complete(state *uploadState, digest string) error {
+	type completeData struct {
+		Name     string   `json:"file_name"`
+		Checksum checksum `json:"checksum"`
+	}
+	body := &completeData{
+		Name:     u.args.serverFileName(digest),
+		Checksum: checksum{Algorithm: "SHA-256", Sum: digest},
+	}
+	_, err := u.ctx.Client.
+		Post(getUrlForUpload(state.UploadId)+"/complete").
+		Expect(201).
+		ProjectToken(u.ctx.Profile, u.args.projectId).
+		Body(body).
+		Execute()
+	return err
+}
+
+// singleUpload uploads f in a single request with its checksum, for servers
+// without upload sessions. It cannot be resumed.
+func (u *chunkedUpload) singleUpload(f *os.File) (string, error) {
+	hash := sha256.New()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(hash.Sum(nil))
+
+	_, err := u.ctx.Client.
+		Put(getUrlForFileName(u.args.serverFileName(digest))).
+		Expect(201).
+		ProjectToken(u.ctx.Profile, u.args.projectId).
+		Param("checksum", digest).
+		Param("checksum_alg", "SHA-256").
+		BodyStream(f).
+		Execute()
+	if err != nil {
+		return "", err
+	}
+	return digest, nil
+}
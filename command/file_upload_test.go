@@ -0,0 +1,262 @@
+package command
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type memUploadStore struct {
+	states uploadStates
+}
+
+func (s *memUploadStore) get(key string) (*uploadState, error) {
+	if state, ok := s.states[key]; ok {
+		copied := *state
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (s *memUploadStore) put(key string, state *uploadState) error {
+	if s.states == nil {
+		s.states = make(uploadStates)
+	}
+	copied := *state
+	s.states[key] = &copied
+	return nil
+}
+
+func (s *memUploadStore) remove(key string) error {
+	delete(s.states, key)
+	return nil
+}
+
+// uploadStub accepts a single upload session. failPuts decides whether
+// the n-th chunk PUT (counting from 1) fails.
+type uploadStub struct {
+	http.Handler
+	data      bytes.Buffer
+	puts      int
+	failPuts  func(n int) bool
+	sessions  int
+	completed map[string]interface{}
+}
+
+func newUploadStub() *uploadStub {
+	s := &uploadStub{failPuts: func(int) bool { return false }}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/files/uploads", func(w http.ResponseWriter, r *http.Request) {
+		s.sessions++
+		s.data.Reset()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		fmt.Fprint(w, `{"upload_id": "u1"}`)
+	})
+	mux.HandleFunc("/v1/files/uploads/u1", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"offset": %d}`, s.data.Len())
+		case "PUT":
+			s.puts++
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			if s.failPuts(s.puts) || offset != s.data.Len() {
+				w.WriteHeader(500)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			s.data.Write(body)
+			w.WriteHeader(204)
+		}
+	})
+	mux.HandleFunc("/v1/files/uploads/u1/complete", func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&s.completed)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		fmt.Fprint(w, `{}`)
+	})
+	s.Handler = mux
+	return s
+}
+
+func testChunkedUpload(ctx *Context, store uploadStateStore, path string) *chunkedUpload {
+	u := newChunkedUpload(ctx, &uploadFileArgs{projectId: 1, path: path, chunkSize: 4})
+	u.store = store
+	u.retryDelay = 0
+	u.progress = nil
+	return u
+}
+
+func writeTempFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "iobeam-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func sha256String(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestChunkedUploadRetry(t *testing.T) {
+	content := "0123456789abcdefghij"
+	path := writeTempFile(t, content)
+	defer os.Remove(path)
+
+	server := newUploadStub()
+	ctx := newTestContext(t, server)
+	server.failPuts = func(n int) bool { return n == 2 || n == 3 }
+
+	store := &memUploadStore{}
+	digest, err := testChunkedUpload(ctx, store, path).run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := server.data.String(); got != content {
+		t.Errorf("server got '%s', want '%s'", got, content)
+	}
+	if digest != sha256String(content) {
+		t.Errorf("got digest %s, want %s", digest, sha256String(content))
+	}
+	checksum := server.completed["checksum"].(map[string]interface{})
+	if checksum["sum"] != digest {
+		t.Errorf("completed with checksum %v, want %s", checksum["sum"], digest)
+	}
+	if len(store.states) != 0 {
+		t.Errorf("upload state was not cleared: %v", store.states)
+	}
+}
+
+func TestChunkedUploadResume(t *testing.T) {
+	content := "0123456789abcdefghij"
+	path := writeTempFile(t, content)
+	defer os.Remove(path)
+
+	server := newUploadStub()
+	ctx := newTestContext(t, server)
+	server.failPuts = func(n int) bool { return n > 2 }
+
+	store := &memUploadStore{}
+	if _, err := testChunkedUpload(ctx, store, path).run(); err == nil {
+		t.Fatalf("expected first upload to fail")
+	}
+	if len(store.states) != 1 {
+		t.Fatalf("expected 1 saved upload state, got %d", len(store.states))
+	}
+	for _, state := range store.states {
+		if state.Offset != 8 {
+			t.Errorf("saved offset %d, want 8", state.Offset)
+		}
+	}
+
+	server.failPuts = func(int) bool { return false }
+	server.puts = 0
+	digest, err := testChunkedUpload(ctx, store, path).run()
+	if err != nil {
+		t.Fatalf("unexpected error on resume: %v", err)
+	}
+	if server.sessions != 1 {
+		t.Errorf("resume started a new upload session")
+	}
+	if server.puts != 3 {
+		t.Errorf("resume sent %d chunks, want 3", server.puts)
+	}
+	if got := server.data.String(); got != content {
+		t.Errorf("server got '%s', want '%s'", got, content)
+	}
+	if digest != sha256String(content) {
+		t.Errorf("got digest %s, want %s", digest, sha256String(content))
+	}
+}
+
+func TestChunkedUploadResumeMismatch(t *testing.T) {
+	content := "0123456789"
+	path := writeTempFile(t, content)
+	defer os.Remove(path)
+
+	server := newUploadStub()
+	ctx := newTestContext(t, server)
+	server.failPuts = func(n int) bool { return n > 1 }
+
+	store := &memUploadStore{}
+	testChunkedUpload(ctx, store, path).run()
+
+	// The server lost the uploaded data, so the upload starts over.
+	server.data.Reset()
+	server.failPuts = func(int) bool { return false }
+	digest, err := testChunkedUpload(ctx, store, path).run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if server.sessions != 2 {
+		t.Errorf("expected a new upload session, got %d sessions", server.sessions)
+	}
+	if got := server.data.String(); got != content || digest != sha256String(content) {
+		t.Errorf("server got '%s' (digest %s), want '%s'", got, digest, content)
+	}
+}
+
+func TestChunkedUploadFallback(t *testing.T) {
+	content := "0123456789abcdefghij"
+	path := writeTempFile(t, content)
+	defer os.Remove(path)
+
+	// A server without upload sessions only has PUT /v1/files/{name}.
+	var got, query string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/files/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || strings.HasPrefix(r.URL.Path, "/v1/files/uploads") {
+			w.WriteHeader(404)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		got = r.URL.Path + " " + string(body)
+		query = r.URL.Query().Get("checksum")
+		w.WriteHeader(201)
+	})
+	ctx := newTestContext(t, mux)
+
+	u := testChunkedUpload(ctx, &memUploadStore{}, path)
+	u.args.versioned = true
+	digest, err := u.run()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "/v1/files/" + versionedFileName(path, digest) + " " + content; got != want {
+		t.Errorf("server got '%s', want '%s'", got, want)
+	}
+	if digest != sha256String(content) || query != digest {
+		t.Errorf("got digest %s and checksum %s, want %s", digest, query, sha256String(content))
+	}
+}
+
+func TestUploadKey(t *testing.T) {
+	path := writeTempFile(t, "abc")
+	defer os.Remove(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := uploadKey(1, path, info)
+	if !strings.HasPrefix(key, "1:") || !strings.Contains(key, path) {
+		t.Errorf("unexpected upload key: %s", key)
+	}
+	if key == uploadKey(2, path, info) {
+		t.Errorf("upload keys should differ by project")
+	}
+}
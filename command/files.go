@@ -1,13 +1,10 @@
 package command
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"flag"
 	"fmt"
-	"io"
-	"os"
 	"path/filepath"
+	"strings"
 )
 
 const (
@@ -33,9 +30,11 @@ func NewFilesCommand(ctx *Context) *Command {
 		Name:  keyFile,
 		Usage: "Commands for managing files on iobeam (e.g. app JARs).",
 		SubCommands: Mux{
-			"delete": newDeleteFileCmd(ctx),
-			"list":   newListFilesCmd(ctx),
-			"upload": newUploadFileCmd(ctx),
+			"delete":   newDeleteFileCmd(ctx),
+			"download": newDownloadFileCmd(ctx),
+			"list":     newListFilesCmd(ctx),
+			"sync":     newSyncFilesCmd(ctx),
+			"upload":   newUploadFileCmd(ctx),
 		},
 	}
 	cmd.NewFlagSet(flagSetNames[keyFile])
@@ -46,10 +45,44 @@ func NewFilesCommand(ctx *Context) *Command {
 type uploadFileArgs struct {
 	projectId uint64
 	path      string
+	// versioned stores the file under a name that includes its checksum, so
+	// uploading a new version does not overwrite the old one.
+	versioned bool
+	// chunkSize is the number of bytes sent per request; 0 means the default.
+	chunkSize int64
 }
 
 func (a *uploadFileArgs) IsValid() bool {
-	return len(a.path) > 0 && a.projectId > 0
+	return len(a.path) > 0 && a.projectId > 0 && a.chunkSize >= 0
+}
+
+// setChunkSizeFlag adds the -chunkSize flag to flags.
+func (a *uploadFileArgs) setChunkSizeFlag(flags *flag.FlagSet) {
+	flags.Int64Var(&a.chunkSize, "chunkSize", defaultChunkSize,
+		"Number of bytes to upload per request. Failed chunks are retried, and an interrupted upload resumes when run again.")
+}
+
+// serverFileName returns the name the file is stored under on the server,
+// given its SHA-256 digest.
+func (a *uploadFileArgs) serverFileName(digest string) string {
+	if a.versioned {
+		return versionedFileName(a.path, digest)
+	}
+	return filepath.Base(a.path)
+}
+
+// versionedFileName returns the base name of path with the first 12
+// characters of digest added before the extension, e.g. app-0123456789ab.jar.
+func versionedFileName(path, digest string) string {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	if strings.HasSuffix(strings.ToLower(base), ".tar.gz") {
+		ext = base[len(base)-len(".tar.gz"):]
+	}
+	if len(digest) > 12 {
+		digest = digest[:12]
+	}
+	return strings.TrimSuffix(base, ext) + "-" + digest + ext
 }
 
 func newUploadFileCmd(ctx *Context) *Command {
@@ -65,27 +98,11 @@ func newUploadFileCmd(ctx *Context) *Command {
 	flags := cmd.newFlagSetFile()
 	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject, "The ID of the project to upload the file to (defaults to active project).")
 	flags.StringVar(&args.path, "path", "", "Path to file to upload.")
+	args.setChunkSizeFlag(flags)
 
 	return cmd
 }
 
-func getFileSha256HashString(path string) (string, error) {
-
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
-	}
-	defer f.Close()
-
-	hash := sha256.New()
-
-	if _, err := io.Copy(hash, f); err != nil {
-		return "", err
-	}
-
-	return hex.EncodeToString(hash.Sum(nil)), nil
-}
-
 func uploadFile(c *Command, ctx *Context) error {
 	args := c.Data.(*uploadFileArgs)
 	_, err := _uploadFile(ctx, args)
@@ -95,33 +112,12 @@ func uploadFile(c *Command, ctx *Context) error {
 // _uploadFile does the actual file uploading and returns the checksum
 // of the file or an error
 func _uploadFile(ctx *Context, args *uploadFileArgs) (string, error) {
-	f, err := os.Open(args.path)
-	if err != nil {
-		fmt.Println("Could not open file for upload:")
-		return "", err
-	}
-	defer f.Close()
-	calculatedChecksum, err := getFileSha256HashString(args.path)
-
+	digest, err := newChunkedUpload(ctx, args).run()
 	if err != nil {
-		fmt.Printf("Error calculating checksum:\n")
 		return "", err
 	}
-
-	_, err = ctx.Client.
-		Put(getUrlForFileName(filepath.Base(args.path))).
-		Expect(201).
-		ProjectToken(ctx.Profile, args.projectId).
-		Param("checksum", calculatedChecksum).
-		Param("checksum_alg", "SHA-256").
-		BodyStream(f).
-		Execute()
-
-	if err == nil {
-		fmt.Printf("File '%s' uploaded successfully.\n", args.path)
-		return calculatedChecksum, nil
-	}
-	return "", err
+	fmt.Printf("File '%s' uploaded successfully.\n", args.path)
+	return digest, nil
 }
 
 type deleteFileArgs struct {
@@ -213,28 +209,51 @@ func (i *fileInfo) Print() {
 }
 
 func listFiles(c *Command, ctx *Context) error {
+	args := c.Data.(*listFilesArgs)
+	files, err := _getFiles(ctx, args.projectId)
+	if err != nil {
+		return err
+	}
+
+	if len(files) > 0 {
+		for _, info := range files {
+			info.Print()
+		}
+	} else {
+		fmt.Printf("No files found for project %d.\n", args.projectId)
+	}
+
+	return nil
+}
+
+func _getFiles(ctx *Context, projectId uint64) ([]fileInfo, error) {
 	type listResult struct {
 		Files []fileInfo `json:"files"`
 	}
-	args := c.Data.(*listFilesArgs)
 
+	list := new(listResult)
 	_, err := ctx.Client.
-		Get(c.ApiPath).
+		Get(baseApiPath[keyFile]).
 		Expect(200).
-		ProjectToken(ctx.Profile, args.projectId).
-		ResponseBody(new(listResult)).
+		ProjectToken(ctx.Profile, projectId).
+		ResponseBody(list).
 		ResponseBodyHandler(func(body interface{}) error {
-		list := body.(*listResult)
-		if len(list.Files) > 0 {
-			for _, info := range list.Files {
-				info.Print()
-			}
-		} else {
-			fmt.Printf("No files found for project %d.\n", args.projectId)
-		}
+			return nil
+		}).Execute()
 
-		return nil
-	}).Execute()
+	return list.Files, err
+}
 
-	return err
+// _getFileInfo returns the info of the file called name.
+func _getFileInfo(ctx *Context, projectId uint64, name string) (*fileInfo, error) {
+	files, err := _getFiles(ctx, projectId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		if files[i].Name == name {
+			return &files[i], nil
+		}
+	}
+	return nil, fmt.Errorf("No file named '%s' found in project %d.", name, projectId)
 }
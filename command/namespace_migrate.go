@@ -0,0 +1,343 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// fieldChange is a difference in one field between two schemas. From is
+// empty for added fields and To is empty for removed fields.
+type fieldChange struct {
+	Name string
+	From string
+	To   string
+}
+
+// schemaDiff is the difference between a namespace and a target schema.
+type schemaDiff struct {
+	Added   []fieldChange
+	Removed []fieldChange
+	Changed []fieldChange
+	// PartitioningFrom and PartitioningTo are set if the partitioning field
+	// changes.
+	PartitioningFrom string
+	PartitioningTo   string
+}
+
+// diffSchema compares the schema of ns with target. A target without a
+// partitioning field keeps the current one.
+func diffSchema(ns *namespaceData, target *namespaceSchema) *schemaDiff {
+	diff := new(schemaDiff)
+	for _, name := range sortedKeys(target.Fields) {
+		current, ok := ns.Fields[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, fieldChange{Name: name, To: target.Fields[name]})
+		case current != target.Fields[name]:
+			diff.Changed = append(diff.Changed, fieldChange{Name: name, From: current, To: target.Fields[name]})
+		}
+	}
+	for _, name := range sortedKeys(ns.Fields) {
+		if _, ok := target.Fields[name]; !ok {
+			diff.Removed = append(diff.Removed, fieldChange{Name: name, From: ns.Fields[name]})
+		}
+	}
+	if len(target.PartitioningField) > 0 && target.PartitioningField != ns.PartitioningField {
+		diff.PartitioningFrom = ns.PartitioningField
+		diff.PartitioningTo = target.PartitioningField
+	}
+	return diff
+}
+
+func (d *schemaDiff) isEmpty() bool {
+	return len(d.Added) == 0 && d.inPlace()
+}
+
+// inPlace reports whether the namespace can be changed with 'namespace
+// update', which can only add fields.
+func (d *schemaDiff) inPlace() bool {
+	return len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.PartitioningTo) == 0
+}
+
+// conversionNote describes what can go wrong when converting values of type
+// from to type to, or returns "" if every value converts.
+func conversionNote(from, to string) string {
+	switch {
+	case to == typeString, from == typeLong && to == typeDouble:
+		return ""
+	case from == typeDouble && to == typeLong:
+		return "values with a fraction cannot be converted"
+	case from == typeString:
+		return "only values that parse as " + to + " can be converted"
+	case to == typeBoolean:
+		return "only 0 and 1 can be converted"
+	}
+	return "values cannot be converted"
+}
+
+func (d *schemaDiff) String() string {
+	var buffer bytes.Buffer
+	for _, c := range d.Added {
+		buffer.WriteString(fmt.Sprintf("+ %s %s\n", c.Name, c.To))
+	}
+	for _, c := range d.Removed {
+		buffer.WriteString(fmt.Sprintf("- %s %s (its data is not copied)\n", c.Name, c.From))
+	}
+	for _, c := range d.Changed {
+		line := fmt.Sprintf("~ %s %s -> %s", c.Name, c.From, c.To)
+		if note := conversionNote(c.From, c.To); len(note) > 0 {
+			line += " (" + note + ")"
+		}
+		buffer.WriteString(line + "\n")
+	}
+	if len(d.PartitioningTo) > 0 {
+		buffer.WriteString(fmt.Sprintf("~ partitioning field %s -> %s\n", d.PartitioningFrom, d.PartitioningTo))
+	}
+	return buffer.String()
+}
+
+func readNamespaceSchema(path string) (*namespaceSchema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := parseNamespaceSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schema file '%s': %v", path, err)
+	}
+	if len(schema.Fields) == 0 {
+		return nil, fmt.Errorf("Schema file '%s' has no fields.", path)
+	}
+	return schema, nil
+}
+
+type diffNamespaceArgs struct {
+	baseNamespaceArgs
+	schemaFile string
+}
+
+func (a *diffNamespaceArgs) IsValid() bool {
+	return a.baseNamespaceArgs.IsValid() && len(a.schemaFile) > 0
+}
+
+func newDiffNamespaceCmd(ctx *Context) *Command {
+	args := new(diffNamespaceArgs)
+	cmd := &Command{
+		Name: "diff",
+		// ApiPath determined by flags
+		Usage:  "Show how a schema file differs from a namespace.",
+		Data:   args,
+		Action: diffNamespace,
+	}
+	args.setFlags(cmd, ctx, "compare")
+	cmd.flags.StringVar(&args.schemaFile, "schema", "", "YAML schema file to compare with (REQUIRED)")
+
+	return cmd
+}
+
+func diffNamespace(c *Command, ctx *Context) error {
+	args := c.Data.(*diffNamespaceArgs)
+	schema, err := readNamespaceSchema(args.schemaFile)
+	if err != nil {
+		return err
+	}
+	ns, err := _getNamespace(ctx, &args.baseNamespaceArgs)
+	if err != nil {
+		return err
+	}
+
+	diff := diffSchema(ns, schema)
+	if diff.isEmpty() {
+		fmt.Printf("Namespace '%s' matches the schema.\n", ns.Name)
+		return nil
+	}
+	fmt.Print(diff)
+	if diff.inPlace() {
+		fmt.Println("\nThese changes can be made with 'namespace update'.")
+	} else {
+		fmt.Println("\nThese changes cannot be made in place, use 'namespace migrate' to copy the data to a new namespace.")
+	}
+	return nil
+}
+
+type migrateNamespaceArgs struct {
+	baseNamespaceArgs
+	schemaFile  string
+	to          string
+	from        string
+	window      time.Duration
+	limit       int
+	batchSize   int
+	skipInvalid bool
+	dryRun      bool
+}
+
+func (a *migrateNamespaceArgs) IsValid() bool {
+	fromOk := len(a.from) == 0
+	if !fromOk {
+		_, err := parseTimeArg(a.from, time.Now())
+		fromOk = err == nil
+	}
+	return a.baseNamespaceArgs.IsValid() && len(a.schemaFile) > 0 && fromOk &&
+		a.window > 0 && a.window <= maxDataWindow && a.limit > 0 && a.batchSize > 0
+}
+
+func newMigrateNamespaceCmd(ctx *Context) *Command {
+	args := new(migrateNamespaceArgs)
+	cmd := &Command{
+		Name: "migrate",
+		// ApiPath determined by flags
+		Usage: "Create a new namespace from a schema file and copy the data of a namespace to it, " +
+			"converting values to the new field types. The old namespace is kept.",
+		Data:   args,
+		Action: migrateNamespace,
+	}
+	args.setFlags(cmd, ctx, "migrate")
+	flags := cmd.flags
+	flags.StringVar(&args.schemaFile, "schema", "", "YAML schema file of the new namespace (REQUIRED)")
+	flags.StringVar(&args.to, "to", "", "Name of the new namespace (defaults to the name in the schema file)")
+	flags.StringVar(&args.from, "from", "", "Copy data from this time (ex. 2016-01-02T15:04:05Z or 720h; defaults to when the namespace was created)")
+	flags.DurationVar(&args.window, "window", maxDataWindow, "Time range to read per query (at most 24h).")
+	flags.IntVar(&args.limit, "limit", defaultDataLimit, "Maximum rows per query; windows with more rows are split.")
+	flags.IntVar(&args.batchSize, "batchSize", defaultBatchSize, "Rows per import request.")
+	flags.BoolVar(&args.skipInvalid, "skipInvalid", false, "Skip rows with values that cannot be converted instead of stopping.")
+	flags.BoolVar(&args.dryRun, "dry-run", false, "Only show the changes.")
+
+	return cmd
+}
+
+// migrationStart returns the time to copy data from: -from if set, or when
+// ns was created.
+func (a *migrateNamespaceArgs) migrationStart(ns *namespaceData, now time.Time) (time.Time, error) {
+	if len(a.from) > 0 {
+		return parseTimeArg(a.from, now)
+	}
+	if t, ok := parseCreated(ns.Created); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("Cannot tell when namespace '%s' was created ('%s'), use -from.", ns.Name, ns.Created)
+}
+
+// parseCreated parses a creation time as returned by the API.
+func parseCreated(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func migrateNamespace(c *Command, ctx *Context) error {
+	args := c.Data.(*migrateNamespaceArgs)
+	schema, err := readNamespaceSchema(args.schemaFile)
+	if err != nil {
+		return err
+	}
+	if len(args.to) > 0 {
+		schema.Name = args.to
+	}
+	ns, err := _getNamespace(ctx, &args.baseNamespaceArgs)
+	if err != nil {
+		return err
+	}
+	if len(schema.PartitioningField) == 0 {
+		schema.PartitioningField = ns.PartitioningField
+	}
+	if len(schema.Name) == 0 || schema.Name == ns.Name {
+		return fmt.Errorf("The new namespace needs a different name than '%s', use -to.", ns.Name)
+	}
+
+	now := time.Now()
+	start, err := args.migrationStart(ns, now)
+	if err != nil {
+		return err
+	}
+
+	diff := diffSchema(ns, schema)
+	fmt.Printf("Migrating '%s' to new namespace '%s':\n", ns.Name, schema.Name)
+	fmt.Print(diff)
+	if args.dryRun {
+		fmt.Println("Dry run, nothing was changed.")
+		return nil
+	}
+
+	if err := _createNamespaceFromSchema(ctx, args.projectId, schema); err != nil {
+		return err
+	}
+	fmt.Printf("Namespace '%s' created.\n", schema.Name)
+
+	copied, skipped := 0, 0
+	stream := &dataStream{
+		projectId: args.projectId,
+		namespace: ns.Name,
+		from:      start,
+		to:        now,
+		window:    args.window,
+		limit:     args.limit,
+	}
+	err = stream.run(ctx, func(rows []dataRow, end time.Time) error {
+		converted := make([]dataRow, 0, len(rows))
+		for _, row := range rows {
+			out, err := convertRow(row, schema.Fields)
+			if err != nil && args.skipInvalid {
+				skipped++
+				continue
+			} else if err != nil {
+				return fmt.Errorf("Cannot convert row at time %v: %v (use -skipInvalid to skip such rows)", row[fieldTime], err)
+			}
+			converted = append(converted, out)
+		}
+		if err := _importRows(ctx, args.projectId, schema.Name, converted, nil, args.batchSize); err != nil {
+			return err
+		}
+
+		copied += len(converted)
+		if len(rows) > 0 {
+			fmt.Printf("Copied %d rows up to %s (%.0f%% of time range)\n",
+				copied, end.UTC().Format(time.RFC3339), timeProgress(start, now, end)*100)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Migration stopped after %d rows: %v\n"+
+			"Namespace '%s' was kept; delete it before running the migration again.", copied, err, schema.Name)
+	}
+
+	fmt.Printf("Migration done: %d rows copied", copied)
+	if skipped > 0 {
+		fmt.Printf(", %d rows skipped", skipped)
+	}
+	fmt.Printf(".\nNamespace '%s' was kept; delete it with 'namespace delete -name %s' when it is no longer needed.\n",
+		ns.Name, ns.Name)
+	return nil
+}
+
+// timeProgress returns how far at is between start and end, from 0 to 1.
+func timeProgress(start, end, at time.Time) float64 {
+	total := end.Sub(start)
+	if total <= 0 {
+		return 1
+	}
+	return float64(at.Sub(start)) / float64(total)
+}
+
+// _createNamespaceFromSchema creates a namespace from schema.
+func _createNamespaceFromSchema(ctx *Context, projectId uint64, schema *namespaceSchema) error {
+	ns := &namespaceData{
+		ProjectId:         projectId,
+		Name:              schema.Name,
+		PartitioningField: schema.PartitioningField,
+		Fields:            schema.Fields,
+		Labels:            schema.Labels,
+	}
+	_, err := ctx.Client.
+		Post(baseApiPath[keyNamespace]).
+		ProjectToken(ctx.Profile, projectId).
+		Body(ns).
+		Expect(201).
+		Execute()
+	return err
+}
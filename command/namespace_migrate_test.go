@@ -0,0 +1,133 @@
+package command
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffSchema(t *testing.T) {
+	ns := &namespaceData{
+		Name:              "input",
+		PartitioningField: "device_id",
+		Fields: map[string]string{
+			"device_id": typeString,
+			"temp":      typeLong,
+			"old":       typeDouble,
+			"same":      typeBoolean,
+		},
+	}
+
+	cases := []struct {
+		desc    string
+		target  *namespaceSchema
+		want    string
+		inPlace bool
+	}{
+		{
+			desc: "no changes",
+			target: &namespaceSchema{Fields: map[string]string{
+				"device_id": typeString, "temp": typeLong, "old": typeDouble, "same": typeBoolean,
+			}},
+			want:    "",
+			inPlace: true,
+		},
+		{
+			desc: "only added",
+			target: &namespaceSchema{Fields: map[string]string{
+				"device_id": typeString, "temp": typeLong, "old": typeDouble, "same": typeBoolean, "new": typeString,
+			}},
+			want:    "+ new STRING\n",
+			inPlace: true,
+		},
+		{
+			desc: "all kinds",
+			target: &namespaceSchema{
+				PartitioningField: "site",
+				Fields: map[string]string{
+					"device_id": typeString, "temp": typeDouble, "same": typeLong, "site": typeString,
+				},
+			},
+			want: "+ site STRING\n" +
+				"- old DOUBLE (its data is not copied)\n" +
+				"~ same BOOLEAN -> LONG (values cannot be converted)\n" +
+				"~ temp LONG -> DOUBLE\n" +
+				"~ partitioning field device_id -> site\n",
+			inPlace: false,
+		},
+	}
+	for _, c := range cases {
+		diff := diffSchema(ns, c.target)
+		if got := diff.String(); got != c.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.desc, got, c.want)
+		}
+		if diff.inPlace() != c.inPlace {
+			t.Errorf("%s: got inPlace %v, want %v", c.desc, diff.inPlace(), c.inPlace)
+		}
+		if diff.isEmpty() != (len(c.want) == 0) {
+			t.Errorf("%s: unexpected isEmpty %v", c.desc, diff.isEmpty())
+		}
+	}
+}
+
+func TestConversionNote(t *testing.T) {
+	cases := []struct {
+		from, to, want string
+	}{
+		{typeLong, typeDouble, ""},
+		{typeBoolean, typeString, ""},
+		{typeDouble, typeLong, "values with a fraction cannot be converted"},
+		{typeString, typeLong, "only values that parse as LONG can be converted"},
+		{typeLong, typeBoolean, "only 0 and 1 can be converted"},
+	}
+	for _, c := range cases {
+		if got := conversionNote(c.from, c.to); got != c.want {
+			t.Errorf("conversionNote(%s, %s): got '%s', want '%s'", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestMigrateNamespaceArgsValidity(t *testing.T) {
+	valid := func() *migrateNamespaceArgs {
+		return &migrateNamespaceArgs{
+			baseNamespaceArgs: baseNamespaceArgs{projectId: 1, name: "input"},
+			schemaFile:        "new.yaml",
+			window:            time.Hour,
+			limit:             10,
+			batchSize:         10,
+		}
+	}
+	badFrom := valid()
+	badFrom.from = "yesterday"
+	bigWindow := valid()
+	bigWindow.window = 48 * time.Hour
+	noSchema := valid()
+	noSchema.schemaFile = ""
+
+	cases := []dataTestCase{
+		{desc: "valid", in: valid(), want: true},
+		{desc: "invalid, bad from", in: badFrom, want: false},
+		{desc: "invalid, window too big", in: bigWindow, want: false},
+		{desc: "invalid, no schema", in: noSchema, want: false},
+	}
+	runDataTestCase(t, cases)
+}
+
+func TestMigrationStart(t *testing.T) {
+	now := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	args := &migrateNamespaceArgs{}
+
+	got, err := args.migrationStart(&namespaceData{Created: "2016-01-02 03:04:05"}, now)
+	if err != nil || !got.Equal(time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected start from created: %v, %v", got, err)
+	}
+
+	if _, err := args.migrationStart(&namespaceData{Created: "?"}, now); err == nil {
+		t.Errorf("expected error for unknown created time")
+	}
+
+	args.from = "24h"
+	got, err = args.migrationStart(&namespaceData{}, now)
+	if err != nil || !got.Equal(now.Add(-24*time.Hour)) {
+		t.Errorf("unexpected start from -from: %v, %v", got, err)
+	}
+}
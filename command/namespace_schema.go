@@ -0,0 +1,456 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	typeDouble  = "DOUBLE"
+	typeLong    = "LONG"
+	typeBoolean = "BOOLEAN"
+	typeString  = "STRING"
+
+	sampleFormatCsv    = "csv"
+	sampleFormatNdjson = "ndjson"
+
+	defaultSampleRows = 1000
+	// maxDistinctValues limits how many distinct values are remembered per
+	// column when looking for a partitioning field.
+	maxDistinctValues = 1000
+)
+
+var sampleFormats = []string{sampleFormatCsv, sampleFormatNdjson}
+
+// namespaceSchema is the format of schema files used by 'namespace create
+// -schema' and written by 'namespace infer'.
+type namespaceSchema struct {
+	Name              string                 `yaml:"name,omitempty"`
+	PartitioningField string                 `yaml:"partitioning_field,omitempty"`
+	Fields            map[string]string      `yaml:"fields"`
+	Labels            map[string]interface{} `yaml:"labels,omitempty"`
+}
+
+// parseNamespaceSchema parses and checks a schema file.
+func parseNamespaceSchema(data []byte) (*namespaceSchema, error) {
+	schema := new(namespaceSchema)
+	if err := yaml.UnmarshalStrict(data, schema); err != nil {
+		return nil, err
+	}
+	if err := schema.check(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// check checks the field types and label values of s.
+func (s *namespaceSchema) check() error {
+	for _, name := range sortedKeys(s.Fields) {
+		if !IsValidTypeString(s.Fields[name]) {
+			return fmt.Errorf("Bad type %s on field %s", s.Fields[name], name)
+		}
+	}
+	for name, value := range s.Labels {
+		switch value.(type) {
+		case map[interface{}]interface{}, []interface{}, nil:
+			return fmt.Errorf("value of label '%s' must be a string, number or boolean", name)
+		}
+	}
+	return nil
+}
+
+// applySchemaFile reads the schema file of d and uses it for the name,
+// partitioning field, fields and labels of the namespace. Values given with
+// flags take precedence.
+func (d *createNamespaceData) applySchemaFile() error {
+	data, err := ioutil.ReadFile(d.schemaFile)
+	if err != nil {
+		return err
+	}
+	schema, err := parseNamespaceSchema(data)
+	if err != nil {
+		return fmt.Errorf("Invalid schema file '%s': %v", d.schemaFile, err)
+	}
+
+	if len(d.Name) == 0 {
+		d.Name = schema.Name
+	}
+	if len(d.PartitioningField) == 0 {
+		d.PartitioningField = schema.PartitioningField
+	}
+	fields := make(map[string]string)
+	for name, t := range schema.Fields {
+		fields[name] = t
+	}
+	for name, t := range d.Fields {
+		fields[name] = t
+	}
+	d.Fields = fields
+
+	if len(schema.Labels) > 0 {
+		labels := make(map[string]interface{})
+		for name, value := range schema.Labels {
+			labels[name] = value
+		}
+		for name, value := range d.Labels {
+			labels[name] = value
+		}
+		d.Labels = labels
+	}
+	return nil
+}
+
+// classifyValue returns the iobeam type of a value read as text, or "" for
+// empty values, which are treated as missing.
+func classifyValue(value string) string {
+	value = strings.TrimSpace(value)
+	switch {
+	case len(value) == 0:
+		return ""
+	case IsValidBoolean(value):
+		return typeBoolean
+	}
+	if IsValidLong(value) {
+		if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return typeLong
+		}
+	}
+	// ParseFloat also takes exponents, leading dots and integers too large
+	// for a LONG, but hex, NaN and Inf are not numbers in JSON or CSV data.
+	if f, err := strconv.ParseFloat(value, 64); err == nil &&
+		!math.IsInf(f, 0) && !math.IsNaN(f) && !strings.ContainsAny(value, "xXnN") {
+		return typeDouble
+	}
+	// Everything else, including quoted values (IsValidString), is a string.
+	return typeString
+}
+
+// widenType returns a type that can hold values of both types a and b.
+func widenType(a, b string) string {
+	switch {
+	case len(a) == 0:
+		return b
+	case len(b) == 0, a == b:
+		return a
+	case (a == typeLong && b == typeDouble) || (a == typeDouble && b == typeLong):
+		return typeDouble
+	}
+	return typeString
+}
+
+// columnStats collects what was seen in a column of the sample data.
+type columnStats struct {
+	typ      string
+	seen     map[string]bool // all types seen, to report widened columns
+	present  int
+	distinct map[string]struct{}
+}
+
+// schemaInferrer proposes a namespace schema from sample rows.
+type schemaInferrer struct {
+	rows    int
+	columns map[string]*columnStats
+}
+
+func newSchemaInferrer() *schemaInferrer {
+	return &schemaInferrer{columns: make(map[string]*columnStats)}
+}
+
+// observe records a value of type typ (as returned by classifyValue) in
+// column name. raw is the value as text.
+func (s *schemaInferrer) observe(name, typ, raw string) {
+	col, ok := s.columns[name]
+	if !ok {
+		col = &columnStats{seen: make(map[string]bool), distinct: make(map[string]struct{})}
+		s.columns[name] = col
+	}
+	if len(typ) == 0 {
+		return
+	}
+	col.typ = widenType(col.typ, typ)
+	col.seen[typ] = true
+	col.present++
+	if len(col.distinct) < maxDistinctValues {
+		col.distinct[raw] = struct{}{}
+	}
+}
+
+// schema returns the proposed schema. Implicit fields (e.g. time) are left
+// out, and columns without any values are STRING.
+func (s *schemaInferrer) schema() *namespaceSchema {
+	schema := &namespaceSchema{Fields: make(map[string]string)}
+	for name, col := range s.columns {
+		if isInList(name, implicitFields) {
+			continue
+		}
+		schema.Fields[name] = col.typ
+		if len(col.typ) == 0 {
+			schema.Fields[name] = typeString
+		}
+	}
+	schema.PartitioningField = s.suggestPartitioningField()
+	return schema
+}
+
+// suggestPartitioningField returns the column that best identifies the
+// source of rows: a column called device_id, a column whose name looks like
+// an ID, or otherwise the string column with the fewest distinct values. Only
+// STRING and LONG columns with a value in every row are considered.
+func (s *schemaInferrer) suggestPartitioningField() string {
+	var candidates []string
+	for name, col := range s.columns {
+		if isInList(name, implicitFields) || col.present < s.rows {
+			continue
+		}
+		if col.typ == typeString || col.typ == typeLong {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+
+	for _, name := range candidates {
+		if name == "device_id" {
+			return name
+		}
+	}
+	for _, name := range candidates {
+		lower := strings.ToLower(name)
+		if lower == "id" || lower == "device" || strings.HasSuffix(lower, "_id") {
+			return name
+		}
+	}
+	best := ""
+	for _, name := range candidates {
+		n := len(s.columns[name].distinct)
+		if s.columns[name].typ != typeString || n < 2 {
+			continue
+		}
+		if len(best) == 0 || n < len(s.columns[best].distinct) {
+			best = name
+		}
+	}
+	return best
+}
+
+// notes returns remarks about how the schema was inferred, e.g. which
+// columns had their type widened.
+func (s *schemaInferrer) notes() []string {
+	var notes []string
+	names := make([]string, 0, len(s.columns))
+	for name := range s.columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		col := s.columns[name]
+		switch {
+		case isInList(name, implicitFields):
+			notes = append(notes, fmt.Sprintf("'%s' is implicit in every namespace and was left out", name))
+		case len(col.typ) == 0:
+			notes = append(notes, fmt.Sprintf("'%s' has no values, assuming %s", name, typeString))
+		case len(col.seen) > 1:
+			seen := make([]string, 0, len(col.seen))
+			for t := range col.seen {
+				seen = append(seen, t)
+			}
+			sort.Strings(seen)
+			notes = append(notes, fmt.Sprintf("'%s' mixes %s values, using %s", name, strings.Join(seen, " and "), col.typ))
+		}
+	}
+	return notes
+}
+
+// readCsvSample reads up to maxRows rows of CSV with a header row into s.
+func (s *schemaInferrer) readCsvSample(r io.Reader, maxRows int) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("Could not read CSV header: %v", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+		s.observe(header[i], "", "")
+	}
+
+	for s.rows < maxRows {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(record) > len(header) {
+			return fmt.Errorf("Row %d has %d values, but there are %d columns", s.rows+2, len(record), len(header))
+		}
+		s.rows++
+		for i, value := range record {
+			s.observe(header[i], classifyValue(value), strings.TrimSpace(value))
+		}
+	}
+	return nil
+}
+
+// readNdjsonSample reads up to maxRows JSON objects, one per line, into s.
+func (s *schemaInferrer) readNdjsonSample(r io.Reader, maxRows int) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for s.rows < maxRows && scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.UseNumber()
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err != nil {
+			return fmt.Errorf("Line %d is not a JSON object: %v", line, err)
+		}
+		s.rows++
+		for name, value := range row {
+			switch v := value.(type) {
+			case nil:
+				s.observe(name, "", "")
+			case bool:
+				s.observe(name, typeBoolean, strconv.FormatBool(v))
+			case string:
+				s.observe(name, typeString, v)
+			case json.Number:
+				s.observe(name, classifyValue(v.String()), v.String())
+			default:
+				return fmt.Errorf("Line %d: field '%s' has a nested value, which is not supported", line, name)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// detectSampleFormat returns the format of a sample file based on its
+// extension, or "" if it is not known.
+func detectSampleFormat(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".csv"):
+		return sampleFormatCsv
+	case strings.HasSuffix(lower, ".ndjson"), strings.HasSuffix(lower, ".jsonl"):
+		return sampleFormatNdjson
+	}
+	return ""
+}
+
+type inferNamespaceArgs struct {
+	file   string
+	format string
+	name   string
+	rows   int
+	out    string
+}
+
+func (a *inferNamespaceArgs) IsValid() bool {
+	formatOk := len(a.format) == 0 || isInList(a.format, sampleFormats)
+	return len(a.file) > 0 && a.rows > 0 && formatOk
+}
+
+func newInferNamespaceCmd(ctx *Context) *Command {
+	args := new(inferNamespaceArgs)
+	cmd := &Command{
+		Name: "infer",
+		Usage: "Propose a namespace schema from sample data. " +
+			"The output can be used with 'namespace create -schema'.",
+		Data:   args,
+		Action: inferNamespace,
+	}
+
+	flags := cmd.NewFlagSet("iobeam namespace infer")
+	flags.StringVar(&args.file, "file", "", "Sample data file, CSV with a header row or newline delimited JSON (REQUIRED)")
+	flags.StringVar(&args.format, "format", "", "Format of the sample: "+strings.Join(sampleFormats, ", ")+
+		" (detected from the file extension by default)")
+	flags.StringVar(&args.name, "name", "", "Namespace name to put in the schema.")
+	flags.IntVar(&args.rows, "rows", defaultSampleRows, "Maximum number of rows to scan.")
+	flags.StringVar(&args.out, "out", "", "File to write the schema to (defaults to std out).")
+
+	return cmd
+}
+
+func inferNamespace(c *Command, ctx *Context) error {
+	args := c.Data.(*inferNamespaceArgs)
+	format := args.format
+	if len(format) == 0 {
+		format = detectSampleFormat(args.file)
+	}
+	if len(format) == 0 {
+		return fmt.Errorf("Cannot tell the format of '%s', use -format.", args.file)
+	}
+
+	f, err := os.Open(args.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	inferrer := newSchemaInferrer()
+	if format == sampleFormatCsv {
+		err = inferrer.readCsvSample(f, args.rows)
+	} else {
+		err = inferrer.readNdjsonSample(f, args.rows)
+	}
+	if err != nil {
+		return err
+	}
+	if inferrer.rows == 0 {
+		return fmt.Errorf("No rows found in '%s'.", args.file)
+	}
+
+	out, err := inferrer.render(args.name, args.file)
+	if err != nil {
+		return err
+	}
+	if len(args.out) == 0 {
+		fmt.Print(out)
+		return nil
+	}
+	if err := ioutil.WriteFile(args.out, []byte(out), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Schema written to '%s'.\n", args.out)
+	return nil
+}
+
+// render returns the proposed schema as YAML, with notes on how it was
+// inferred as comments.
+func (s *schemaInferrer) render(name, source string) (string, error) {
+	schema := s.schema()
+	schema.Name = name
+	data, err := yaml.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("# Schema inferred from %d rows of %s\n", s.rows, source))
+	for _, note := range s.notes() {
+		buffer.WriteString("# " + note + "\n")
+	}
+	if len(schema.PartitioningField) == 0 {
+		buffer.WriteString("# No partitioning field could be suggested, please set partitioning_field\n")
+	}
+	buffer.Write(data)
+	return buffer.String(), nil
+}
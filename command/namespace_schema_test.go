@@ -0,0 +1,238 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCreateNamespaceDataValidity(t *testing.T) {
+	cases := []dataTestCase{
+		{
+			desc: "valid with flags",
+			in: &createNamespaceData{namespaceData: namespaceData{
+				ProjectId:         1,
+				Name:              "input",
+				PartitioningField: "device_id",
+				fieldsStrs:        setFlags{"device_id:STRING": {}},
+			}},
+			want: true,
+		},
+		{
+			desc: "valid with schema",
+			in: &createNamespaceData{
+				namespaceData: namespaceData{ProjectId: 1},
+				schemaFile:    "schema.yaml",
+			},
+			want: true,
+		},
+		{
+			desc: "invalid, no fields",
+			in: &createNamespaceData{namespaceData: namespaceData{
+				ProjectId:         1,
+				Name:              "input",
+				PartitioningField: "device_id",
+			}},
+			want: false,
+		},
+		{
+			desc: testDescInvalidProjectId,
+			in:   &createNamespaceData{schemaFile: "schema.yaml"},
+			want: false,
+		},
+	}
+	runDataTestCase(t, cases)
+}
+
+func TestParseNamespaceSchema(t *testing.T) {
+	cases := []struct {
+		desc    string
+		in      string
+		wantErr bool
+	}{
+		{
+			desc: "valid",
+			in:   "name: input\npartitioning_field: device_id\nfields:\n  device_id: STRING\n  temp: DOUBLE\nlabels:\n  zone: eu\n",
+		},
+		{desc: "bad type", in: "fields:\n  temp: FLOAT\n", wantErr: true},
+		{desc: "unknown key", in: "fieldz:\n  temp: DOUBLE\n", wantErr: true},
+		{desc: "nested label", in: "fields:\n  temp: DOUBLE\nlabels:\n  a:\n    b: c\n", wantErr: true},
+	}
+	for _, c := range cases {
+		_, err := parseNamespaceSchema([]byte(c.in))
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: unexpected error: %v", c.desc, err)
+		}
+	}
+}
+
+func TestApplySchemaFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "iobeam-schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("name: input\npartitioning_field: device_id\nfields:\n  device_id: STRING\n  temp: LONG\nlabels:\n  zone: eu\n")
+	f.Close()
+
+	d := &createNamespaceData{
+		namespaceData: namespaceData{
+			Name:   "override",
+			Fields: map[string]string{"temp": "DOUBLE"},
+			Labels: map[string]interface{}{"owner": "ops"},
+		},
+		schemaFile: f.Name(),
+	}
+	if err := d.applySchemaFile(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Name != "override" || d.PartitioningField != "device_id" {
+		t.Errorf("unexpected name/partitioning: %s/%s", d.Name, d.PartitioningField)
+	}
+	if fmt.Sprint(d.Fields) != "map[device_id:STRING temp:DOUBLE]" {
+		t.Errorf("unexpected fields: %v", d.Fields)
+	}
+	if fmt.Sprint(d.Labels) != "map[owner:ops zone:eu]" {
+		t.Errorf("unexpected labels: %v", d.Labels)
+	}
+}
+
+func TestClassifyValue(t *testing.T) {
+	cases := map[string]string{
+		"":                     "",
+		"  ":                   "",
+		"12":                   typeLong,
+		"-3":                   typeLong,
+		"1.5":                  typeDouble,
+		"true":                 typeBoolean,
+		"FALSE":                typeBoolean,
+		"abc":                  typeString,
+		"\"12\"":               typeString,
+		"12a34":                typeString,
+		"1.2.3":                typeString,
+		" 42 ":                 typeLong,
+		"device1":              typeString,
+		"1e5":                  typeDouble,
+		".5":                   typeDouble,
+		"-2.5E-3":              typeDouble,
+		"99999999999999999999": typeDouble,
+		"1e400":                typeString,
+		"NaN":                  typeString,
+		"Inf":                  typeString,
+		"0x1p-2":               typeString,
+	}
+	for in, want := range cases {
+		if got := classifyValue(in); got != want {
+			t.Errorf("classifyValue(%q): got %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestWidenType(t *testing.T) {
+	cases := []struct {
+		a, b, want string
+	}{
+		{"", typeLong, typeLong},
+		{typeLong, "", typeLong},
+		{typeLong, typeLong, typeLong},
+		{typeLong, typeDouble, typeDouble},
+		{typeDouble, typeLong, typeDouble},
+		{typeLong, typeBoolean, typeString},
+		{typeDouble, typeString, typeString},
+	}
+	for _, c := range cases {
+		if got := widenType(c.a, c.b); got != c.want {
+			t.Errorf("widenType(%s, %s): got %s, want %s", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestInferSchemaCsv(t *testing.T) {
+	sample := "time,device_id,temp,count,on,note\n" +
+		"1,dev1,21,3,true,\n" +
+		"2,dev2,21.5,4,false,x\n" +
+		"3,dev1,22,5,true,\n"
+	s := newSchemaInferrer()
+	if err := s.readCsvSample(strings.NewReader(sample), 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	schema := s.schema()
+	want := "map[count:LONG device_id:STRING note:STRING on:BOOLEAN temp:DOUBLE]"
+	if got := fmt.Sprint(schema.Fields); got != want {
+		t.Errorf("got fields %s, want %s", got, want)
+	}
+	if schema.PartitioningField != "device_id" {
+		t.Errorf("got partitioning field '%s', want device_id", schema.PartitioningField)
+	}
+
+	notes := strings.Join(s.notes(), "\n")
+	if !strings.Contains(notes, "'temp' mixes DOUBLE and LONG values, using DOUBLE") {
+		t.Errorf("missing widening note in:\n%s", notes)
+	}
+	if !strings.Contains(notes, "'time' is implicit") {
+		t.Errorf("missing time note in:\n%s", notes)
+	}
+}
+
+func TestInferSchemaCsvMaxRows(t *testing.T) {
+	sample := "a\n1\n2\nx\n"
+	s := newSchemaInferrer()
+	if err := s.readCsvSample(strings.NewReader(sample), 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.rows != 2 || s.schema().Fields["a"] != typeLong {
+		t.Errorf("expected 2 LONG rows, got %d rows of %s", s.rows, s.schema().Fields["a"])
+	}
+}
+
+func TestInferSchemaNdjson(t *testing.T) {
+	sample := `{"sensor": "a", "temp": 1, "ok": true}` + "\n" +
+		"\n" +
+		`{"sensor": "b", "temp": 1.5, "ok": false, "extra": null}` + "\n" +
+		`{"sensor": "a", "temp": 2, "ok": true}` + "\n"
+	s := newSchemaInferrer()
+	if err := s.readNdjsonSample(strings.NewReader(sample), 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	schema := s.schema()
+	want := "map[extra:STRING ok:BOOLEAN sensor:STRING temp:DOUBLE]"
+	if got := fmt.Sprint(schema.Fields); got != want {
+		t.Errorf("got fields %s, want %s", got, want)
+	}
+	if schema.PartitioningField != "sensor" {
+		t.Errorf("got partitioning field '%s', want sensor", schema.PartitioningField)
+	}
+
+	s = newSchemaInferrer()
+	if err := s.readNdjsonSample(strings.NewReader(`{"a": {"b": 1}}`), 100); err == nil {
+		t.Errorf("expected error for nested value")
+	}
+}
+
+func TestInferSchemaRender(t *testing.T) {
+	s := newSchemaInferrer()
+	s.readCsvSample(strings.NewReader("device_id,temp\nd1,1\nd2,2\n"), 100)
+	out, err := s.render("input", "sample.csv")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "# Schema inferred from 2 rows of sample.csv\n" +
+		"name: input\n" +
+		"partitioning_field: device_id\n" +
+		"fields:\n" +
+		"  device_id: STRING\n" +
+		"  temp: LONG\n"
+	if out != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+
+	// The rendered schema can be used to create a namespace.
+	if _, err := parseNamespaceSchema([]byte(out)); err != nil {
+		t.Errorf("rendered schema does not parse: %v", err)
+	}
+}
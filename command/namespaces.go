@@ -4,10 +4,23 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+const (
+	keyNamespace = "namespace"
+)
+
+func init() {
+	baseApiPath[keyNamespace] = "/v1/namespaces/"
+}
+
+func getUrlForNamespaceId(id uint64) string {
+	return baseApiPath[keyNamespace] + strconv.FormatUint(id, 10)
+}
+
 type namespaceData struct {
 	ProjectId         uint64                 `json:"project_id"`
 	Name              string                 `json:"namespace_name"`
@@ -32,14 +45,18 @@ type updateNamespaceData struct {
 }
 
 func (d *updateNamespaceData) IsValid() bool {
-	return len(d.fieldsStrs) > 0 && d.NamespaceId > 0 && d.ProjectId > 0
+	return len(d.fieldsStrs) > 0 && (d.NamespaceId > 0 || len(d.Name) > 0) && d.ProjectId > 0
 }
 
 type createNamespaceData struct {
 	namespaceData
+	schemaFile string
 }
 
 func (d *createNamespaceData) IsValid() bool {
+	if len(d.schemaFile) > 0 {
+		return d.ProjectId > 0
+	}
 	return len(d.Name) > 0 && len(d.PartitioningField) > 0 && len(d.fieldsStrs) > 0 && d.ProjectId > 0
 }
 
@@ -48,9 +65,15 @@ func NewNamespaceCommand(ctx *Context) *Command {
 		Name:  "namespace",
 		Usage: "Commands for managing namespaces.",
 		SubCommands: Mux{
-			"list":   newListNamespacesCmd(ctx),
-			"create": newCreateNamespaceCmd(ctx),
-			"update": newUpdateNamespaceCmd(ctx),
+			"create":   newCreateNamespaceCmd(ctx),
+			"delete":   newDeleteNamespaceCmd(ctx),
+			"describe": newDescribeNamespaceCmd(ctx),
+			"diff":     newDiffNamespaceCmd(ctx),
+			"get":      newGetNamespaceCmd(ctx),
+			"infer":    newInferNamespaceCmd(ctx),
+			"list":     newListNamespacesCmd(ctx),
+			"migrate":  newMigrateNamespaceCmd(ctx),
+			"update":   newUpdateNamespaceCmd(ctx),
 		},
 	}
 	cmd.NewFlagSet("iobeam namespaces")
@@ -68,18 +91,240 @@ func (d *namespaceData) String() string {
 	buffer.WriteString(fmt.Sprintf("Last modified: %s\n", d.LastModified))
 	buffer.WriteString(fmt.Sprintf("Fields:\n"))
 
-	for fieldName, fieldType := range d.Fields {
-		buffer.WriteString(fmt.Sprintf("\t%s:%s\n", fieldName, fieldType))
+	for _, fieldName := range sortedKeys(d.Fields) {
+		buffer.WriteString(fmt.Sprintf("\t%s:%s\n", fieldName, d.Fields[fieldName]))
 	}
 
 	buffer.WriteString(fmt.Sprintf("Labels:\n"))
 
-	for labelName, labelValue := range d.Labels {
-		buffer.WriteString(fmt.Sprintf("\t%s:%v\n", labelName, labelValue))
+	for _, labelName := range sortedLabelNames(d.Labels) {
+		buffer.WriteString(fmt.Sprintf("\t%s:%v\n", labelName, d.Labels[labelName]))
 	}
 	return buffer.String()
 }
 
+func sortedLabelNames(labels map[string]interface{}) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// describe returns a detailed description of the namespace, with its schema
+// and labels in sorted order.
+func (d *namespaceData) describe() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(fmt.Sprintf("Namespace     : %s\n", d.Name))
+	buffer.WriteString(fmt.Sprintf("ID            : %d\n", d.NamespaceId))
+	buffer.WriteString(fmt.Sprintf("Project ID    : %d\n", d.ProjectId))
+	buffer.WriteString(fmt.Sprintf("Created       : %s\n", d.Created))
+	buffer.WriteString(fmt.Sprintf("Last modified : %s\n", d.LastModified))
+
+	buffer.WriteString("\nPartitioning:\n")
+	if len(d.PartitioningField) == 0 {
+		buffer.WriteString("  (none)\n")
+	} else {
+		partType, ok := d.Fields[d.PartitioningField]
+		if !ok {
+			partType = "not in schema"
+		}
+		buffer.WriteString(fmt.Sprintf("  Field : %s (%s)\n", d.PartitioningField, partType))
+		buffer.WriteString("  Rows with the same value of this field are stored together.\n")
+	}
+
+	names := sortedKeys(d.Fields)
+	buffer.WriteString(fmt.Sprintf("\nSchema (%d fields):\n", len(names)))
+	width := len("FIELD")
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	buffer.WriteString(fmt.Sprintf("  %-*s  %s\n", width, "FIELD", "TYPE"))
+	for _, name := range names {
+		note := ""
+		if name == d.PartitioningField {
+			note = "  (partitioning)"
+		}
+		buffer.WriteString(fmt.Sprintf("  %-*s  %s%s\n", width, name, d.Fields[name], note))
+	}
+	for _, name := range implicitFields {
+		if _, ok := d.Fields[name]; !ok {
+			buffer.WriteString(fmt.Sprintf("  %-*s  %s\n", width, name, "(implicit)"))
+		}
+	}
+
+	labels := sortedLabelNames(d.Labels)
+	buffer.WriteString(fmt.Sprintf("\nLabels (%d):\n", len(labels)))
+	for _, name := range labels {
+		value := d.Labels[name]
+		buffer.WriteString(fmt.Sprintf("  %s = %v (%s)\n", name, value, labelType(value)))
+	}
+	return buffer.String()
+}
+
+// labelType returns the type name of a label value as decoded from JSON.
+func labelType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "STRING"
+	case bool:
+		return "BOOLEAN"
+	case float64, int64:
+		return "NUMBER"
+	case nil:
+		return "NULL"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// baseNamespaceArgs select a namespace by ID or name.
+type baseNamespaceArgs struct {
+	projectId uint64
+	id        uint64
+	name      string
+}
+
+func (a *baseNamespaceArgs) IsValid() bool {
+	return a.projectId > 0 && (a.id > 0 || len(a.name) > 0)
+}
+
+func (a *baseNamespaceArgs) setFlags(c *Command, ctx *Context, verb string) {
+	flags := c.NewFlagSet("iobeam namespace " + c.Name)
+	flags.Uint64Var(&a.projectId, "projectId", ctx.Profile.ActiveProject, "Project ID (defaults to active project).")
+	flags.Uint64Var(&a.id, "id", 0, "Namespace ID to "+verb+" (this or -name is required)")
+	flags.StringVar(&a.name, "name", "", "Namespace name to "+verb+" (this or -id is required)")
+}
+
+// resolve looks up the ID of the namespace when it was selected by name.
+func (a *baseNamespaceArgs) resolve(ctx *Context) error {
+	if a.id > 0 {
+		return nil
+	}
+
+	id, err := resolveName(ctx, keyNamespace, a.projectId, a.name, func() ([]resourceRef, error) {
+		namespaces, err := _getNamespaces(ctx, a.projectId)
+		refs := make([]resourceRef, len(namespaces))
+		for i, ns := range namespaces {
+			refs[i] = resourceRef{id: strconv.FormatUint(ns.NamespaceId, 10), name: ns.Name}
+		}
+		return refs, err
+	})
+	if err != nil {
+		return err
+	}
+	a.id, err = strconv.ParseUint(id, 10, 64)
+	return err
+}
+
+func _getNamespace(ctx *Context, args *baseNamespaceArgs) (*namespaceData, error) {
+	if err := args.resolve(ctx); err != nil {
+		return nil, err
+	}
+
+	ns := new(namespaceData)
+	_, err := ctx.Client.
+		Get(getUrlForNamespaceId(args.id)).
+		ProjectToken(ctx.Profile, args.projectId).
+		Expect(200).
+		ResponseBody(ns).
+		Execute()
+	return ns, err
+}
+
+func newGetNamespaceCmd(ctx *Context) *Command {
+	args := new(baseNamespaceArgs)
+	cmd := &Command{
+		Name: "get",
+		// ApiPath determined by flags
+		Usage:  "Get a namespace.",
+		Data:   args,
+		Action: getNamespace,
+	}
+	args.setFlags(cmd, ctx, "get")
+
+	return cmd
+}
+
+func getNamespace(c *Command, ctx *Context) error {
+	ns, err := _getNamespace(ctx, c.Data.(*baseNamespaceArgs))
+	if err == nil {
+		fmt.Print(ns.String())
+	}
+	return err
+}
+
+func newDescribeNamespaceCmd(ctx *Context) *Command {
+	args := new(baseNamespaceArgs)
+	cmd := &Command{
+		Name: "describe",
+		// ApiPath determined by flags
+		Usage:  "Show the schema, partitioning and labels of a namespace.",
+		Data:   args,
+		Action: describeNamespace,
+	}
+	args.setFlags(cmd, ctx, "describe")
+
+	return cmd
+}
+
+func describeNamespace(c *Command, ctx *Context) error {
+	ns, err := _getNamespace(ctx, c.Data.(*baseNamespaceArgs))
+	if err == nil {
+		fmt.Print(ns.describe())
+	}
+	return err
+}
+
+type deleteNamespaceArgs struct {
+	baseNamespaceArgs
+	force bool
+}
+
+func newDeleteNamespaceCmd(ctx *Context) *Command {
+	args := new(deleteNamespaceArgs)
+	cmd := &Command{
+		Name: "delete",
+		// ApiPath determined by flags
+		Usage:  "Delete a namespace and all of its data.",
+		Data:   args,
+		Action: deleteNamespace,
+	}
+	args.setFlags(cmd, ctx, "delete")
+	cmd.flags.BoolVar(&args.force, "force", false, descForce)
+
+	return cmd
+}
+
+func deleteNamespace(c *Command, ctx *Context) error {
+	args := c.Data.(*deleteNamespaceArgs)
+	ns, err := _getNamespace(ctx, &args.baseNamespaceArgs)
+	if err != nil {
+		return err
+	}
+
+	// Deleting a namespace also deletes its data, so always confirm.
+	prompt := fmt.Sprintf("Delete namespace '%s' (ID %d) and all of its data?", ns.Name, ns.NamespaceId)
+	if !confirm(prompt, args.force) {
+		return fmt.Errorf("Aborted, namespace '%s' was not deleted.", ns.Name)
+	}
+
+	_, err = ctx.Client.
+		Delete(getUrlForNamespaceId(ns.NamespaceId)).
+		ProjectToken(ctx.Profile, args.projectId).
+		Expect(204).
+		Execute()
+
+	if err == nil {
+		ctx.forgetNames(keyNamespace)
+		fmt.Printf("Namespace '%s' deleted.\n", ns.Name)
+	}
+	return err
+}
+
 func newUpdateNamespaceCmd(ctx *Context) *Command {
 
 	args := new(updateNamespaceData)
@@ -93,7 +338,8 @@ func newUpdateNamespaceCmd(ctx *Context) *Command {
 
 	flags := cmd.NewFlagSet("create namespace")
 	flags.Uint64Var(&args.ProjectId, "projectId", ctx.Profile.ActiveProject, "Project ID (defaults to active project).")
-	flags.Uint64Var(&args.NamespaceId, "id", 0, "Namespace id.")
+	flags.Uint64Var(&args.NamespaceId, "id", 0, "Namespace id (this or -name is required).")
+	flags.StringVar(&args.Name, "name", "", "Namespace name (this or -id is required).")
 	flags.Var(&args.fieldsStrs, "field", "Field on form name:type (ex: temp:DOUBLE). Supported types are DOUBLE,LONG,BOOLEAN and STRING")
 	flags.Var(&args.labelsStrs, "label", "Label to set to import batch, can occur multiple times to set multiple labels (ex. device_id=\\\"myDevice\\\")")
 
@@ -106,9 +352,14 @@ func newUpdateNamespaceCmd(ctx *Context) *Command {
 func updateNamespace(c *Command, ctx *Context) error {
 	d := c.Data.(*updateNamespaceData)
 
+	base := &baseNamespaceArgs{projectId: d.ProjectId, id: d.NamespaceId, name: d.Name}
+	if err := base.resolve(ctx); err != nil {
+		return err
+	}
+
 	ns := new(namespaceData)
 
-	path := c.ApiPath + strconv.FormatUint(d.NamespaceId, 10)
+	path := getUrlForNamespaceId(base.id)
 	_, err := ctx.Client.
 		Get(path).
 		ProjectToken(ctx.Profile, d.ProjectId).
@@ -157,6 +408,7 @@ func updateNamespace(c *Command, ctx *Context) error {
 		Execute()
 
 	if err == nil {
+		ctx.forgetNames(keyNamespace)
 		fmt.Println("Namespace updated.")
 	}
 
@@ -180,6 +432,8 @@ func newCreateNamespaceCmd(ctx *Context) *Command {
 	flags.StringVar(&args.PartitioningField, "partitioningField", "", "Field to partition incoming data on.")
 	flags.Var(&args.fieldsStrs, "field", "Field on form name:type (ex: temp:DOUBLE). Supported types are DOUBLE,LONG,BOOLEAN and STRING")
 	flags.Var(&args.labelsStrs, "label", "Label to set")
+	flags.StringVar(&args.schemaFile, "schema", "", "YAML file with the name, partitioning_field, fields and labels of the namespace. "+
+		"Flags take precedence over the file.")
 
 	flags.BoolVar(&args.dumpRequest, "dumpRequest", false, "Dump the request to std out.")
 	flags.BoolVar(&args.dumpResponse, "dumpResponse", false, "Dump the response to std out.")
@@ -243,6 +497,15 @@ func createNamespace(c *Command, ctx *Context) error {
 
 	var headers *http.Header
 	d.Fields = fields
+	if len(d.schemaFile) > 0 {
+		if err := d.applySchemaFile(); err != nil {
+			return err
+		}
+		if len(d.Name) == 0 || len(d.PartitioningField) == 0 || len(d.Fields) == 0 {
+			return fmt.Errorf("The namespace needs a name, a partitioning field and at least one field.")
+		}
+	}
+
 	_, err = ctx.Client.
 		Post(c.ApiPath).
 		ProjectToken(ctx.Profile, d.ProjectId).
@@ -260,6 +523,38 @@ func createNamespace(c *Command, ctx *Context) error {
 	return err
 }
 
+// _getNamespaces returns all namespaces of a project.
+func _getNamespaces(ctx *Context, projectId uint64) ([]namespaceData, error) {
+	type namespaceResult struct {
+		Namespaces []namespaceData
+	}
+
+	result := new(namespaceResult)
+	_, err := ctx.Client.
+		Get("/v1/namespaces/").
+		ProjectToken(ctx.Profile, projectId).
+		Expect(200).
+		ResponseBody(result).
+		Execute()
+
+	return result.Namespaces, err
+}
+
+// _getNamespaceByName returns the namespace of a project called name.
+func _getNamespaceByName(ctx *Context, projectId uint64, name string) (*namespaceData, error) {
+	namespaces, err := _getNamespaces(ctx, projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range namespaces {
+		if namespaces[i].Name == name {
+			return &namespaces[i], nil
+		}
+	}
+	return nil, fmt.Errorf("Namespace '%s' not found in project %d", name, projectId)
+}
+
 func newListNamespacesCmd(ctx *Context) *Command {
 
 	args := new(namespaceData)
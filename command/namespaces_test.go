@@ -0,0 +1,101 @@
+package command
+
+import (
+	"testing"
+)
+
+func TestNamespaceArgsValidity(t *testing.T) {
+	cases := []dataTestCase{
+		{desc: "valid by id", in: &baseNamespaceArgs{projectId: 1, id: 2}, want: true},
+		{desc: "valid by name", in: &baseNamespaceArgs{projectId: 1, name: "input"}, want: true},
+		{desc: testDescInvalidProjectId, in: &baseNamespaceArgs{id: 2}, want: false},
+		{desc: "invalid, no id or name", in: &baseNamespaceArgs{projectId: 1}, want: false},
+		{
+			desc: "valid update by name",
+			in: &updateNamespaceData{namespaceData{
+				ProjectId:  1,
+				Name:       "input",
+				fieldsStrs: setFlags{"temp:DOUBLE": {}},
+			}},
+			want: true,
+		},
+		{
+			desc: "invalid update, no id or name",
+			in: &updateNamespaceData{namespaceData{
+				ProjectId:  1,
+				fieldsStrs: setFlags{"temp:DOUBLE": {}},
+			}},
+			want: false,
+		},
+	}
+	runDataTestCase(t, cases)
+}
+
+func testNamespace() *namespaceData {
+	return &namespaceData{
+		ProjectId:         1,
+		Name:              "input",
+		NamespaceId:       7,
+		PartitioningField: "device_id",
+		Fields: map[string]string{
+			"temp":      "DOUBLE",
+			"device_id": "STRING",
+			"count":     "LONG",
+		},
+		Labels: map[string]interface{}{
+			"zone":    "eu",
+			"enabled": true,
+		},
+		Created:      "2016-01-01",
+		LastModified: "2016-01-02",
+	}
+}
+
+func TestNamespaceString(t *testing.T) {
+	want := "Name: input\n" +
+		"Id: 7\n" +
+		"Partitioning field: device_id\n" +
+		"Created: 2016-01-01\n" +
+		"Last modified: 2016-01-02\n" +
+		"Fields:\n" +
+		"\tcount:LONG\n" +
+		"\tdevice_id:STRING\n" +
+		"\ttemp:DOUBLE\n" +
+		"Labels:\n" +
+		"\tenabled:true\n" +
+		"\tzone:eu\n"
+	if got := testNamespace().String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNamespaceDescribe(t *testing.T) {
+	want := "Namespace     : input\n" +
+		"ID            : 7\n" +
+		"Project ID    : 1\n" +
+		"Created       : 2016-01-01\n" +
+		"Last modified : 2016-01-02\n" +
+		"\n" +
+		"Partitioning:\n" +
+		"  Field : device_id (STRING)\n" +
+		"  Rows with the same value of this field are stored together.\n" +
+		"\n" +
+		"Schema (3 fields):\n" +
+		"  FIELD      TYPE\n" +
+		"  count      LONG\n" +
+		"  device_id  STRING  (partitioning)\n" +
+		"  temp       DOUBLE\n" +
+		"  time       (implicit)\n" +
+		"\n" +
+		"Labels (2):\n" +
+		"  enabled = true (BOOLEAN)\n" +
+		"  zone = eu (STRING)\n"
+	if got := testNamespace().describe(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	empty := &namespaceData{Name: "empty"}
+	if got := empty.describe(); len(got) == 0 {
+		t.Errorf("expected description of empty namespace")
+	}
+}
@@ -0,0 +1,58 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	outputText  = "text"
+	outputYaml  = "yaml"
+	outputTable = "table"
+
+	secretMask = "********"
+)
+
+// structuredOutputs are the output formats supported by commands that print
+// API resources.
+var structuredOutputs = []string{outputText, outputJson, outputYaml}
+
+// maskSecret hides the value of a secret, leaving empty values untouched so
+// it is still clear whether a secret was set at all.
+func maskSecret(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	return secretMask
+}
+
+// toStructured converts v into JSON or YAML. YAML is produced from the JSON
+// encoding of v so that field names match what the API uses.
+func toStructured(v interface{}, format string) ([]byte, error) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil || format == outputJson {
+		return out, err
+	}
+	if format != outputYaml {
+		return nil, fmt.Errorf("Unsupported output format: %s", format)
+	}
+
+	var temp interface{}
+	if err := yaml.Unmarshal(out, &temp); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(temp)
+}
+
+// printStructured prints v to std out as JSON or YAML.
+func printStructured(v interface{}, format string) error {
+	out, err := toStructured(v, format)
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.TrimSuffix(string(out), "\n"))
+	return nil
+}
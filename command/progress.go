@@ -0,0 +1,84 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const progressBarWidth = 30
+
+// isTerminal reports whether f is a terminal, so that progress output that
+// redraws lines is only shown to people and not written to logs.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar reports progress of a transfer of total bytes on a single,
+// redrawn line.
+type progressBar struct {
+	w     io.Writer
+	total int64
+	start time.Time
+	// base is the number of bytes that were already done when the bar was
+	// started (e.g. when resuming), which do not count towards throughput.
+	base int64
+}
+
+func newProgressBar(w io.Writer, total, done int64) *progressBar {
+	return &progressBar{w: w, total: total, start: time.Now(), base: done}
+}
+
+// update redraws the bar for done bytes.
+func (p *progressBar) update(done int64) {
+	fmt.Fprintf(p.w, "\r%s", formatProgress(done, p.total, done-p.base, time.Since(p.start)))
+}
+
+// finish ends the line of the bar.
+func (p *progressBar) finish() {
+	fmt.Fprintln(p.w)
+}
+
+// formatProgress returns a progress line for done of total bytes, where
+// transferred bytes took elapsed time.
+func formatProgress(done, total, transferred int64, elapsed time.Duration) string {
+	fraction := 1.0
+	if total > 0 {
+		fraction = float64(done) / float64(total)
+	}
+	filled := int(fraction * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	if filled > 0 && filled < progressBarWidth {
+		bar = strings.Repeat("=", filled-1) + ">" + strings.Repeat(" ", progressBarWidth-filled)
+	}
+
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(transferred) / elapsed.Seconds()
+	}
+	eta := "--"
+	if rate > 0 {
+		remaining := time.Duration(float64(total-done) / rate * float64(time.Second))
+		eta = remaining.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("[%s] %3.0f%% %s/%s %s/s ETA %s", bar, fraction*100,
+		formatBytes(done), formatBytes(total), formatBytes(int64(rate)), eta)
+}
+
+// formatBytes returns n as a human readable size, e.g. 1.5 MB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,72 @@
+package command
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatBytes(t *testing.T) {
+	cases := []struct {
+		in   int64
+		want string
+	}{
+		{in: 0, want: "0 B"},
+		{in: 1023, want: "1023 B"},
+		{in: 1024, want: "1.0 KB"},
+		{in: 1536, want: "1.5 KB"},
+		{in: 8 * 1024 * 1024, want: "8.0 MB"},
+		{in: 3 * 1024 * 1024 * 1024, want: "3.0 GB"},
+	}
+	for _, c := range cases {
+		if got := formatBytes(c.in); got != c.want {
+			t.Errorf("formatBytes(%d): got '%s', want '%s'", c.in, got, c.want)
+		}
+	}
+}
+
+func TestFormatProgress(t *testing.T) {
+	cases := []struct {
+		desc        string
+		done        int64
+		total       int64
+		transferred int64
+		elapsed     time.Duration
+		want        string
+	}{
+		{
+			desc:  "start",
+			total: 2048,
+			want:  "[                              ]   0% 0 B/2.0 KB 0 B/s ETA --",
+		},
+		{
+			desc:        "half",
+			done:        1024,
+			total:       2048,
+			transferred: 1024,
+			elapsed:     time.Second,
+			want:        "[==============>               ]  50% 1.0 KB/2.0 KB 1.0 KB/s ETA 1s",
+		},
+		{
+			desc:        "resumed",
+			done:        1536,
+			total:       2048,
+			transferred: 512,
+			elapsed:     time.Second,
+			want:        "[=====================>        ]  75% 1.5 KB/2.0 KB 512 B/s ETA 1s",
+		},
+		{
+			desc:        "done",
+			done:        2048,
+			total:       2048,
+			transferred: 2048,
+			elapsed:     2 * time.Second,
+			want:        "[==============================] 100% 2.0 KB/2.0 KB 1.0 KB/s ETA 0s",
+		},
+	}
+	for _, c := range cases {
+		got := formatProgress(c.done, c.total, c.transferred, c.elapsed)
+		if got != c.want {
+			t.Errorf("%s: got\n'%s', want\n'%s'", c.desc, got, c.want)
+		}
+	}
+}
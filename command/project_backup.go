@@ -0,0 +1,842 @@
+package command
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iobeam/iobeam/config"
+)
+
+// A backup is a gzipped tar archive with one JSON entry per kind of resource,
+// the contents of the project's files under files/, and optionally the data
+// of each namespace under data/ as newline-delimited JSON rows.
+const (
+	backupVersion = 1
+
+	backupManifestEntry   = "manifest.json"
+	backupNamespacesEntry = "namespaces.json"
+	backupDevicesEntry    = "devices.json"
+	backupTriggersEntry   = "triggers.json"
+	backupAppsEntry       = "apps.json"
+	backupFilesEntry      = "files.json"
+	backupFilesDir        = "files"
+	backupDataDir         = "data"
+	backupDataExt         = ".ndjson"
+
+	// deviceIdField is the data field remapped when devices get new IDs.
+	deviceIdField = "device_id"
+)
+
+// backupManifest describes a backup. DataFrom and DataTo are set if it
+// includes data.
+type backupManifest struct {
+	Version     int        `json:"version"`
+	CLIVersion  string     `json:"cli_version"`
+	Created     time.Time  `json:"created"`
+	ProjectId   uint64     `json:"project_id"`
+	ProjectName string     `json:"project_name"`
+	DataFrom    *time.Time `json:"data_from,omitempty"`
+	DataTo      *time.Time `json:"data_to,omitempty"`
+}
+
+// backupTrigger is a trigger with its local state, if it was disabled or
+// muted. The actions of such triggers are only kept in the local state.
+type backupTrigger struct {
+	Trigger fullTrigger   `json:"trigger"`
+	State   *triggerState `json:"local_state,omitempty"`
+}
+
+// backupApp is an app with its local bundle history.
+type backupApp struct {
+	App     appData         `json:"app"`
+	History []bundleVersion `json:"history,omitempty"`
+}
+
+// projectBackup is the content of a backup. The contents of files and data
+// are kept in dir rather than in memory.
+type projectBackup struct {
+	Manifest   backupManifest
+	Namespaces []namespaceData
+	Devices    []deviceData
+	Triggers   []backupTrigger
+	Apps       []backupApp
+	Files      []fileInfo
+	dir        string
+}
+
+// jsonEntries returns the names of the JSON entries of a backup and where
+// they are kept in b, in the order they are written.
+func (b *projectBackup) jsonEntries() ([]string, map[string]interface{}) {
+	names := []string{backupManifestEntry, backupNamespacesEntry, backupDevicesEntry,
+		backupTriggersEntry, backupAppsEntry, backupFilesEntry}
+	values := map[string]interface{}{
+		backupManifestEntry:   &b.Manifest,
+		backupNamespacesEntry: &b.Namespaces,
+		backupDevicesEntry:    &b.Devices,
+		backupTriggersEntry:   &b.Triggers,
+		backupAppsEntry:       &b.Apps,
+		backupFilesEntry:      &b.Files,
+	}
+	return names, values
+}
+
+func (b *projectBackup) filePath(name string) string {
+	return filepath.Join(b.dir, backupFilesDir, name)
+}
+
+func (b *projectBackup) dataPath(namespace string) string {
+	return filepath.Join(b.dir, backupDataDir, namespace+backupDataExt)
+}
+
+// write writes b as a gzipped tar archive to w.
+func (b *projectBackup) write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	names, values := b.jsonEntries()
+	for _, name := range names {
+		data, err := json.MarshalIndent(values[name], "", "  ")
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: b.Manifest.Created}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	for _, sub := range []string{backupFilesDir, backupDataDir} {
+		infos, err := ioutil.ReadDir(filepath.Join(b.dir, sub))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			if err := addTarFile(tw, sub+"/"+info.Name(), filepath.Join(b.dir, sub, info.Name()), info); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addTarFile(tw *tar.Writer, name, path string, info os.FileInfo) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// readBackup reads a backup written by write from r, extracting the
+// contents of files and data into dir.
+func readBackup(r io.Reader, dir string) (*projectBackup, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Not a backup archive: %v", err)
+	}
+	defer gz.Close()
+
+	b := &projectBackup{dir: dir}
+	_, values := b.jsonEntries()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if v, ok := values[hdr.Name]; ok {
+			if err := json.NewDecoder(tr).Decode(v); err != nil {
+				return nil, fmt.Errorf("Invalid entry '%s' in backup: %v", hdr.Name, err)
+			}
+			continue
+		}
+		parts := strings.Split(hdr.Name, "/")
+		if len(parts) != 2 || (parts[0] != backupFilesDir && parts[0] != backupDataDir) {
+			continue
+		}
+		if parts[1] == "" || parts[1] == "." || parts[1] == ".." {
+			return nil, fmt.Errorf("Invalid entry '%s' in backup.", hdr.Name)
+		}
+		if err := extractTarFile(tr, filepath.Join(dir, parts[0]), parts[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if b.Manifest.Version == 0 {
+		return nil, fmt.Errorf("Not a project backup: it has no %s.", backupManifestEntry)
+	} else if b.Manifest.Version > backupVersion {
+		return nil, fmt.Errorf("The backup has version %d, which needs a newer version of this tool.", b.Manifest.Version)
+	}
+	for _, f := range b.Files {
+		if _, err := os.Stat(b.filePath(f.Name)); err != nil {
+			return nil, fmt.Errorf("The backup is missing the contents of file '%s'.", f.Name)
+		}
+	}
+	return b, nil
+}
+
+func extractTarFile(r io.Reader, dir, name string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// summary returns a one line description of what b contains.
+func (b *projectBackup) summary() string {
+	s := fmt.Sprintf("%d namespaces, %d devices, %d triggers, %d apps, %d files",
+		len(b.Namespaces), len(b.Devices), len(b.Triggers), len(b.Apps), len(b.Files))
+	if b.Manifest.DataFrom != nil {
+		s += fmt.Sprintf(", data from %s to %s",
+			b.Manifest.DataFrom.UTC().Format(time.RFC3339), b.Manifest.DataTo.UTC().Format(time.RFC3339))
+	}
+	return s
+}
+
+type backupProjectArgs struct {
+	projectId uint64
+	out       string
+	since     string
+	until     string
+	window    time.Duration
+	limit     int
+}
+
+func (a *backupProjectArgs) IsValid() bool {
+	now := time.Now()
+	timesOk := len(a.since) == 0 && len(a.until) == 0
+	if len(a.since) > 0 {
+		_, sinceErr := parseTimeArg(a.since, now)
+		untilOk := len(a.until) == 0
+		if !untilOk {
+			_, err := parseTimeArg(a.until, now)
+			untilOk = err == nil
+		}
+		timesOk = sinceErr == nil && untilOk
+	}
+	return a.projectId > 0 && len(a.out) > 0 && timesOk &&
+		a.window > 0 && a.window <= maxDataWindow && a.limit > 0
+}
+
+func newBackupProjectCmd(ctx *Context) *Command {
+	args := new(backupProjectArgs)
+
+	cmd := &Command{
+		Name: "backup",
+		Usage: "Save a project to a .tar.gz archive: its namespaces, devices, triggers, apps, files " +
+			"and optionally its data. The archive includes app secrets and trigger credentials, so keep it safe.",
+		Data:   args,
+		Action: backupProject,
+	}
+	flags := cmd.NewFlagSet("iobeam project backup")
+	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject, "Project to back up (defaults to active project).")
+	flags.StringVar(&args.out, "out", "", "Path of the archive to write, e.g. backup.tar.gz (REQUIRED)")
+	flags.StringVar(&args.since, "since", "", "Include data from this time (ex. 2016-01-02T15:04:05Z or 720h). Data is left out if not set.")
+	flags.StringVar(&args.until, "until", "", "Include data up to this time (defaults to now).")
+	flags.DurationVar(&args.window, "window", maxDataWindow, "Time range to read per query (at most 24h).")
+	flags.IntVar(&args.limit, "limit", defaultDataLimit, "Maximum rows per query; windows with more rows are split.")
+
+	return cmd
+}
+
+func backupProject(c *Command, ctx *Context) error {
+	args := c.Data.(*backupProjectArgs)
+
+	dir, err := ioutil.TempDir("", "iobeam-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := collectBackup(ctx, args, dir, time.Now())
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(args.out), "."+filepath.Base(args.out)+".part-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = b.write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Could not write backup: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), args.out); err != nil {
+		return err
+	}
+
+	fmt.Printf("Project '%s' backed up to '%s': %s.\n", b.Manifest.ProjectName, args.out, b.summary())
+	return nil
+}
+
+// collectBackup fetches everything in the project of args, storing file
+// contents and data in dir.
+func collectBackup(ctx *Context, args *backupProjectArgs, dir string, now time.Time) (*projectBackup, error) {
+	pid := args.projectId
+	name, err := _getProjectName(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+	b := &projectBackup{
+		Manifest: backupManifest{
+			Version:     backupVersion,
+			CLIVersion:  config.CLIVersion,
+			Created:     now.UTC(),
+			ProjectId:   pid,
+			ProjectName: name,
+		},
+		dir: dir,
+	}
+
+	fmt.Printf("Backing up project '%s' (ID %d)...\n", name, pid)
+	if b.Namespaces, err = _getNamespaces(ctx, pid); err != nil {
+		return nil, err
+	}
+	if b.Devices, err = _getDevices(ctx, pid); err != nil {
+		return nil, err
+	}
+	if b.Files, err = _getFiles(ctx, pid); err != nil {
+		return nil, err
+	}
+
+	triggers, err := _getTriggers(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+	states, err := readTriggerStates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read trigger states: %v", err)
+	}
+	for _, t := range triggers {
+		b.Triggers = append(b.Triggers, backupTrigger{Trigger: t, State: states[stateKey(t.TriggerId)]})
+	}
+
+	apps, err := _getApps(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+	history, err := readAppHistory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read app history: %v", err)
+	}
+	for _, app := range apps {
+		b.Apps = append(b.Apps, backupApp{App: app, History: history[appKey(app.AppId)]})
+	}
+
+	if len(b.Files) > 0 {
+		if err := os.MkdirAll(filepath.Join(dir, backupFilesDir), 0700); err != nil {
+			return nil, err
+		}
+	}
+	for i := range b.Files {
+		f := &b.Files[i]
+		if f.Name != filepath.Base(f.Name) {
+			return nil, fmt.Errorf("Cannot back up file '%s': its name is not a plain file name.", f.Name)
+		}
+		fmt.Printf("Downloading file '%s'...\n", f.Name)
+		if err := _downloadFile(ctx, pid, f, b.filePath(f.Name)); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args.since) == 0 {
+		return b, nil
+	}
+	from, _ := parseTimeArg(args.since, now)
+	to := now
+	if len(args.until) > 0 {
+		to, _ = parseTimeArg(args.until, now)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("No data to back up: -since is not before -until.")
+	}
+	b.Manifest.DataFrom, b.Manifest.DataTo = &from, &to
+	if err := os.MkdirAll(filepath.Join(dir, backupDataDir), 0700); err != nil {
+		return nil, err
+	}
+	for _, ns := range b.Namespaces {
+		stream := &dataStream{
+			projectId: pid,
+			namespace: ns.Name,
+			from:      from,
+			to:        to,
+			window:    args.window,
+			limit:     args.limit,
+		}
+		n, err := writeNamespaceData(ctx, stream, b.dataPath(ns.Name))
+		if err != nil {
+			return nil, fmt.Errorf("Could not back up data of namespace '%s': %v", ns.Name, err)
+		}
+		fmt.Printf("Backed up %d rows of namespace '%s'.\n", n, ns.Name)
+	}
+	return b, nil
+}
+
+// writeNamespaceData writes the rows of stream to path, one JSON object per
+// line, and returns the number of rows.
+func writeNamespaceData(ctx *Context, stream *dataStream, path string) (int, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	count := 0
+	err = stream.run(ctx, func(rows []dataRow, end time.Time) error {
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+		count += len(rows)
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	if err := w.Flush(); err != nil {
+		return count, err
+	}
+	return count, f.Close()
+}
+
+func _getProjectName(ctx *Context, projectId uint64) (string, error) {
+	type projectResult struct {
+		ProjectName string `json:"project_name"`
+	}
+	result := new(projectResult)
+	_, err := ctx.Client.
+		Get("/v1/projects/" + strconv.FormatUint(projectId, 10)).
+		UserToken(ctx.Profile).
+		Expect(200).
+		ResponseBody(result).
+		Execute()
+	return result.ProjectName, err
+}
+
+type restoreProjectArgs struct {
+	in           string
+	projectId    uint64
+	name         string
+	newDeviceIds bool
+	noData       bool
+	batchSize    int
+}
+
+func (a *restoreProjectArgs) IsValid() bool {
+	return len(a.in) > 0 && (a.projectId > 0) != (len(a.name) > 0) && a.batchSize > 0
+}
+
+func newRestoreProjectCmd(ctx *Context) *Command {
+	args := new(restoreProjectArgs)
+
+	cmd := &Command{
+		Name: "restore",
+		Usage: "Recreate a project from a backup, either in a new project or in an empty one. " +
+			"Triggers and apps get new IDs; the old and new IDs are listed when done.",
+		Data:   args,
+		Action: restoreProject,
+	}
+	flags := cmd.NewFlagSet("iobeam project restore")
+	flags.StringVar(&args.in, "in", "", "Path of the backup archive (REQUIRED)")
+	flags.StringVar(&args.name, "name", "", "Create a new project with this name to restore into.")
+	flags.Uint64Var(&args.projectId, "projectId", 0, "Restore into this existing project instead; it must not have devices, triggers, apps or files.")
+	flags.BoolVar(&args.newDeviceIds, "newDeviceIds", false, "Let the server assign new device IDs, e.g. when the old project still exists. "+
+		"The device_id field of restored data is changed to match.")
+	flags.BoolVar(&args.noData, "noData", false, "Do not restore data, even if the backup has it.")
+	flags.IntVar(&args.batchSize, "batchSize", defaultBatchSize, "Rows per import request.")
+
+	return cmd
+}
+
+func restoreProject(c *Command, ctx *Context) error {
+	args := c.Data.(*restoreProjectArgs)
+
+	dir, err := ioutil.TempDir("", "iobeam-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := os.Open(args.in)
+	if err != nil {
+		return err
+	}
+	b, err := readBackup(f, dir)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup of project '%s' (ID %d) from %s: %s.\n", b.Manifest.ProjectName, b.Manifest.ProjectId,
+		b.Manifest.Created.Format(time.RFC3339), b.summary())
+
+	pid := args.projectId
+	if len(args.name) > 0 {
+		if pid, err = _createProject(ctx, args.name); err != nil {
+			return err
+		}
+	}
+
+	ids, err := restoreBackup(ctx, pid, b, args)
+	if err != nil {
+		return fmt.Errorf("Restore into project %d stopped: %v", pid, err)
+	}
+	fmt.Printf("Project restored into project %d.\n", pid)
+	fmt.Print(ids)
+	return nil
+}
+
+// _createProject creates a project called name and gets a token for it.
+func _createProject(ctx *Context, name string) (uint64, error) {
+	project := &projectData{ProjectName: name}
+	_, err := ctx.Client.
+		Post("/v1/projects").
+		Body(project).
+		UserToken(ctx.Profile).
+		Expect(201).
+		ResponseBody(project).
+		Execute()
+	if err != nil {
+		return 0, err
+	}
+	fmt.Printf("Project '%s' created with ID: %d\n", project.ProjectName, project.ProjectId)
+
+	tokenCmd := newGetProjectTokenCmd(ctx)
+	p := tokenCmd.Data.(*projectPermissions)
+	p.projectId = project.ProjectId
+	p.admin = true
+	p.write = true
+	p.read = true
+	return project.ProjectId, getProjectToken(tokenCmd, ctx)
+}
+
+// restoredId is a resource that got a new ID when restored.
+type restoredId struct {
+	kind string
+	name string
+	from string
+	to   string
+}
+
+// restoredIds lists the resources that got new IDs when restored.
+type restoredIds struct {
+	changed []restoredId
+	// devices maps the device IDs in the backup to the restored ones.
+	devices map[string]string
+}
+
+func (ids *restoredIds) add(kind, name, from, to string) {
+	if from != to {
+		ids.changed = append(ids.changed, restoredId{kind: kind, name: name, from: from, to: to})
+	}
+}
+
+func (ids *restoredIds) String() string {
+	if len(ids.changed) == 0 {
+		return ""
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString("ID changes:\n")
+	for _, id := range ids.changed {
+		buffer.WriteString(fmt.Sprintf("%-8s %-20s %s -> %s\n", id.kind, "'"+id.name+"'", id.from, id.to))
+	}
+	return buffer.String()
+}
+
+// checkRestoreTarget returns an error if project pid already has devices,
+// triggers, apps or files.
+func checkRestoreTarget(ctx *Context, pid uint64) error {
+	devices, err := _getDevices(ctx, pid)
+	if err != nil {
+		return err
+	}
+	triggers, err := _getTriggers(ctx, pid)
+	if err != nil {
+		return err
+	}
+	apps, err := _getApps(ctx, pid)
+	if err != nil {
+		return err
+	}
+	files, err := _getFiles(ctx, pid)
+	if err != nil {
+		return err
+	}
+	if len(devices)+len(triggers)+len(apps)+len(files) > 0 {
+		return fmt.Errorf("Project %d is not empty (%d devices, %d triggers, %d apps, %d files); "+
+			"restore into a new project with -name.", pid, len(devices), len(triggers), len(apps), len(files))
+	}
+	return nil
+}
+
+// restoreBackup recreates the content of b in project pid: namespaces
+// first, then files, devices, triggers, apps and finally data. Namespaces
+// that already exist with the same schema are reused.
+func restoreBackup(ctx *Context, pid uint64, b *projectBackup, args *restoreProjectArgs) (*restoredIds, error) {
+	if err := checkRestoreTarget(ctx, pid); err != nil {
+		return nil, err
+	}
+	existing, err := _getNamespaces(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+	ids := &restoredIds{devices: make(map[string]string)}
+
+	for _, ns := range b.Namespaces {
+		schema := &namespaceSchema{
+			Name:              ns.Name,
+			PartitioningField: ns.PartitioningField,
+			Fields:            ns.Fields,
+			Labels:            ns.Labels,
+		}
+		if current := findNamespace(existing, ns.Name); current != nil {
+			if !diffSchema(current, schema).isEmpty() {
+				return nil, fmt.Errorf("Namespace '%s' already exists with a different schema.", ns.Name)
+			}
+			fmt.Printf("Namespace '%s' already exists, reusing it.\n", ns.Name)
+			continue
+		}
+		if err := _createNamespaceFromSchema(ctx, pid, schema); err != nil {
+			return nil, fmt.Errorf("Could not create namespace '%s': %v", ns.Name, err)
+		}
+		fmt.Printf("Namespace '%s' created.\n", ns.Name)
+	}
+
+	for _, f := range b.Files {
+		upload := &uploadFileArgs{projectId: pid, path: b.filePath(f.Name)}
+		if _, err := _uploadFile(ctx, upload); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, d := range b.Devices {
+		device := &deviceData{ProjectId: pid, DeviceId: d.DeviceId, DeviceName: d.DeviceName, DeviceType: d.DeviceType}
+		if args.newDeviceIds {
+			device.DeviceId = ""
+		}
+		_, err := ctx.Client.
+			Post("/v1/devices").
+			Expect(201).
+			ProjectToken(ctx.Profile, pid).
+			Body(device).
+			ResponseBody(device).
+			Execute()
+		if err != nil {
+			return nil, fmt.Errorf("Could not create device '%s': %v", d.DeviceId, err)
+		}
+		ids.devices[d.DeviceId] = device.DeviceId
+		ids.add("device", d.DeviceName, d.DeviceId, device.DeviceId)
+	}
+	if len(b.Devices) > 0 {
+		fmt.Printf("%d devices created.\n", len(b.Devices))
+	}
+
+	if err := restoreTriggers(ctx, pid, b.Triggers, ids); err != nil {
+		return nil, err
+	}
+	if err := restoreApps(ctx, pid, b.Apps, ids); err != nil {
+		return nil, err
+	}
+
+	if b.Manifest.DataFrom == nil || args.noData {
+		return ids, nil
+	}
+	for _, ns := range b.Namespaces {
+		n, err := importNamespaceData(ctx, pid, &ns, b.dataPath(ns.Name), ids.devices, args.batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("Could not restore data of namespace '%s' (%d rows imported): %v", ns.Name, n, err)
+		}
+		fmt.Printf("Imported %d rows into namespace '%s'.\n", n, ns.Name)
+	}
+	return ids, nil
+}
+
+func findNamespace(namespaces []namespaceData, name string) *namespaceData {
+	for i := range namespaces {
+		if namespaces[i].Name == name {
+			return &namespaces[i]
+		}
+	}
+	return nil
+}
+
+// restoreTriggers creates triggers in project pid, and moves the local state
+// of disabled or muted triggers to their new IDs.
+func restoreTriggers(ctx *Context, pid uint64, triggers []backupTrigger, ids *restoredIds) error {
+	states := triggerStates(nil)
+	for _, bt := range triggers {
+		t := bt.Trigger
+		old := t.TriggerId
+		t.TriggerId = 0
+		t.ProjectId = pid
+		t.Status = nil
+		_, err := ctx.Client.
+			Post(baseApiPath[keyTrigger]).
+			Expect(201).
+			ProjectToken(ctx.Profile, pid).
+			Body(&t).
+			ResponseBody(&t).
+			Execute()
+		if err != nil {
+			return fmt.Errorf("Could not create trigger '%s': %v", bt.Trigger.TriggerName, err)
+		}
+		ids.add("trigger", t.TriggerName, strconv.FormatUint(old, 10), strconv.FormatUint(t.TriggerId, 10))
+		fmt.Printf("Trigger '%s' created with ID: %d\n", t.TriggerName, t.TriggerId)
+
+		if bt.State == nil {
+			continue
+		}
+		if states == nil {
+			if states, err = readTriggerStates(ctx); err != nil {
+				return fmt.Errorf("Could not read trigger states: %v", err)
+			}
+		}
+		state := *bt.State
+		state.TriggerId = t.TriggerId
+		state.ProjectId = pid
+		states[stateKey(t.TriggerId)] = &state
+	}
+	if states != nil {
+		if err := states.save(ctx); err != nil {
+			return fmt.Errorf("Could not save trigger states: %v", err)
+		}
+	}
+	return nil
+}
+
+// restoreApps creates apps in project pid with the bundles restored from
+// the backup, and moves their local bundle history to their new IDs.
+func restoreApps(ctx *Context, pid uint64, apps []backupApp, ids *restoredIds) error {
+	history := appHistory(nil)
+	for _, ba := range apps {
+		app := ba.App
+		old := app.AppId
+		app.AppId = 0
+		app.ProjectId = pid
+		app.Created = ""
+		app.LastMod = ""
+		app.CurrentStatus = ""
+		app.Error = ""
+		_, err := ctx.Client.
+			Post(baseApiPath[keyApp]).
+			Expect(201).
+			ProjectToken(ctx.Profile, pid).
+			Body(&app).
+			ResponseBody(&app).
+			Execute()
+		if err != nil {
+			return fmt.Errorf("Could not create app '%s': %v", ba.App.AppName, err)
+		}
+		ids.add("app", app.AppName, strconv.FormatUint(old, 10), strconv.FormatUint(app.AppId, 10))
+		fmt.Printf("App '%s' created with ID: %d\n", app.AppName, app.AppId)
+
+		if len(ba.History) == 0 {
+			continue
+		}
+		if history == nil {
+			if history, err = readAppHistory(ctx); err != nil {
+				return fmt.Errorf("Could not read app history: %v", err)
+			}
+		}
+		history[appKey(app.AppId)] = ba.History
+	}
+	if history != nil {
+		if err := history.save(ctx); err != nil {
+			return fmt.Errorf("Could not save app history: %v", err)
+		}
+	}
+	return nil
+}
+
+// importNamespaceData imports the rows in path into ns in project pid,
+// changing device IDs according to devices. A missing file has no rows.
+func importNamespaceData(ctx *Context, pid uint64, ns *namespaceData, path string, devices map[string]string, batchSize int) (int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	count := 0
+	var rows []dataRow
+	flush := func() error {
+		if err := _importRows(ctx, pid, ns.Name, rows, nil, batchSize); err != nil {
+			return err
+		}
+		count += len(rows)
+		rows = rows[:0]
+		return nil
+	}
+
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	for {
+		var row dataRow
+		if err := dec.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return count, err
+		}
+		if id, ok := row[deviceIdField].(string); ok {
+			if newId, ok := devices[id]; ok {
+				row[deviceIdField] = newId
+			}
+		}
+		converted, err := convertRow(row, ns.Fields)
+		if err != nil {
+			return count, fmt.Errorf("Cannot convert row at time %v: %v", row[fieldTime], err)
+		}
+		rows = append(rows, converted)
+		if len(rows) >= batchSize {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, flush()
+}
@@ -0,0 +1,285 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupProjectArgsValidity(t *testing.T) {
+	valid := func() *backupProjectArgs {
+		return &backupProjectArgs{projectId: 1, out: "backup.tar.gz", window: time.Hour, limit: 10}
+	}
+	withData := valid()
+	withData.since = "720h"
+	withData.until = "2016-01-02T15:04:05Z"
+	untilOnly := valid()
+	untilOnly.until = "24h"
+	badSince := valid()
+	badSince.since = "last week"
+	noOut := valid()
+	noOut.out = ""
+
+	cases := []dataTestCase{
+		{desc: "valid", in: valid(), want: true},
+		{desc: "valid, with data", in: withData, want: true},
+		{desc: "invalid, until without since", in: untilOnly, want: false},
+		{desc: "invalid, bad since", in: badSince, want: false},
+		{desc: "invalid, no out", in: noOut, want: false},
+	}
+	runDataTestCase(t, cases)
+}
+
+func TestRestoreProjectArgsValidity(t *testing.T) {
+	cases := []dataTestCase{
+		{desc: "valid, new project", in: &restoreProjectArgs{in: "b.tar.gz", name: "copy", batchSize: 10}, want: true},
+		{desc: "valid, existing project", in: &restoreProjectArgs{in: "b.tar.gz", projectId: 2, batchSize: 10}, want: true},
+		{desc: "invalid, both targets", in: &restoreProjectArgs{in: "b.tar.gz", projectId: 2, name: "copy", batchSize: 10}, want: false},
+		{desc: "invalid, no target", in: &restoreProjectArgs{in: "b.tar.gz", batchSize: 10}, want: false},
+		{desc: "invalid, no archive", in: &restoreProjectArgs{name: "copy", batchSize: 10}, want: false},
+	}
+	runDataTestCase(t, cases)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "iobeam-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeBackupContent(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testBackup(t *testing.T) *projectBackup {
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	b := &projectBackup{
+		Manifest: backupManifest{
+			Version:     backupVersion,
+			Created:     to,
+			ProjectId:   1,
+			ProjectName: "prod",
+			DataFrom:    &from,
+			DataTo:      &to,
+		},
+		Namespaces: []namespaceData{
+			{Name: "input", PartitioningField: "device_id", Fields: map[string]string{"device_id": typeString, "temp": typeDouble}},
+			{Name: "events", PartitioningField: "kind", Fields: map[string]string{"kind": typeString}},
+		},
+		Devices: []deviceData{{ProjectId: 1, DeviceId: "dev-a", DeviceName: "a"}},
+		Triggers: []backupTrigger{
+			{Trigger: fullTrigger{triggerData: triggerData{TriggerId: 10, ProjectId: 1, Namespace: "input", TriggerName: "hot", FireWhen: "temp > 30"}}},
+		},
+		Apps: []backupApp{
+			{App: appData{AppId: 20, AppName: "agg", ProjectId: 1, CurrentStatus: appStatusRunning,
+				Bundle: bundle{URI: bundleUriPrefix + "agg.jar", Type: "JAR"}}},
+		},
+		dir: tempDir(t),
+	}
+	writeBackupContent(t, b.dataPath("input"),
+		`{"time":1451606400000,"device_id":"dev-a","temp":21.5}`+"\n"+
+			`{"time":1451606401000,"device_id":"dev-b","temp":22}`+"\n")
+	return b
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	b := testBackup(t)
+	defer os.RemoveAll(b.dir)
+	b.Files = []fileInfo{{Name: "agg.jar", Checksum: checksum{Algorithm: "SHA-256", Sum: "x"}}}
+	writeBackupContent(t, b.filePath("agg.jar"), "jar contents")
+
+	var buf bytes.Buffer
+	if err := b.write(&buf); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	got, err := readBackup(&buf, dir)
+	if err != nil {
+		t.Fatalf("unexpected error reading: %v", err)
+	}
+	if got.summary() != b.summary() {
+		t.Errorf("got summary '%s', want '%s'", got.summary(), b.summary())
+	}
+	if got.Manifest.ProjectName != "prod" || !got.Manifest.DataFrom.Equal(*b.Manifest.DataFrom) {
+		t.Errorf("unexpected manifest: %+v", got.Manifest)
+	}
+	if got.Triggers[0].Trigger.FireWhen != "temp > 30" || got.Apps[0].App.Bundle.URI != "file://agg.jar" {
+		t.Errorf("unexpected trigger or app: %+v %+v", got.Triggers[0], got.Apps[0])
+	}
+	if content, err := ioutil.ReadFile(got.filePath("agg.jar")); err != nil || string(content) != "jar contents" {
+		t.Errorf("unexpected file contents: '%s', %v", content, err)
+	}
+	if _, err := os.Stat(got.dataPath("input")); err != nil {
+		t.Errorf("data was not extracted: %v", err)
+	}
+}
+
+func TestReadBackupErrors(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := readBackup(bytes.NewBufferString("not gzip"), dir); err == nil {
+		t.Errorf("expected error for non-gzip input")
+	}
+
+	newer := &projectBackup{Manifest: backupManifest{Version: backupVersion + 1}, dir: dir}
+	var buf bytes.Buffer
+	if err := newer.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readBackup(&buf, dir); err == nil {
+		t.Errorf("expected error for newer backup version")
+	}
+
+	missing := &projectBackup{Manifest: backupManifest{Version: backupVersion}, Files: []fileInfo{{Name: "gone.txt"}}, dir: dir}
+	buf.Reset()
+	if err := missing.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	other := tempDir(t)
+	defer os.RemoveAll(other)
+	if _, err := readBackup(&buf, other); err == nil {
+		t.Errorf("expected error for missing file contents")
+	}
+}
+
+// restoreStub is an empty project, except for the namespace 'input',
+// that records what is created in it.
+type restoreStub struct {
+	http.Handler
+	namespaces []namespaceData
+	devices    []deviceData
+	triggers   []fullTrigger
+	apps       []appData
+	imports    []importObj
+}
+
+func newRestoreStub() *restoreStub {
+	s := new(restoreStub)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/namespaces/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			var ns namespaceData
+			json.NewDecoder(r.Body).Decode(&ns)
+			s.namespaces = append(s.namespaces, ns)
+			w.WriteHeader(201)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"namespaces": [{"namespace_name": "input", "partitioning_field": "device_id", `+
+			`"fields": {"temp": "DOUBLE", "device_id": "STRING"}}]}`)
+	})
+	mux.HandleFunc("/v1/devices", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "POST" {
+			var d deviceData
+			json.NewDecoder(r.Body).Decode(&d)
+			s.devices = append(s.devices, d)
+			d.DeviceId = fmt.Sprintf("new-%d", len(s.devices))
+			w.WriteHeader(201)
+			json.NewEncoder(w).Encode(d)
+			return
+		}
+		fmt.Fprint(w, `{"devices": []}`)
+	})
+	mux.HandleFunc("/v1/triggers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "POST" {
+			var tr fullTrigger
+			json.NewDecoder(r.Body).Decode(&tr)
+			s.triggers = append(s.triggers, tr)
+			tr.TriggerId = 100
+			w.WriteHeader(201)
+			json.NewEncoder(w).Encode(tr)
+			return
+		}
+		fmt.Fprint(w, `{"triggers": []}`)
+	})
+	mux.HandleFunc("/v1/apps", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "POST" {
+			var app appData
+			json.NewDecoder(r.Body).Decode(&app)
+			s.apps = append(s.apps, app)
+			app.AppId = 200
+			w.WriteHeader(201)
+			json.NewEncoder(w).Encode(app)
+			return
+		}
+		fmt.Fprint(w, `{"apps": []}`)
+	})
+	mux.HandleFunc("/v1/files", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"files": []}`)
+	})
+	mux.HandleFunc("/v1/imports", func(w http.ResponseWriter, r *http.Request) {
+		var obj importObj
+		dec := json.NewDecoder(r.Body)
+		dec.UseNumber()
+		dec.Decode(&obj)
+		s.imports = append(s.imports, obj)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{}`)
+	})
+	s.Handler = mux
+	return s
+}
+
+func TestRestoreBackup(t *testing.T) {
+	server := newRestoreStub()
+	ctx := newTestContext(t, server)
+	b := testBackup(t)
+	defer os.RemoveAll(b.dir)
+
+	args := &restoreProjectArgs{projectId: 2, newDeviceIds: true, batchSize: 10}
+	ids, err := restoreBackup(ctx, 2, b, args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(server.namespaces) != 1 || server.namespaces[0].Name != "events" || server.namespaces[0].ProjectId != 2 {
+		t.Errorf("expected only 'events' to be created: %+v", server.namespaces)
+	}
+	if len(server.devices) != 1 || server.devices[0].DeviceId != "" || server.devices[0].ProjectId != 2 {
+		t.Errorf("unexpected devices: %+v", server.devices)
+	}
+	if len(server.triggers) != 1 || server.triggers[0].TriggerId != 0 || server.triggers[0].ProjectId != 2 {
+		t.Errorf("unexpected triggers: %+v", server.triggers)
+	}
+	app := server.apps[0]
+	if app.AppId != 0 || app.ProjectId != 2 || len(app.CurrentStatus) > 0 || app.Bundle.URI != "file://agg.jar" {
+		t.Errorf("unexpected app: %+v", app)
+	}
+
+	want := "ID changes:\n" +
+		"device   'a'                  dev-a -> new-1\n" +
+		"trigger  'hot'                10 -> 100\n" +
+		"app      'agg'                20 -> 200\n"
+	if got := ids.String(); got != want {
+		t.Errorf("got ID changes\n%s\nwant\n%s", got, want)
+	}
+
+	if len(server.imports) != 1 {
+		t.Fatalf("expected 1 import, got %d", len(server.imports))
+	}
+	data := server.imports[0].Data
+	if fmt.Sprint(data.Fields) != "[time device_id temp]" || fmt.Sprint(data.Values) != "[[1451606400000 new-1 21.5] [1451606401000 dev-b 22]]" {
+		t.Errorf("unexpected import: %+v", data)
+	}
+}
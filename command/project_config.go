@@ -0,0 +1,1064 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	planCreate = "create"
+	planUpdate = "update"
+	planDelete = "delete"
+
+	kindDevice     = "device"
+	kindPermission = "permission"
+)
+
+// planKinds lists the kinds of resources in the order they are created or
+// updated, so that resources exist before others refer to them. Deletes are
+// done in the reverse order.
+var planKinds = []string{keyNamespace, kindDevice, keyTrigger, keyApp, kindPermission}
+
+// projectConfig is a YAML file declaring the resources of a project:
+//
+//	namespaces:
+//	  - name: input
+//	    partitioning_field: device_id
+//	    fields: {device_id: STRING, temp: DOUBLE}
+//	devices:
+//	  - id: kitchen-sensor-0001
+//	    name: kitchen
+//	triggers:
+//	  - name: too-hot
+//	    namespace: input
+//	    fire_when: '{{ temp }} > 30'
+//	    actions:
+//	      - type: email
+//	        args: {to: [ops@example.com], payload: "Temperature is {{temp}}"}
+//	apps:
+//	  - name: aggregator
+//	    bundle: aggregator-0123456789ab.jar
+//	    config: {window: 60}
+//	permissions:
+//	  - user_id: 42
+//	    read: true
+type projectConfig struct {
+	Namespaces  []namespaceSchema    `yaml:"namespaces"`
+	Devices     []declaredDevice     `yaml:"devices"`
+	Triggers    []declaredTrigger    `yaml:"triggers"`
+	Apps        []declaredApp        `yaml:"apps"`
+	Permissions []declaredPermission `yaml:"permissions"`
+}
+
+type declaredDevice struct {
+	Id   string `yaml:"id"`
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+}
+
+type declaredAction struct {
+	Type     string                 `yaml:"type"`
+	MinDelay uint64                 `yaml:"min_delay"`
+	Args     map[string]interface{} `yaml:"args"`
+}
+
+type declaredTrigger struct {
+	Name        string           `yaml:"name"`
+	Namespace   string           `yaml:"namespace"`
+	FireWhen    string           `yaml:"fire_when"`
+	ReleaseWhen string           `yaml:"release_when"`
+	DataExpiry  uint64           `yaml:"data_expiry"`
+	Actions     []declaredAction `yaml:"actions"`
+}
+
+// declaredApp is an app whose bundle is a file already uploaded to the
+// project.
+type declaredApp struct {
+	Name       string                 `yaml:"name"`
+	Bundle     string                 `yaml:"bundle"`
+	BundleType string                 `yaml:"bundle_type"`
+	Status     string                 `yaml:"status"`
+	Config     map[string]interface{} `yaml:"config"`
+	Secrets    map[string]interface{} `yaml:"secrets"`
+}
+
+type declaredPermission struct {
+	UserId uint64 `yaml:"user_id"`
+	Read   bool   `yaml:"read"`
+	Write  bool   `yaml:"write"`
+	Admin  bool   `yaml:"admin"`
+}
+
+func parseProjectConfig(data []byte) (*projectConfig, error) {
+	cfg := new(projectConfig)
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// jsonCompatible converts the maps in a value decoded from YAML to maps with
+// string keys, so it can be marshalled as JSON.
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = jsonCompatible(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[k] = jsonCompatible(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = jsonCompatible(val)
+		}
+		return l
+	}
+	return v
+}
+
+// trigger returns the trigger declared by t in project projectId.
+func (t *declaredTrigger) trigger(projectId uint64) (*fullTrigger, error) {
+	if len(t.Name) == 0 || len(t.Namespace) == 0 || len(t.FireWhen) == 0 {
+		return nil, fmt.Errorf("Trigger '%s' needs a name, namespace and fire_when.", t.Name)
+	}
+	actions := make([]triggerAction, 0, len(t.Actions))
+	for i, a := range t.Actions {
+		if _, ok := actionTypes[a.Type]; !ok {
+			return nil, fmt.Errorf("Action %d of trigger '%s' has unknown type '%s'.", i, t.Name, a.Type)
+		}
+		raw, err := json.Marshal(jsonCompatible(a.Args))
+		if err != nil {
+			return nil, err
+		}
+		typed := getActionArgs(a.Type)
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(typed); err != nil {
+			return nil, fmt.Errorf("Bad args for action %d of trigger '%s': %v", i, t.Name, err)
+		}
+		if !typed.Valid() {
+			return nil, fmt.Errorf("Action %d of trigger '%s' is missing required args.", i, t.Name)
+		}
+		actions = append(actions, triggerAction{Type: a.Type, MinDelay: a.MinDelay, Args: typed})
+	}
+
+	var release *string
+	if len(t.ReleaseWhen) > 0 {
+		r := t.ReleaseWhen
+		release = &r
+	}
+	return newTrigger(t.Name, projectId, t.DataExpiry, t.FireWhen, release, t.Namespace, actions), nil
+}
+
+// app returns the app declared by a in project projectId, using the info of
+// its uploaded bundle file.
+func (a *declaredApp) app(projectId uint64, files []fileInfo) (*appData, error) {
+	if len(a.Name) == 0 || len(a.Bundle) == 0 {
+		return nil, fmt.Errorf("App '%s' needs a name and a bundle.", a.Name)
+	}
+	var file *fileInfo
+	for i := range files {
+		if files[i].Name == a.Bundle {
+			file = &files[i]
+		}
+	}
+	if file == nil {
+		return nil, fmt.Errorf("App '%s' uses bundle '%s', which is not a file in the project. Upload it with 'iobeam file upload'.",
+			a.Name, a.Bundle)
+	}
+
+	bundleType := a.BundleType
+	if len(bundleType) == 0 {
+		bundleType = detectBundleType(a.Bundle)
+	} else if !isInList(bundleType, bundleTypes) {
+		return nil, fmt.Errorf("App '%s' has unknown bundle type '%s'.", a.Name, bundleType)
+	}
+	status := a.Status
+	if len(status) == 0 {
+		status = appStatusRunning
+	} else if status != appStatusRunning && status != appStatusStopped {
+		return nil, fmt.Errorf("App '%s' has status '%s', it must be %s or %s.", a.Name, status, appStatusRunning, appStatusStopped)
+	}
+
+	config, err := configStrings("config", a.Config)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := configStrings("secrets", a.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	return &appData{
+		AppName:         a.Name,
+		ProjectId:       projectId,
+		Bundle:          bundle{URI: bundleUriPrefix + a.Bundle, Type: bundleType, Checksum: file.Checksum},
+		RequestedStatus: status,
+		Config:          config,
+		Secrets:         secrets,
+	}, nil
+}
+
+// liveState is the current state of a project.
+type liveState struct {
+	namespaces  []namespaceData
+	devices     []deviceData
+	triggers    []fullTrigger
+	apps        []appData
+	files       []fileInfo
+	permissions []addUserData
+	// states are the local states of disabled and muted triggers.
+	states triggerStates
+}
+
+func _getLiveState(ctx *Context, projectId uint64) (*liveState, error) {
+	live := new(liveState)
+	var err error
+	if live.namespaces, err = _getNamespaces(ctx, projectId); err != nil {
+		return nil, err
+	}
+	if live.devices, err = _getDevices(ctx, projectId); err != nil {
+		return nil, err
+	}
+	if live.triggers, err = _getTriggers(ctx, projectId); err != nil {
+		return nil, err
+	}
+	if live.apps, err = _getApps(ctx, projectId); err != nil {
+		return nil, err
+	}
+	if live.files, err = _getFiles(ctx, projectId); err != nil {
+		return nil, err
+	}
+	if live.permissions, err = _getProjectPermissions(ctx, projectId); err != nil {
+		return nil, err
+	}
+	if live.states, err = readTriggerStates(ctx); err != nil {
+		return nil, fmt.Errorf("Could not read trigger states: %v", err)
+	}
+	return live, nil
+}
+
+// _getProjectPermissions returns the permissions of each user of a project.
+func _getProjectPermissions(ctx *Context, projectId uint64) ([]addUserData, error) {
+	type userList []struct {
+		UserId uint64 `json:"user_id"`
+	}
+	type permissionsResult struct {
+		Permissions struct {
+			Read  userList
+			Write userList
+			Admin userList
+		}
+	}
+
+	result := new(permissionsResult)
+	_, err := ctx.Client.
+		Get(fmt.Sprintf("/v1/projects/%d/permissions", projectId)).
+		UserToken(ctx.Profile).
+		Expect(200).
+		ResponseBody(result).
+		Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	byUser := make(map[uint64]*addUserData)
+	user := func(id uint64) *addUserData {
+		if _, ok := byUser[id]; !ok {
+			byUser[id] = &addUserData{projectId: projectId, UserId: id}
+		}
+		return byUser[id]
+	}
+	for _, u := range result.Permissions.Read {
+		user(u.UserId).Read = true
+	}
+	for _, u := range result.Permissions.Write {
+		user(u.UserId).Write = true
+	}
+	for _, u := range result.Permissions.Admin {
+		user(u.UserId).Admin = true
+	}
+
+	var perms []addUserData
+	for _, p := range byUser {
+		perms = append(perms, *p)
+	}
+	sort.Slice(perms, func(i, j int) bool { return perms[i].UserId < perms[j].UserId })
+	return perms, nil
+}
+
+// planChange is one change of a plan. apply makes the change.
+type planChange struct {
+	op      string
+	kind    string
+	name    string
+	details []string
+	apply   func(ctx *Context) error
+}
+
+var planSigns = map[string]string{planCreate: "+", planUpdate: "~", planDelete: "-"}
+
+func (c *planChange) String() string {
+	s := fmt.Sprintf("%s %s %s\n", planSigns[c.op], c.kind, c.name)
+	for _, d := range c.details {
+		s += "    " + d + "\n"
+	}
+	return s
+}
+
+// projectPlan is the changes that make a project match a projectConfig, in
+// the order they are applied.
+type projectPlan struct {
+	changes []planChange
+	// unmanaged are resources that are not in the config but are kept
+	// because pruning is off.
+	unmanaged []string
+}
+
+func (p *projectPlan) count(op string) int {
+	n := 0
+	for _, c := range p.changes {
+		if c.op == op {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *projectPlan) String() string {
+	var buffer bytes.Buffer
+	if len(p.changes) == 0 {
+		buffer.WriteString("No changes, the project matches the file.\n")
+	}
+	for _, c := range p.changes {
+		buffer.WriteString(c.String())
+	}
+	if len(p.unmanaged) > 0 {
+		buffer.WriteString(fmt.Sprintf("\nNot in the file and left alone (use -prune to delete): %s\n",
+			strings.Join(p.unmanaged, ", ")))
+	}
+	if len(p.changes) > 0 {
+		buffer.WriteString(fmt.Sprintf("\nPlan: %d to create, %d to update, %d to delete.\n",
+			p.count(planCreate), p.count(planUpdate), p.count(planDelete)))
+	}
+	return buffer.String()
+}
+
+// planner builds a projectPlan by comparing a projectConfig with the live
+// state of a project.
+type planner struct {
+	cfg            *projectConfig
+	live           *liveState
+	projectId      uint64
+	prune          bool
+	skipFieldCheck bool
+	// activeUser never loses its permissions, so pruning cannot lock the
+	// user out of the project.
+	activeUser uint64
+
+	changes   map[string][]planChange
+	deletes   map[string][]planChange
+	unmanaged []string
+}
+
+func (p *planner) add(c planChange) {
+	p.changes[c.kind] = append(p.changes[c.kind], c)
+}
+
+func (p *planner) remove(kind, name string, apply func(ctx *Context) error) {
+	if !p.prune {
+		p.unmanaged = append(p.unmanaged, kind+" "+name)
+		return
+	}
+	p.deletes[kind] = append(p.deletes[kind], planChange{op: planDelete, kind: kind, name: name, apply: apply})
+}
+
+// checkUnique returns an error if names has duplicates or empty names.
+func checkUnique(kind string, names []string) error {
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if len(name) == 0 || name == "0" {
+			return fmt.Errorf("A %s in the file has no name or ID.", kind)
+		}
+		if seen[name] {
+			return fmt.Errorf("The file has more than one %s '%s'.", kind, name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// buildPlan returns the changes that make the project of p.live match p.cfg.
+func (p *planner) buildPlan() (*projectPlan, error) {
+	p.changes = make(map[string][]planChange)
+	p.deletes = make(map[string][]planChange)
+	steps := []func() error{p.planNamespaces, p.planDevices, p.planTriggers, p.planApps, p.planPermissions}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &projectPlan{unmanaged: p.unmanaged}
+	for _, kind := range planKinds {
+		plan.changes = append(plan.changes, p.changes[kind]...)
+	}
+	for i := len(planKinds) - 1; i >= 0; i-- {
+		plan.changes = append(plan.changes, p.deletes[planKinds[i]]...)
+	}
+	return plan, nil
+}
+
+func (p *planner) planNamespaces() error {
+	var names []string
+	for _, s := range p.cfg.Namespaces {
+		names = append(names, s.Name)
+	}
+	if err := checkUnique(keyNamespace, names); err != nil {
+		return err
+	}
+
+	pid := p.projectId
+	for i := range p.cfg.Namespaces {
+		schema := &p.cfg.Namespaces[i]
+		if err := schema.check(); err != nil {
+			return fmt.Errorf("Namespace '%s': %v", schema.Name, err)
+		}
+		current := findNamespace(p.live.namespaces, schema.Name)
+		if current == nil {
+			if len(schema.PartitioningField) == 0 || len(schema.Fields) == 0 {
+				return fmt.Errorf("Namespace '%s' needs a partitioning_field and fields.", schema.Name)
+			}
+			p.add(planChange{
+				op:      planCreate,
+				kind:    keyNamespace,
+				name:    schema.Name,
+				details: schemaLines(schema),
+				apply: func(ctx *Context) error {
+					return _createNamespaceFromSchema(ctx, pid, schema)
+				},
+			})
+			continue
+		}
+
+		diff := diffSchema(current, schema)
+		if !diff.inPlace() {
+			return fmt.Errorf("Namespace '%s' cannot be changed in place:\n%s"+
+				"Use 'iobeam namespace migrate' to move its data to a namespace with the new schema.", schema.Name, diff)
+		}
+		details := diffLines(diff)
+		labelsChanged := schema.Labels != nil && labelsString(current.Labels) != labelsString(schema.Labels)
+		if labelsChanged {
+			details = append(details, fmt.Sprintf("labels: %s -> %s", labelsString(current.Labels), labelsString(schema.Labels)))
+		}
+		if len(details) == 0 {
+			continue
+		}
+
+		updated := *current
+		updated.Fields = make(map[string]string)
+		for name, t := range current.Fields {
+			updated.Fields[name] = t
+		}
+		for _, c := range diff.Added {
+			updated.Fields[c.Name] = c.To
+		}
+		if labelsChanged {
+			updated.Labels = schema.Labels
+		}
+		p.add(planChange{
+			op:      planUpdate,
+			kind:    keyNamespace,
+			name:    schema.Name,
+			details: details,
+			apply: func(ctx *Context) error {
+				return _putNamespace(ctx, pid, &updated)
+			},
+		})
+	}
+
+	for _, ns := range p.live.namespaces {
+		if !isInList(ns.Name, names) {
+			path := getUrlForNamespaceId(ns.NamespaceId)
+			p.remove(keyNamespace, ns.Name, func(ctx *Context) error {
+				return _deleteProjectResource(ctx, pid, path)
+			})
+		}
+	}
+	return nil
+}
+
+// schemaLines describes the partitioning field and fields of a new
+// namespace.
+func schemaLines(schema *namespaceSchema) []string {
+	lines := []string{"partitioning field " + schema.PartitioningField}
+	for _, name := range sortedKeys(schema.Fields) {
+		lines = append(lines, fmt.Sprintf("+ %s %s", name, schema.Fields[name]))
+	}
+	return lines
+}
+
+func diffLines(d *schemaDiff) []string {
+	s := strings.TrimSuffix(d.String(), "\n")
+	if len(s) == 0 {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// labelsString returns labels as sorted name=value pairs.
+func labelsString(labels map[string]interface{}) string {
+	var pairs []string
+	for _, name := range sortedLabelNames(labels) {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", name, labels[name]))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func (p *planner) planDevices() error {
+	var ids []string
+	for _, d := range p.cfg.Devices {
+		ids = append(ids, d.Id)
+	}
+	if err := checkUnique(kindDevice, ids); err != nil {
+		return err
+	}
+
+	pid := p.projectId
+	live := make(map[string]deviceData)
+	for _, d := range p.live.devices {
+		live[d.DeviceId] = d
+	}
+	for _, d := range p.cfg.Devices {
+		device := &deviceData{ProjectId: pid, DeviceId: d.Id, DeviceName: d.Name, DeviceType: d.Type}
+		current, ok := live[d.Id]
+		if !ok {
+			p.add(planChange{op: planCreate, kind: kindDevice, name: d.Id, apply: func(ctx *Context) error {
+				return _postProjectResource(ctx, pid, "/v1/devices", device)
+			}})
+			continue
+		}
+
+		var details []string
+		if current.DeviceName != d.Name {
+			details = append(details, fmt.Sprintf("name: '%s' -> '%s'", current.DeviceName, d.Name))
+		}
+		if current.DeviceType != d.Type {
+			details = append(details, fmt.Sprintf("type: '%s' -> '%s'", current.DeviceType, d.Type))
+		}
+		if len(details) > 0 {
+			p.add(planChange{op: planUpdate, kind: kindDevice, name: d.Id, details: details, apply: func(ctx *Context) error {
+				return _patchDevice(ctx, device)
+			}})
+		}
+	}
+
+	for _, d := range p.live.devices {
+		if !isInList(d.DeviceId, ids) {
+			path := "/v1/devices/" + d.DeviceId
+			p.remove(kindDevice, d.DeviceId, func(ctx *Context) error {
+				return _deleteProjectResource(ctx, pid, path)
+			})
+		}
+	}
+	return nil
+}
+
+// namespaceFields returns the fields namespace will have once the plan is
+// applied, or false if it will not exist.
+func (p *planner) namespaceFields(namespace string) (map[string]string, bool) {
+	for _, s := range p.cfg.Namespaces {
+		if s.Name == namespace {
+			return s.Fields, true
+		}
+	}
+	if ns := findNamespace(p.live.namespaces, namespace); ns != nil {
+		return ns.Fields, true
+	}
+	return nil, false
+}
+
+// actionsDiffer reports whether actions a and b differ in any type, delay
+// or argument.
+func actionsDiffer(a, b []triggerAction) (bool, error) {
+	before, err := actionsJSON(a)
+	if err != nil {
+		return false, err
+	}
+	after, err := actionsJSON(b)
+	return before != after, err
+}
+
+// actionsJSON returns actions in a canonical form for comparison.
+func actionsJSON(actions []triggerAction) (string, error) {
+	typed := make([]triggerAction, len(actions))
+	for i := range actions {
+		args, err := actions[i].typedArgs()
+		if err != nil {
+			return "", err
+		}
+		typed[i] = triggerAction{Type: actions[i].Type, MinDelay: actions[i].MinDelay, Args: args}
+	}
+	raw, err := json.Marshal(typed)
+	return string(raw), err
+}
+
+func releaseString(r *string) string {
+	if r == nil {
+		return ""
+	}
+	return *r
+}
+
+// triggerDetails describes how trigger t differs from current.
+func triggerDetails(current, t *fullTrigger) ([]string, error) {
+	var details []string
+	if current.Namespace != t.Namespace {
+		details = append(details, fmt.Sprintf("namespace: %s -> %s", current.Namespace, t.Namespace))
+	}
+	if current.FireWhen != t.FireWhen {
+		details = append(details, fmt.Sprintf("fire_when: '%s' -> '%s'", current.FireWhen, t.FireWhen))
+	}
+	if releaseString(current.ReleaseWhenPtr) != releaseString(t.ReleaseWhenPtr) {
+		details = append(details, fmt.Sprintf("release_when: '%s' -> '%s'",
+			releaseString(current.ReleaseWhenPtr), releaseString(t.ReleaseWhenPtr)))
+	}
+	if current.DataExpiry != t.DataExpiry {
+		details = append(details, fmt.Sprintf("data_expiry: %d -> %d", current.DataExpiry, t.DataExpiry))
+	}
+
+	changed, err := actionsDiffer(current.Actions, t.Actions)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		details = append(details, fmt.Sprintf("actions: %d -> %d, changed", len(current.Actions), len(t.Actions)))
+	}
+	return details, nil
+}
+
+func (p *planner) planTriggers() error {
+	var names []string
+	for _, t := range p.cfg.Triggers {
+		names = append(names, t.Name)
+	}
+	if err := checkUnique(keyTrigger, names); err != nil {
+		return err
+	}
+
+	pid := p.projectId
+	for i := range p.cfg.Triggers {
+		t, err := p.cfg.Triggers[i].trigger(pid)
+		if err != nil {
+			return err
+		}
+		fields, ok := p.namespaceFields(t.Namespace)
+		if !ok {
+			return fmt.Errorf("Trigger '%s' uses namespace '%s', which is neither in the file nor in the project.",
+				t.TriggerName, t.Namespace)
+		}
+		if !p.skipFieldCheck {
+			refs, err := referencedFields(t)
+			if err != nil {
+				return err
+			}
+			if err := checkFieldRefs(refs, fields, t.Namespace); err != nil {
+				return fmt.Errorf("Trigger '%s': %v", t.TriggerName, err)
+			}
+		}
+
+		var current *fullTrigger
+		for j := range p.live.triggers {
+			if p.live.triggers[j].TriggerName == t.TriggerName {
+				current = &p.live.triggers[j]
+			}
+		}
+		if current == nil {
+			p.add(planChange{op: planCreate, kind: keyTrigger, name: t.TriggerName, apply: func(ctx *Context) error {
+				return _postProjectResource(ctx, pid, baseApiPath[keyTrigger], t)
+			}})
+			continue
+		}
+
+		// The actions of a disabled or muted trigger are kept locally until
+		// it is enabled, so they are left as they are.
+		var note string
+		if status := p.live.states.statusOf(current); status != nil {
+			if changed, err := actionsDiffer(current.Actions, t.Actions); err != nil {
+				return err
+			} else if changed {
+				note = "actions are not changed while the trigger is " + status.State + "; enable it and apply again"
+			}
+			t.Actions = current.Actions
+		}
+		details, err := triggerDetails(current, t)
+		if err != nil {
+			return err
+		}
+		if len(note) > 0 {
+			details = append(details, note)
+		}
+		if len(details) == 0 {
+			continue
+		}
+		t.TriggerId = current.TriggerId
+		p.add(planChange{op: planUpdate, kind: keyTrigger, name: t.TriggerName, details: details, apply: func(ctx *Context) error {
+			return _putTrigger(ctx, t)
+		}})
+	}
+
+	for _, t := range p.live.triggers {
+		if !isInList(t.TriggerName, names) {
+			path := getUrlForTriggerId(t.TriggerId)
+			p.remove(keyTrigger, t.TriggerName, func(ctx *Context) error {
+				return _deleteProjectResource(ctx, pid, path)
+			})
+		}
+	}
+	return nil
+}
+
+// appDetails describes how app differs from current. Secret values are not
+// shown.
+func appDetails(current, app *appData) []string {
+	var details []string
+	if current.Bundle.URI != app.Bundle.URI || current.Bundle.Checksum.Sum != app.Bundle.Checksum.Sum {
+		details = append(details, fmt.Sprintf("bundle: %s -> %s", current.Bundle.URI, app.Bundle.URI))
+	}
+	if current.Bundle.Type != app.Bundle.Type {
+		details = append(details, fmt.Sprintf("bundle type: %s -> %s", current.Bundle.Type, app.Bundle.Type))
+	}
+	if current.RequestedStatus != app.RequestedStatus {
+		details = append(details, fmt.Sprintf("status: %s -> %s", current.RequestedStatus, app.RequestedStatus))
+	}
+	for _, k := range changedKeys(current.Config, app.Config) {
+		details = append(details, fmt.Sprintf("config %s: '%s' -> '%s'", k, current.Config[k], app.Config[k]))
+	}
+	for _, k := range changedKeys(current.Secrets, app.Secrets) {
+		details = append(details, fmt.Sprintf("secret %s changed", k))
+	}
+	return details
+}
+
+// changedKeys returns the sorted keys whose values differ between a and b.
+func changedKeys(a, b map[string]string) []string {
+	var keys []string
+	for k, v := range a {
+		if other, ok := b[k]; !ok || other != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (p *planner) planApps() error {
+	var names []string
+	for _, a := range p.cfg.Apps {
+		names = append(names, a.Name)
+	}
+	if err := checkUnique(keyApp, names); err != nil {
+		return err
+	}
+
+	pid := p.projectId
+	for i := range p.cfg.Apps {
+		app, err := p.cfg.Apps[i].app(pid, p.live.files)
+		if err != nil {
+			return err
+		}
+		var current *appData
+		for j := range p.live.apps {
+			if p.live.apps[j].AppName == app.AppName {
+				current = &p.live.apps[j]
+			}
+		}
+		if current == nil {
+			p.add(planChange{op: planCreate, kind: keyApp, name: app.AppName, apply: func(ctx *Context) error {
+				return _postProjectResource(ctx, pid, baseApiPath[keyApp], app)
+			}})
+			continue
+		}
+
+		details := appDetails(current, app)
+		if len(details) == 0 {
+			continue
+		}
+		app.AppId = current.AppId
+		p.add(planChange{op: planUpdate, kind: keyApp, name: app.AppName, details: details, apply: func(ctx *Context) error {
+			_, err := _putApp(ctx, app)
+			return err
+		}})
+	}
+
+	for _, a := range p.live.apps {
+		if !isInList(a.AppName, names) {
+			path := getUrlforAppId(a.AppId)
+			p.remove(keyApp, a.AppName, func(ctx *Context) error {
+				return _deleteProjectResource(ctx, pid, path)
+			})
+		}
+	}
+	return nil
+}
+
+func permissionsString(d *addUserData) string {
+	var perms []string
+	if d.Read {
+		perms = append(perms, "READ")
+	}
+	if d.Write {
+		perms = append(perms, "WRITE")
+	}
+	if d.Admin {
+		perms = append(perms, "ADMIN")
+	}
+	if len(perms) == 0 {
+		return "none"
+	}
+	return strings.Join(perms, " ")
+}
+
+func (p *planner) planPermissions() error {
+	var users []string
+	for _, d := range p.cfg.Permissions {
+		users = append(users, strconv.FormatUint(d.UserId, 10))
+	}
+	if err := checkUnique(kindPermission, users); err != nil {
+		return err
+	}
+
+	pid := p.projectId
+	live := make(map[uint64]addUserData)
+	for _, d := range p.live.permissions {
+		live[d.UserId] = d
+	}
+	for _, d := range p.cfg.Permissions {
+		perm := &addUserData{projectId: pid, UserId: d.UserId, Read: d.Read, Write: d.Write, Admin: d.Admin}
+		name := "user " + strconv.FormatUint(d.UserId, 10)
+		apply := func(ctx *Context) error {
+			return _setUserPermissions(ctx, perm)
+		}
+		current, ok := live[d.UserId]
+		if !ok {
+			p.add(planChange{op: planCreate, kind: kindPermission, name: name, details: []string{permissionsString(perm)}, apply: apply})
+		} else if permissionsString(&current) != permissionsString(perm) {
+			details := []string{fmt.Sprintf("%s -> %s", permissionsString(&current), permissionsString(perm))}
+			p.add(planChange{op: planUpdate, kind: kindPermission, name: name, details: details, apply: apply})
+		}
+	}
+
+	for _, d := range p.live.permissions {
+		id := strconv.FormatUint(d.UserId, 10)
+		if isInList(id, users) || d.UserId == p.activeUser {
+			continue
+		}
+		perm := &addUserData{projectId: pid, UserId: d.UserId}
+		p.remove(kindPermission, "user "+id, func(ctx *Context) error {
+			return _setUserPermissions(ctx, perm)
+		})
+	}
+	return nil
+}
+
+func _postProjectResource(ctx *Context, projectId uint64, path string, body interface{}) error {
+	_, err := ctx.Client.
+		Post(path).
+		Expect(201).
+		ProjectToken(ctx.Profile, projectId).
+		Body(body).
+		Execute()
+	return err
+}
+
+func _deleteProjectResource(ctx *Context, projectId uint64, path string) error {
+	_, err := ctx.Client.
+		Delete(path).
+		Expect(204).
+		ProjectToken(ctx.Profile, projectId).
+		Execute()
+	if err == nil {
+		ctx.forgetNames("")
+	}
+	return err
+}
+
+// _putNamespace replaces the namespace ns.
+func _putNamespace(ctx *Context, projectId uint64, ns *namespaceData) error {
+	_, err := ctx.Client.
+		Put(getUrlForNamespaceId(ns.NamespaceId)).
+		ProjectToken(ctx.Profile, projectId).
+		Body(ns).
+		Expect(204).
+		Execute()
+	if err == nil {
+		ctx.forgetNames(keyNamespace)
+	}
+	return err
+}
+
+// _patchDevice updates the name and type of device. Like 'device update',
+// it treats an unmodified device as success.
+func _patchDevice(ctx *Context, device *deviceData) error {
+	rsp, err := ctx.Client.
+		Patch("/v1/devices/"+device.DeviceId).
+		Expect(200).
+		ProjectToken(ctx.Profile, device.ProjectId).
+		Body(device).
+		Execute()
+	if err != nil && rsp != nil && rsp.Http().StatusCode == 204 {
+		return nil
+	}
+	if err == nil {
+		ctx.forgetNames(kindDevice)
+	}
+	return err
+}
+
+// _setUserPermissions sets the permissions of a user in a project, adding
+// the user if needed. A user without permissions is removed.
+func _setUserPermissions(ctx *Context, d *addUserData) error {
+	rsp, err := ctx.Client.
+		Patch(fmt.Sprintf("/v1/projects/%d/permissions", d.projectId)).
+		UserToken(ctx.Profile).
+		Body(d).
+		Expect(200).
+		Execute()
+	if err != nil && rsp != nil && (rsp.Http().StatusCode == 201 || rsp.Http().StatusCode == 204) {
+		return nil
+	}
+	return err
+}
+
+type projectConfigArgs struct {
+	projectId      uint64
+	file           string
+	prune          bool
+	skipFieldCheck bool
+	force          bool
+}
+
+func (a *projectConfigArgs) IsValid() bool {
+	return a.projectId > 0 && len(a.file) > 0
+}
+
+func newProjectConfigCmd(ctx *Context, name, usage string, action Action) *Command {
+	args := new(projectConfigArgs)
+	cmd := &Command{
+		Name:   name,
+		Usage:  usage,
+		Data:   args,
+		Action: action,
+	}
+	flags := cmd.NewFlagSet("iobeam " + name)
+	flags.StringVar(&args.file, "f", "", "YAML file declaring the namespaces, devices, triggers, apps and permissions of the project (REQUIRED)")
+	flags.Uint64Var(&args.projectId, "projectId", ctx.Profile.ActiveProject, "Project ID (defaults to active project).")
+	flags.BoolVar(&args.prune, "prune", false, "Delete resources that are not in the file. Without it they are left alone.")
+	flags.BoolVar(&args.skipFieldCheck, "skipFieldCheck", false, "Do not check that trigger conditions and templates only use fields of their namespace.")
+
+	return cmd
+}
+
+// NewPlanCommand returns the 'plan' command.
+func NewPlanCommand(ctx *Context) *Command {
+	return newProjectConfigCmd(ctx, "plan",
+		"Show what 'iobeam apply' would create, update and delete to make a project match a YAML file.", planProject)
+}
+
+// NewApplyCommand returns the 'apply' command.
+func NewApplyCommand(ctx *Context) *Command {
+	cmd := newProjectConfigCmd(ctx, "apply",
+		"Create, update and delete resources to make a project match a YAML file. "+
+			"Changes are made in dependency order and stop at the first error.", applyProject)
+	args := cmd.Data.(*projectConfigArgs)
+	cmd.flags.BoolVar(&args.force, "force", false, "Do not ask for confirmation before deleting resources.")
+	return cmd
+}
+
+func makeProjectPlan(ctx *Context, args *projectConfigArgs) (*projectPlan, error) {
+	data, err := ioutil.ReadFile(args.file)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseProjectConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid project file '%s': %v", args.file, err)
+	}
+	live, err := _getLiveState(ctx, args.projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &planner{
+		cfg:            cfg,
+		live:           live,
+		projectId:      args.projectId,
+		prune:          args.prune,
+		skipFieldCheck: args.skipFieldCheck,
+		activeUser:     ctx.Profile.ActiveUser,
+	}
+	return p.buildPlan()
+}
+
+func planProject(c *Command, ctx *Context) error {
+	plan, err := makeProjectPlan(ctx, c.Data.(*projectConfigArgs))
+	if err != nil {
+		return err
+	}
+	fmt.Print(plan)
+	return nil
+}
+
+func applyProject(c *Command, ctx *Context) error {
+	args := c.Data.(*projectConfigArgs)
+	plan, err := makeProjectPlan(ctx, args)
+	if err != nil {
+		return err
+	}
+	fmt.Print(plan)
+	if len(plan.changes) == 0 {
+		return nil
+	}
+	if n := plan.count(planDelete); n > 0 && !confirm(fmt.Sprintf("\nApply, deleting %d resources?", n), args.force) {
+		return fmt.Errorf("Aborted, nothing was changed.")
+	}
+
+	fmt.Println()
+	return applyPlan(ctx, plan)
+}
+
+var planProgress = map[string]string{planCreate: "Creating", planUpdate: "Updating", planDelete: "Deleting"}
+
+// applyPlan makes the changes of plan in order, stopping at the first error.
+func applyPlan(ctx *Context, plan *projectPlan) error {
+	for i := range plan.changes {
+		c := &plan.changes[i]
+		fmt.Printf("%s %s %s...\n", planProgress[c.op], c.kind, c.name)
+		if err := c.apply(ctx); err != nil {
+			return fmt.Errorf("Apply stopped, could not %s %s %s: %v\n"+
+				"%d of %d changes were made. Fix the problem and run 'iobeam apply' again.",
+				c.op, c.kind, c.name, err, i, len(plan.changes))
+		}
+	}
+	fmt.Printf("Apply complete: %d created, %d updated, %d deleted.\n",
+		plan.count(planCreate), plan.count(planUpdate), plan.count(planDelete))
+	return nil
+}
@@ -0,0 +1,222 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testProjectConfig = `
+namespaces:
+  - name: input
+    partitioning_field: device_id
+    fields: {device_id: STRING, temp: DOUBLE, hum: DOUBLE}
+  - name: events
+    partitioning_field: kind
+    fields: {kind: STRING}
+devices:
+  - id: dev-a
+    name: kitchen
+triggers:
+  - name: hot
+    namespace: input
+    fire_when: '{{ temp }} > 35'
+    actions:
+      - type: email
+        args: {to: [ops@example.com], payload: "Temperature is {{temp}}"}
+  - name: alarm
+    namespace: events
+    fire_when: '{{ kind }} == "alarm"'
+apps:
+  - name: agg
+    bundle: agg.jar
+    config: {window: 60}
+permissions:
+  - user_id: 9
+    read: true
+`
+
+func testLiveState() *liveState {
+	release := "{{ temp }} < 25"
+	return &liveState{
+		namespaces: []namespaceData{
+			{Name: "input", NamespaceId: 3, PartitioningField: "device_id", Fields: map[string]string{"device_id": typeString, "temp": typeDouble}},
+		},
+		devices: []deviceData{{DeviceId: "dev-old"}},
+		triggers: []fullTrigger{
+			{triggerData: triggerData{TriggerId: 5, TriggerName: "hot", Namespace: "input", FireWhen: "{{ temp }} > 30", ReleaseWhenPtr: &release},
+				Actions: []triggerAction{{Type: "email", Args: map[string]interface{}{"to": []interface{}{"ops@example.com"}, "payload": "Temperature is {{temp}}"}}}},
+		},
+		files:       []fileInfo{{Name: "agg.jar", Checksum: checksum{Algorithm: "SHA-256", Sum: "abc"}}},
+		permissions: []addUserData{{UserId: 1, Read: true, Write: true, Admin: true}, {UserId: 7, Read: true}},
+		states:      make(triggerStates),
+	}
+}
+
+func testPlanner(t *testing.T, config string, prune bool) *planner {
+	cfg, err := parseProjectConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("unexpected error parsing config: %v", err)
+	}
+	return &planner{cfg: cfg, live: testLiveState(), projectId: 2, prune: prune, activeUser: 1}
+}
+
+func TestBuildPlan(t *testing.T) {
+	plan, err := testPlanner(t, testProjectConfig, true).buildPlan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "~ namespace input\n" +
+		"    + hum DOUBLE\n" +
+		"+ namespace events\n" +
+		"    partitioning field kind\n" +
+		"    + kind STRING\n" +
+		"+ device dev-a\n" +
+		"~ trigger hot\n" +
+		"    fire_when: '{{ temp }} > 30' -> '{{ temp }} > 35'\n" +
+		"    release_when: '{{ temp }} < 25' -> ''\n" +
+		"+ trigger alarm\n" +
+		"+ app agg\n" +
+		"+ permission user 9\n" +
+		"    READ\n" +
+		"- permission user 7\n" +
+		"- device dev-old\n" +
+		"\nPlan: 5 to create, 2 to update, 2 to delete.\n"
+	if got := plan.String(); got != want {
+		t.Errorf("got plan\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestBuildPlanWithoutPrune(t *testing.T) {
+	plan, err := testPlanner(t, testProjectConfig, false).buildPlan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plan.count(planDelete) != 0 {
+		t.Errorf("expected no deletes without -prune, got %d", plan.count(planDelete))
+	}
+	if fmt.Sprint(plan.unmanaged) != "[device dev-old permission user 7]" {
+		t.Errorf("unexpected unmanaged resources: %v", plan.unmanaged)
+	}
+}
+
+func TestBuildPlanNoChanges(t *testing.T) {
+	config := `
+namespaces:
+  - name: input
+    fields: {device_id: STRING, temp: DOUBLE}
+triggers:
+  - name: hot
+    namespace: input
+    fire_when: '{{ temp }} > 30'
+    release_when: '{{ temp }} < 25'
+    actions:
+      - type: email
+        args: {to: [ops@example.com], payload: "Temperature is {{temp}}"}
+`
+	p := testPlanner(t, config, false)
+	p.live.devices = nil
+	p.live.permissions = nil
+	plan, err := p.buildPlan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := plan.String(); got != "No changes, the project matches the file.\n" {
+		t.Errorf("unexpected plan:\n%s", got)
+	}
+}
+
+func TestBuildPlanErrors(t *testing.T) {
+	cases := []struct {
+		desc   string
+		config string
+		want   string
+	}{
+		{
+			desc:   "field removed",
+			config: "namespaces:\n  - name: input\n    fields: {device_id: STRING}\n",
+			want:   "namespace migrate",
+		},
+		{
+			desc: "unknown trigger field",
+			config: "triggers:\n  - name: t\n    namespace: input\n    fire_when: '{{ temp }} > 30'\n    actions:\n" +
+				"      - type: email\n        args: {to: [a@example.com], payload: \"{{tmp}}\"}\n",
+			want: "did you mean 'temp'?",
+		},
+		{
+			desc:   "unknown namespace",
+			config: "triggers:\n  - name: t\n    namespace: other\n    fire_when: '{{ temp }} > 30'\n",
+			want:   "neither in the file nor in the project",
+		},
+		{
+			desc:   "bad action args",
+			config: "triggers:\n  - name: t\n    namespace: input\n    fire_when: '{{ temp }} > 30'\n    actions:\n      - type: http\n        args: {uri: x}\n",
+			want:   "Bad args",
+		},
+		{
+			desc:   "missing bundle",
+			config: "apps:\n  - name: a\n    bundle: other.jar\n",
+			want:   "not a file in the project",
+		},
+		{
+			desc:   "duplicate device",
+			config: "devices:\n  - id: a\n  - id: a\n",
+			want:   "more than one device 'a'",
+		},
+	}
+	for _, c := range cases {
+		_, err := testPlanner(t, c.config, false).buildPlan()
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got error %v, want one containing '%s'", c.desc, err, c.want)
+		}
+	}
+}
+
+func TestDisabledTriggerKeepsActions(t *testing.T) {
+	config := `
+triggers:
+  - name: hot
+    namespace: input
+    fire_when: '{{ temp }} > 30'
+    release_when: '{{ temp }} < 25'
+    actions:
+      - type: email
+        args: {to: [ops@example.com], payload: "Temperature is {{temp}}"}
+`
+	p := testPlanner(t, config, false)
+	p.live.triggers[0].Actions = nil
+	p.live.states[stateKey(5)] = &triggerState{triggerStatus: triggerStatus{State: triggerStateDisabled}}
+	plan, err := p.buildPlan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := plan.changes[0]
+	if len(plan.changes) != 1 || !strings.Contains(c.details[0], "not changed while the trigger is disabled") {
+		t.Errorf("unexpected plan:\n%s", plan)
+	}
+}
+
+func TestApplyPlanStopsOnError(t *testing.T) {
+	var applied []string
+	change := func(name string, err error) planChange {
+		return planChange{op: planCreate, kind: kindDevice, name: name, apply: func(ctx *Context) error {
+			applied = append(applied, name)
+			return err
+		}}
+	}
+	plan := &projectPlan{changes: []planChange{
+		change("a", nil),
+		change("b", fmt.Errorf("boom")),
+		change("c", nil),
+	}}
+
+	err := applyPlan(nil, plan)
+	if err == nil || !strings.Contains(err.Error(), "could not create device b: boom") ||
+		!strings.Contains(err.Error(), "1 of 3 changes were made") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if fmt.Sprint(applied) != "[a b]" {
+		t.Errorf("expected apply to stop after b, applied %v", applied)
+	}
+}
@@ -38,10 +38,12 @@ func NewProjectsCommand(ctx *Context) *Command {
 		Usage: "Commands for managing projects.",
 		SubCommands: Mux{
 			"add-user":    newAddUserProjectCmd(ctx),
+			"backup":      newBackupProjectCmd(ctx),
 			"create":      newCreateProjectCmd(),
 			"get":         newGetProjectCmd(ctx),
 			"list":        newListProjectsCmd(),
 			"permissions": newProjectPermissionsCmd(ctx),
+			"restore":     newRestoreProjectCmd(ctx),
 			"switch":      newProjectSwitchCmd(),
 			"token":       newGetProjectTokenCmd(ctx),
 			"update":      newUpdateProjectCmd(ctx),
@@ -0,0 +1,91 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const descForce = "Do not ask for confirmation."
+
+// resourceRef is the ID and name of an API resource, used when looking up
+// resources by name.
+type resourceRef struct {
+	id   string
+	name string
+}
+
+// resolveRef returns the ID of the single ref in refs called name. kind is
+// the type of resource (e.g. "trigger") and is used in error messages.
+func resolveRef(kind, name string, refs []resourceRef) (string, error) {
+	var matches []string
+	for _, r := range refs {
+		if r.name == name {
+			matches = append(matches, r.id)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("No %s named '%s' found", kind, name)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%s name '%s' is ambiguous, it matches IDs: %s (use the ID instead)",
+			strings.Title(kind), name, strings.Join(matches, ", "))
+	}
+}
+
+// resolveName returns the ID of the resource of type kind called name in a
+// project. IDs are cached in ctx, so list is only called if the name has not
+// been resolved before or resources of that kind have changed since.
+func resolveName(ctx *Context, kind string, projectId uint64, name string, list func() ([]resourceRef, error)) (string, error) {
+	key := fmt.Sprintf("%s/%d/%s", kind, projectId, name)
+	if id, ok := ctx.resolvedNames[key]; ok {
+		return id, nil
+	}
+
+	refs, err := list()
+	if err != nil {
+		return "", err
+	}
+	id, err := resolveRef(kind, name, refs)
+	if err == nil {
+		if ctx.resolvedNames == nil {
+			ctx.resolvedNames = make(map[string]string)
+		}
+		ctx.resolvedNames[key] = id
+	}
+	return id, err
+}
+
+// forgetNames drops the cached IDs of resources of type kind, or of all
+// resources if kind is empty. It is called after resources are renamed or
+// deleted, so that their old names no longer resolve.
+func (ctx *Context) forgetNames(kind string) {
+	for key := range ctx.resolvedNames {
+		if len(kind) == 0 || strings.HasPrefix(key, kind+"/") {
+			delete(ctx.resolvedNames, key)
+		}
+	}
+}
+
+// confirm asks the user to confirm an operation, unless force is set.
+func confirm(prompt string, force bool) bool {
+	if force {
+		return true
+	}
+	return readBoolean(prompt+" (y)es/(n)o: ", bufio.NewReader(os.Stdin))
+}
+
+// confirmByName asks the user to confirm a destructive operation on a
+// resource that was selected by name rather than ID. verb describes the
+// operation, e.g. "delete".
+func confirmByName(verb, kind, name, id string, force bool) error {
+	prompt := fmt.Sprintf("%s%s %s '%s' (ID %s)?", strings.ToUpper(verb[:1]), verb[1:], kind, name, id)
+	if !confirm(prompt, force) {
+		return fmt.Errorf("Aborted, %s '%s' was not changed.", kind, name)
+	}
+	return nil
+}
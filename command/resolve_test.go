@@ -0,0 +1,87 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveRef(t *testing.T) {
+	refs := []resourceRef{
+		{id: "1", name: "alpha"},
+		{id: "2", name: "beta"},
+		{id: "3", name: "beta"},
+	}
+
+	cases := []struct {
+		desc    string
+		name    string
+		want    string
+		wantErr string
+	}{
+		{desc: "single match", name: "alpha", want: "1"},
+		{desc: "no match", name: "gamma", wantErr: "No trigger named 'gamma' found"},
+		{desc: "ambiguous", name: "beta", wantErr: "matches IDs: 2, 3"},
+		{desc: "names are case sensitive", name: "Alpha", wantErr: "No trigger named"},
+	}
+
+	for _, c := range cases {
+		got, err := resolveRef("trigger", c.name, refs)
+		if len(c.wantErr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Errorf("case '%s': expected error containing '%s', got %v", c.desc, c.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case '%s': unexpected error: %v", c.desc, err)
+		} else if got != c.want {
+			t.Errorf("case '%s': got '%s', want '%s'", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestConfirmByNameForced(t *testing.T) {
+	if err := confirmByName("delete", "trigger", "alpha", "1", true); err != nil {
+		t.Errorf("forced confirmation returned error: %v", err)
+	}
+}
+
+func TestResolveNameCaches(t *testing.T) {
+	ctx := new(Context)
+	calls := 0
+	list := func() ([]resourceRef, error) {
+		calls++
+		return []resourceRef{{id: "5", name: "cached"}}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		id, err := resolveName(ctx, "app", 42, "cached", list)
+		if err != nil || id != "5" {
+			t.Errorf("attempt %d: got '%s', %v", i, id, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected list to be called once, got %d", calls)
+	}
+
+	// Other projects are resolved separately.
+	if _, err := resolveName(ctx, "app", 43, "cached", list); err != nil || calls != 2 {
+		t.Errorf("expected a new lookup for another project, got %d calls and error %v", calls, err)
+	}
+	// Failed lookups are not cached.
+	resolveName(ctx, "app", 42, "missing", list)
+	resolveName(ctx, "app", 42, "missing", list)
+	if calls != 4 {
+		t.Errorf("expected failed lookups to be retried, got %d calls", calls)
+	}
+
+	// Changes to apps drop their cached IDs, but not those of other kinds.
+	resolveName(ctx, keyTrigger, 42, "cached", list)
+	ctx.forgetNames(keyApp)
+	if _, err := resolveName(ctx, "app", 42, "cached", list); err != nil || calls != 6 {
+		t.Errorf("expected a new lookup after forgetting apps, got %d calls and error %v", calls, err)
+	}
+	if _, err := resolveName(ctx, keyTrigger, 42, "cached", list); err != nil || calls != 6 {
+		t.Errorf("expected the trigger to stay cached, got %d calls and error %v", calls, err)
+	}
+}
@@ -0,0 +1,151 @@
+package command
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const descSkipFieldCheck = "Skip checking that fields referenced by the trigger exist in its namespace."
+
+// fieldRefRegexp matches field references in trigger conditions and action
+// templates, e.g. "{{ temp }}".
+var fieldRefRegexp = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// implicitFields are fields that every namespace has, even though they are
+// not part of its schema.
+var implicitFields = []string{"time"}
+
+// extractFieldRefs returns the names of all fields referenced in s.
+func extractFieldRefs(s string) []string {
+	var refs []string
+	for _, m := range fieldRefRegexp.FindAllStringSubmatch(s, -1) {
+		refs = append(refs, m[1])
+	}
+	return refs
+}
+
+// referencedFields returns the sorted, unique names of fields referenced by
+// t's conditions and action templates. Actions of types the CLI does not know
+// are skipped, since it cannot tell which of their args are templates.
+func referencedFields(t *fullTrigger) ([]string, error) {
+	texts := []string{t.FireWhen}
+	if t.ReleaseWhenPtr != nil {
+		texts = append(texts, *t.ReleaseWhenPtr)
+	}
+	for i := range t.Actions {
+		if _, ok := actionTypes[t.Actions[i].Type]; !ok {
+			continue
+		}
+		typed, err := t.Actions[i].typedArgs()
+		if err != nil {
+			return nil, err
+		}
+		texts = append(texts, typed.templates()...)
+	}
+
+	seen := make(map[string]bool)
+	var refs []string
+	for _, text := range texts {
+		for _, ref := range extractFieldRefs(text) {
+			if !seen[ref] {
+				seen[ref] = true
+				refs = append(refs, ref)
+			}
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// closestMatch returns the candidate closest to name, if any is close enough
+// to be a likely typo of it.
+func closestMatch(name string, candidates []string) (string, bool) {
+	best := ""
+	bestDist := -1
+	for _, c := range candidates {
+		d := editDistance(strings.ToLower(name), strings.ToLower(c))
+		if bestDist < 0 || d < bestDist || (d == bestDist && c < best) {
+			best, bestDist = c, d
+		}
+	}
+
+	maxDist := len(name) / 3
+	if maxDist < 2 {
+		maxDist = 2
+	}
+	return best, bestDist >= 0 && bestDist <= maxDist
+}
+
+// checkFieldRefs returns an error describing every field in refs that is not
+// in fields, with suggestions for likely typos.
+func checkFieldRefs(refs []string, fields map[string]string, namespace string) error {
+	known := append([]string{}, implicitFields...)
+	for f := range fields {
+		known = append(known, f)
+	}
+	sort.Strings(known)
+
+	var unknown []string
+	for _, ref := range refs {
+		if isInList(ref, known) {
+			continue
+		}
+		msg := fmt.Sprintf("'%s'", ref)
+		if match, ok := closestMatch(ref, known); ok {
+			msg += fmt.Sprintf(" (did you mean '%s'?)", match)
+		}
+		unknown = append(unknown, msg)
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("Trigger references unknown field(s) in namespace '%s': %s\n"+
+			"Known fields: %s", namespace, strings.Join(unknown, ", "), strings.Join(known, ", "))
+	}
+	return nil
+}
+
+// validateTriggerFields checks that all fields referenced by t exist in the
+// schema of its namespace.
+func validateTriggerFields(ctx *Context, t *fullTrigger) error {
+	refs, err := referencedFields(t)
+	if err != nil || len(refs) == 0 {
+		return err
+	}
+
+	ns, err := _getNamespaceByName(ctx, t.ProjectId, t.Namespace)
+	if err != nil {
+		return fmt.Errorf("Could not check trigger fields: %v", err)
+	}
+	return checkFieldRefs(refs, ns.Fields, ns.Name)
+}
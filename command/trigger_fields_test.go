@@ -0,0 +1,78 @@
+package command
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReferencedFields(t *testing.T) {
+	release := "{{temp}} < 22.0"
+	trigger := &fullTrigger{
+		triggerData: triggerData{
+			FireWhen:       "{{ temp }} > 25.0 && {{ humidity }} > 50",
+			ReleaseWhenPtr: &release,
+		},
+		Actions: []triggerAction{
+			{Type: "email", Args: &emailActionData{Subject: "Hot: {{ device_id }}", Payload: "{{ temp }}"}},
+			{Type: "http", Args: map[string]interface{}{"url": "iobeam.com", "payload": "{{ battery }}"}},
+			{Type: "pager", Args: map[string]interface{}{"message": "{{ unknown }}"}},
+		},
+	}
+
+	want := []string{"battery", "device_id", "humidity", "temp"}
+	got, err := referencedFields(trigger)
+	if err != nil {
+		t.Fatalf("referencedFields failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("referencedFields() == %v, want %v", got, want)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"temp", "temp", 0},
+		{"tmep", "temp", 2},
+		{"temp", "temps", 1},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+	}
+	for _, c := range cases {
+		if got := editDistance(c.a, c.b); got != c.want {
+			t.Errorf("editDistance(%s, %s) == %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestClosestMatch(t *testing.T) {
+	candidates := []string{"temperature", "humidity", "time"}
+	if got, ok := closestMatch("temperatur", candidates); !ok || got != "temperature" {
+		t.Errorf("closestMatch(temperatur) == %s, %v; want temperature, true", got, ok)
+	}
+	if got, ok := closestMatch("Humidty", candidates); !ok || got != "humidity" {
+		t.Errorf("closestMatch(Humidty) == %s, %v; want humidity, true", got, ok)
+	}
+	if got, ok := closestMatch("battery", candidates); ok {
+		t.Errorf("closestMatch(battery) == %s, want no match", got)
+	}
+}
+
+func TestCheckFieldRefs(t *testing.T) {
+	fields := map[string]string{"temp": "DOUBLE", "device_id": "STRING"}
+	if err := checkFieldRefs([]string{"temp", "time"}, fields, "input"); err != nil {
+		t.Errorf("checkFieldRefs failed for known fields: %v", err)
+	}
+
+	err := checkFieldRefs([]string{"tmep"}, fields, "input")
+	if err == nil {
+		t.Fatalf("checkFieldRefs accepted unknown field")
+	}
+	if !strings.Contains(err.Error(), "did you mean 'temp'?") {
+		t.Errorf("error has no suggestion: %v", err)
+	}
+}
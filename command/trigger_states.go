@@ -0,0 +1,297 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	triggerStateDisabled = "disabled"
+	triggerStateMuted    = "muted"
+
+	// triggerStatesFile is stored in the profile directory and keeps the
+	// actions of disabled and muted triggers so they can be restored.
+	triggerStatesFile = "trigger_states.json"
+
+	stateTimeFormat = time.RFC3339
+)
+
+// triggerStatus describes who disabled or muted a trigger, and when.
+type triggerStatus struct {
+	State string     `json:"state"`
+	By    string     `json:"by"`
+	At    time.Time  `json:"at"`
+	Until *time.Time `json:"until,omitempty"`
+}
+
+func (s *triggerStatus) isExpired(now time.Time) bool {
+	return s.Until != nil && now.After(*s.Until)
+}
+
+func (s *triggerStatus) String() string {
+	by := fmt.Sprintf("by %s at %s", s.By, s.At.Format(stateTimeFormat))
+	if s.State == triggerStateDisabled {
+		return fmt.Sprintf("DISABLED (%s)", by)
+	}
+	if s.isExpired(time.Now()) {
+		return fmt.Sprintf("MUTED, expired at %s (%s); run 'iobeam trigger enable' to restore actions",
+			s.Until.Format(stateTimeFormat), by)
+	}
+	return fmt.Sprintf("MUTED until %s (%s)", s.Until.Format(stateTimeFormat), by)
+}
+
+// triggerState is the locally stored state of a disabled or muted trigger,
+// including the actions that were removed from it.
+type triggerState struct {
+	triggerStatus
+	TriggerId uint64          `json:"trigger_id"`
+	ProjectId uint64          `json:"project_id"`
+	Actions   []triggerAction `json:"actions"`
+}
+
+// triggerStates maps trigger IDs to their stored state.
+type triggerStates map[string]*triggerState
+
+func stateKey(triggerId uint64) string {
+	return strconv.FormatUint(triggerId, 10)
+}
+
+func readTriggerStates(ctx *Context) (triggerStates, error) {
+	states := make(triggerStates)
+	err := ctx.Profile.ReadData(triggerStatesFile, &states)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	return states, err
+}
+
+func (s triggerStates) save(ctx *Context) error {
+	return ctx.Profile.SaveData(triggerStatesFile, s)
+}
+
+// endExpiredMutes restores the actions of muted triggers whose time is up
+// and removes their state, returning the updated triggers by ID. Mutes that
+// cannot be ended are reported and tried again next time. Messages go to
+// stderr so they do not mix with structured output.
+func (s triggerStates) endExpiredMutes(ctx *Context, now time.Time) map[uint64]*fullTrigger {
+	ended := make(map[uint64]*fullTrigger)
+	for key, state := range s {
+		if state.State != triggerStateMuted || !state.isExpired(now) {
+			continue
+		}
+		trigger, err := _getTrigger(ctx, &triggerBaseArgs{projectId: state.ProjectId, triggerId: state.TriggerId})
+		if err == nil {
+			trigger.Actions = append(state.Actions, trigger.Actions...)
+			err = _putTrigger(ctx, trigger)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not end the expired mute of trigger %d: %v\n", state.TriggerId, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Mute of trigger %d expired, %d action(s) restored.\n", state.TriggerId, len(state.Actions))
+		delete(s, key)
+		ended[state.TriggerId] = trigger
+	}
+	return ended
+}
+
+// loadTriggerStates reads the trigger states after ending the mutes that
+// have expired, which are returned as by endExpiredMutes. It is used by the
+// commands that change trigger states; listing triggers only reads them.
+func loadTriggerStates(ctx *Context) (triggerStates, map[uint64]*fullTrigger, error) {
+	states, err := readTriggerStates(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ended := states.endExpiredMutes(ctx, time.Now())
+	if len(ended) > 0 {
+		if err := states.save(ctx); err != nil {
+			return states, ended, fmt.Errorf("Could not update trigger state: %v", err)
+		}
+	}
+	return states, ended, nil
+}
+
+// forgetTriggerState removes the stored state of a deleted trigger, so its
+// actions are not restored to a trigger that no longer exists.
+func forgetTriggerState(ctx *Context, triggerId uint64) error {
+	states, err := readTriggerStates(ctx)
+	if err != nil {
+		return err
+	}
+	key := stateKey(triggerId)
+	if _, ok := states[key]; !ok {
+		return nil
+	}
+	delete(states, key)
+	return states.save(ctx)
+}
+
+// statusOf returns the local status of trigger t, or nil if it is neither
+// disabled nor muted.
+func (s triggerStates) statusOf(t *fullTrigger) *triggerStatus {
+	if state, ok := s[stateKey(t.TriggerId)]; ok {
+		return &state.triggerStatus
+	}
+	return nil
+}
+
+// currentUser returns a description of the active user for recording who
+// changed a trigger's state.
+func currentUser(ctx *Context) string {
+	if len(ctx.Profile.ActiveUserEmail) > 0 {
+		return ctx.Profile.ActiveUserEmail
+	}
+	return fmt.Sprintf("user %d", ctx.Profile.ActiveUser)
+}
+
+type triggerStateArgs struct {
+	triggerBaseArgs
+	state    string
+	duration time.Duration
+}
+
+func (a *triggerStateArgs) IsValid() bool {
+	durationOk := a.state != triggerStateMuted || a.duration > 0
+	return a.triggerBaseArgs.IsValid() && durationOk
+}
+
+func newTriggerStateCommand(ctx *Context, cmdStr, state, desc string, action Action) *Command {
+	a := &triggerStateArgs{state: state}
+	cmd := &Command{
+		Name: cmdStr,
+		// ApiPath determined by flags
+		Usage:  desc,
+		Data:   a,
+		Action: action,
+	}
+
+	flags := cmd.newFlagSetTrigger(cmdStr)
+	flags.Uint64Var(&a.projectId, "projectId", ctx.Profile.ActiveProject, "Project ID of trigger.")
+	flags.Uint64Var(&a.triggerId, "id", 0, "Trigger ID (either this or -name must be set).")
+	flags.StringVar(&a.triggerName, "name", "", "Trigger name (either this or -id must be set).")
+	if state == triggerStateMuted {
+		flags.DurationVar(&a.duration, "for", 0, "How long to mute the trigger for (ex. 2h, 30m). The actions are not "+
+			"restored on their own when the time is up, but by the next 'iobeam trigger mute', 'disable' or 'enable' "+
+			"command. (REQUIRED)")
+	}
+
+	return cmd
+}
+
+func newDisableTriggerCommand(ctx *Context) *Command {
+	return newTriggerStateCommand(ctx, "disable", triggerStateDisabled,
+		"Disable a trigger by removing its actions until it is enabled again.", stashActions)
+}
+
+func newMuteTriggerCommand(ctx *Context) *Command {
+	return newTriggerStateCommand(ctx, "mute", triggerStateMuted,
+		"Mute a trigger for a period of time, or until 'iobeam trigger enable' restores its actions. "+
+			"Mutes are kept locally: an expired mute stays in effect, shown as expired by 'iobeam trigger list', "+
+			"until the next mute, disable or enable command restores its actions.", stashActions)
+}
+
+func newEnableTriggerCommand(ctx *Context) *Command {
+	return newTriggerStateCommand(ctx, "enable", "",
+		"Enable a disabled or muted trigger by restoring its actions.", restoreActions)
+}
+
+// stashActions disables or mutes a trigger by saving its actions in the
+// profile directory and then removing them from the trigger.
+func stashActions(c *Command, ctx *Context) error {
+	args := c.Data.(*triggerStateArgs)
+	trigger, err := _getTrigger(ctx, &args.triggerBaseArgs)
+	if err != nil {
+		return err
+	}
+
+	states, ended, err := loadTriggerStates(ctx)
+	if err != nil {
+		return err
+	}
+	if t, ok := ended[trigger.TriggerId]; ok {
+		trigger = t
+	}
+
+	now := time.Now()
+	key := stateKey(trigger.TriggerId)
+	state, exists := states[key]
+	if exists && state.State == triggerStateDisabled && args.state == triggerStateMuted {
+		return fmt.Errorf("Trigger %d is disabled, enable it before muting it.", trigger.TriggerId)
+	}
+	if !exists {
+		state = &triggerState{
+			TriggerId: trigger.TriggerId,
+			ProjectId: trigger.ProjectId,
+			Actions:   trigger.Actions,
+		}
+		states[key] = state
+	}
+	state.State = args.state
+	state.By = currentUser(ctx)
+	state.At = now
+	state.Until = nil
+	if args.state == triggerStateMuted {
+		until := now.Add(args.duration)
+		state.Until = &until
+	}
+
+	// Save the actions before removing them so they cannot be lost.
+	if err := states.save(ctx); err != nil {
+		return fmt.Errorf("Could not save trigger state: %v", err)
+	}
+
+	if !exists {
+		trigger.Actions = []triggerAction{}
+		if err := _putTrigger(ctx, trigger); err != nil {
+			delete(states, key)
+			if saveErr := states.save(ctx); saveErr != nil {
+				fmt.Printf("Could not update trigger state: %v\n", saveErr)
+			}
+			return err
+		}
+	}
+
+	fmt.Printf("Trigger %d is now %s.\n", trigger.TriggerId, state.String())
+	return nil
+}
+
+// restoreActions enables a disabled or muted trigger by adding back the
+// actions that were saved in the profile directory.
+func restoreActions(c *Command, ctx *Context) error {
+	args := c.Data.(*triggerStateArgs)
+	trigger, err := _getTrigger(ctx, &args.triggerBaseArgs)
+	if err != nil {
+		return err
+	}
+
+	states, ended, err := loadTriggerStates(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := ended[trigger.TriggerId]; ok {
+		return nil
+	}
+
+	key := stateKey(trigger.TriggerId)
+	state, ok := states[key]
+	if !ok {
+		return fmt.Errorf("Trigger %d is not disabled or muted.", trigger.TriggerId)
+	}
+
+	// Keep any actions that were added while the trigger was disabled.
+	trigger.Actions = append(state.Actions, trigger.Actions...)
+	if err := _putTrigger(ctx, trigger); err != nil {
+		return err
+	}
+
+	delete(states, key)
+	if err := states.save(ctx); err != nil {
+		return fmt.Errorf("Actions restored, but could not update trigger state: %v", err)
+	}
+
+	fmt.Printf("Trigger %d enabled, %d action(s) restored.\n", trigger.TriggerId, len(state.Actions))
+	return nil
+}
@@ -0,0 +1,113 @@
+package command
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTriggerStateArgsValidity(t *testing.T) {
+	base := triggerBaseArgs{projectId: 1, triggerId: 1}
+	cases := []dataTestCase{
+		{
+			desc: "a valid triggerStateArgs object for muting",
+			in:   &triggerStateArgs{triggerBaseArgs: base, state: triggerStateMuted, duration: time.Hour},
+			want: true,
+		},
+		{
+			desc: "a valid triggerStateArgs object for disabling",
+			in:   &triggerStateArgs{triggerBaseArgs: base, state: triggerStateDisabled},
+			want: true,
+		},
+		{
+			desc: "invalid, muting requires a duration",
+			in:   &triggerStateArgs{triggerBaseArgs: base, state: triggerStateMuted},
+			want: false,
+		},
+		{
+			desc: testDescInvalidNoNameOrId,
+			in:   &triggerStateArgs{triggerBaseArgs: triggerBaseArgs{projectId: 1}},
+			want: false,
+		},
+	}
+	runDataTestCase(t, cases)
+}
+
+func TestTriggerStatusString(t *testing.T) {
+	at := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	future := time.Now().Add(time.Hour)
+	past := at.Add(time.Hour)
+
+	cases := []struct {
+		in   *triggerStatus
+		want string
+	}{
+		{
+			in:   &triggerStatus{State: triggerStateDisabled, By: "a@iobeam.com", At: at},
+			want: "DISABLED (by a@iobeam.com at 2016-05-01T12:00:00Z)",
+		},
+		{
+			in:   &triggerStatus{State: triggerStateMuted, By: "a@iobeam.com", At: at, Until: &future},
+			want: "MUTED until " + future.Format(stateTimeFormat),
+		},
+		{
+			in:   &triggerStatus{State: triggerStateMuted, By: "a@iobeam.com", At: at, Until: &past},
+			want: "MUTED, expired at 2016-05-01T13:00:00Z",
+		},
+	}
+
+	for _, c := range cases {
+		if got := c.in.String(); !strings.HasPrefix(got, c.want) {
+			t.Errorf("String() == %q, want prefix %q", got, c.want)
+		}
+	}
+}
+
+func TestTriggerStatesStatusOf(t *testing.T) {
+	states := triggerStates{
+		stateKey(2): &triggerState{
+			triggerStatus: triggerStatus{State: triggerStateDisabled},
+			TriggerId:     2,
+		},
+	}
+	if got := states.statusOf(&fullTrigger{triggerData: triggerData{TriggerId: 2}}); got == nil || got.State != triggerStateDisabled {
+		t.Errorf("statusOf(2) == %v, want disabled status", got)
+	}
+	if got := states.statusOf(&fullTrigger{triggerData: triggerData{TriggerId: 3}}); got != nil {
+		t.Errorf("statusOf(3) == %v, want nil", got)
+	}
+}
+
+func TestEndExpiredMutes(t *testing.T) {
+	var put fullTrigger
+	ctx := newTestContext(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "PUT" {
+			json.NewDecoder(r.Body).Decode(&put)
+		}
+		added := triggerAction{Type: "http", Args: map[string]interface{}{"uri": "http://example.com"}}
+		json.NewEncoder(w).Encode(fullTrigger{triggerData: triggerData{TriggerId: 1, ProjectId: 1}, Actions: []triggerAction{added}})
+	}))
+
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	stashed := []triggerAction{{Type: "email", Args: map[string]interface{}{"to": []interface{}{"ops@example.com"}}}}
+	states := triggerStates{
+		stateKey(1): &triggerState{triggerStatus: triggerStatus{State: triggerStateMuted, Until: &past}, TriggerId: 1, ProjectId: 1, Actions: stashed},
+		stateKey(2): &triggerState{triggerStatus: triggerStatus{State: triggerStateMuted, Until: &future}, TriggerId: 2, ProjectId: 1},
+		stateKey(3): &triggerState{triggerStatus: triggerStatus{State: triggerStateDisabled}, TriggerId: 3, ProjectId: 1},
+	}
+
+	ended := states.endExpiredMutes(ctx, now)
+	if len(ended) != 1 || ended[1] == nil {
+		t.Fatalf("expected only trigger 1 to be unmuted, got %v", ended)
+	}
+	if _, ok := states[stateKey(1)]; ok || len(states) != 2 {
+		t.Errorf("unexpected states left: %v", states)
+	}
+	if len(put.Actions) != 2 || put.Actions[0].Type != "email" || put.Actions[1].Type != "http" {
+		t.Errorf("expected stashed and current actions, got %+v", put.Actions)
+	}
+}
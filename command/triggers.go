@@ -1,8 +1,13 @@
 package command
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -17,6 +22,9 @@ const (
 
 	descAddActionTypeFmt = "Add new %s action to a trigger."
 
+	descShowSecrets = "Show passwords, tokens and auth headers of actions in cleartext."
+	descOutput      = "Output format: text, json or yaml."
+
 	keyTrigger = "trigger"
 )
 
@@ -51,9 +59,14 @@ func NewTriggersCommand(ctx *Context) *Command {
 			"add-action":    newAddActionTriggerCommand(ctx),
 			"create":        newCreateTriggerCommand(ctx),
 			"delete":        newDeleteTriggerCommand(ctx),
+			"disable":       newDisableTriggerCommand(ctx),
+			"enable":        newEnableTriggerCommand(ctx),
 			"get":           newGetTriggerCommand(ctx),
 			"list":          newListTriggersCommand(ctx),
+			"mute":          newMuteTriggerCommand(ctx),
 			"remove-action": newRemoveActionTriggerCommand(ctx),
+			"update":        newUpdateTriggerCommand(ctx),
+			"update-action": newUpdateActionTriggerCommand(ctx),
 		},
 	}
 	cmd.NewFlagSet(flagSetNames[keyTrigger])
@@ -75,6 +88,7 @@ type triggerData struct {
 	FireWhen       string  `json:"fire_when"`
 	ReleaseWhenPtr *string `json:"release_when,omitempty"`
 	releaseWhen    string
+	skipFieldCheck bool
 	dumpRequest    bool
 	dumpResponse   bool
 }
@@ -94,6 +108,106 @@ type triggerAction struct {
 type fullTrigger struct {
 	triggerData
 	Actions []triggerAction `json:"actions"`
+	// Status is only set when printing, for disabled or muted triggers.
+	Status *triggerStatus `json:"local_status,omitempty"`
+}
+
+// typedArgs returns the args of a as the actionArgs matching its type,
+// converting them if they were decoded from an API response.
+func (a *triggerAction) typedArgs() (actionArgs, error) {
+	if typed, ok := a.Args.(actionArgs); ok {
+		return typed, nil
+	}
+	if _, ok := actionTypes[a.Type]; !ok {
+		return nil, fmt.Errorf("Unknown action type: %s", a.Type)
+	}
+
+	raw, err := json.Marshal(a.Args)
+	if err != nil {
+		return nil, err
+	}
+	typed := getActionArgs(a.Type)
+	if err := json.Unmarshal(raw, typed); err != nil {
+		return nil, err
+	}
+	return typed, nil
+}
+
+// prepareOutput converts the args of all of t's actions to their typed
+// versions, masking secrets unless showSecrets is set.
+func (t *fullTrigger) prepareOutput(showSecrets bool) {
+	for i := range t.Actions {
+		a := &t.Actions[i]
+		typed, err := a.typedArgs()
+		if err != nil {
+			// We cannot tell which args of unknown actions are secret.
+			if !showSecrets {
+				a.Args = secretMask
+			}
+			continue
+		}
+		if !showSecrets {
+			typed.redact()
+		}
+		a.Args = typed
+	}
+}
+
+// actionIndex converts a 1-based action number, as shown by 'iobeam trigger
+// list', to an index into t's actions.
+func (t *fullTrigger) actionIndex(num uint64) (int, error) {
+	lenActions := uint64(len(t.Actions))
+	if num == 0 || num > lenActions {
+		return 0, fmt.Errorf("Invalid action index: %d (only %d actions)", num, lenActions)
+	}
+	return int(num - 1), nil
+}
+
+// applyFlags updates the args of a with the given values of its type's
+// flags. Args whose flags are not given keep their current value.
+func (a *triggerAction) applyFlags(values map[string][]string) (actionArgs, error) {
+	typed, err := a.typedArgs()
+	if err != nil {
+		return nil, err
+	}
+	current, err := json.Marshal(typed)
+	if err != nil {
+		return nil, err
+	}
+
+	// setFlags resets the args to flag defaults, so restore them afterwards.
+	flags := flag.NewFlagSet(a.Type, flag.ContinueOnError)
+	typed.setFlags(flags)
+	if err := json.Unmarshal(current, typed); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if flags.Lookup(name) == nil {
+			return nil, fmt.Errorf("Flag -%s does not apply to %s actions", name, a.Type)
+		}
+		for _, v := range values[name] {
+			if err := flags.Set(name, v); err != nil {
+				return nil, fmt.Errorf("Invalid value for -%s: %v", name, err)
+			}
+		}
+	}
+
+	if !typed.Valid() {
+		return nil, fmt.Errorf("Updated %s action is missing required fields", a.Type)
+	}
+	return typed, nil
+}
+
+// printActionField prints a labeled value of a trigger action, aligned with
+// the rest of the action's info.
+func printActionField(label string, value interface{}) {
+	fmt.Printf("     %-12s: %v\n", label, value)
 }
 
 func (t *fullTrigger) Print() {
@@ -102,10 +216,13 @@ func (t *fullTrigger) Print() {
 	fmt.Println("Project ID   :", t.ProjectId)
 	fmt.Println("Data expiry  :", t.DataExpiry)
 	fmt.Println("Namespace    :", t.Namespace)
-	fmt.Println("Fire when :", t.FireWhen)
+	fmt.Println("Fire when    :", t.FireWhen)
 	if t.ReleaseWhenPtr != nil {
 		fmt.Println("Release when :", *t.ReleaseWhenPtr)
 	}
+	if t.Status != nil {
+		fmt.Println("Status       :", t.Status)
+	}
 	fmt.Println("Actions:")
 	i := 1
 	for _, a := range t.Actions {
@@ -113,13 +230,30 @@ func (t *fullTrigger) Print() {
 			fmt.Println()
 		}
 		fmt.Printf("  %d) Action type: %s\n", i, a.Type)
-		fmt.Println("     Min delay  :", a.MinDelay)
-		fmt.Printf("     Args: %v\n", a.Args)
+		printActionField("Min delay", a.MinDelay)
+		if typed, ok := a.Args.(actionArgs); ok {
+			typed.Print()
+		} else {
+			printActionField("Args", a.Args)
+		}
 		i++
 	}
 	fmt.Println()
 }
 
+// prepareTriggers gets triggers ready for printing: it notes whether they
+// have been disabled or muted, and masks secrets unless showSecrets is set.
+func prepareTriggers(ctx *Context, triggers []fullTrigger, showSecrets bool) {
+	states, err := readTriggerStates(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read disabled/muted triggers: %v\n", err)
+	}
+	for i := range triggers {
+		triggers[i].Status = states.statusOf(&triggers[i])
+		triggers[i].prepareOutput(showSecrets)
+	}
+}
+
 func newTrigger(name string, projectId, dataExpiry uint64, fireWhen string, releaseWhen *string, namespace string, actions []triggerAction) *fullTrigger {
 	ret := &fullTrigger{
 		triggerData: triggerData{
@@ -139,11 +273,13 @@ func newTrigger(name string, projectId, dataExpiry uint64, fireWhen string, rele
 // List command data and functions
 
 type triggerListArgs struct {
-	projectId uint64
+	projectId   uint64
+	showSecrets bool
+	output      string
 }
 
 func (a *triggerListArgs) IsValid() bool {
-	return a.projectId > 0
+	return a.projectId > 0 && isInList(a.output, structuredOutputs)
 }
 
 func newListTriggersCommand(ctx *Context) *Command {
@@ -159,55 +295,104 @@ func newListTriggersCommand(ctx *Context) *Command {
 
 	flags := cmd.newFlagSetTrigger(cmdStr)
 	flags.Uint64Var(&a.projectId, "projectId", ctx.Profile.ActiveProject, "Project ID to get triggers from.")
+	flags.BoolVar(&a.showSecrets, "show-secrets", false, descShowSecrets)
+	flags.StringVar(&a.output, "output", outputText, descOutput)
 
 	return cmd
 }
 
 func getAllTriggers(c *Command, ctx *Context) error {
 	args := c.Data.(*triggerListArgs)
+	triggers, err := _getTriggers(ctx, args.projectId)
+	if err != nil {
+		return err
+	}
+
+	prepareTriggers(ctx, triggers, args.showSecrets)
+	if args.output != outputText {
+		return printStructured(triggers, args.output)
+	}
+	for _, t := range triggers {
+		t.Print()
+	}
+	return nil
+}
+
+func _getTriggers(ctx *Context, projectId uint64) ([]fullTrigger, error) {
 	type triggersResult struct {
 		Triggers []fullTrigger
 	}
 
-	_, err := ctx.Client.Get(c.ApiPath).Expect(200).
-		ProjectToken(ctx.Profile, args.projectId).
-		ResponseBody(new(triggersResult)).
+	res := new(triggersResult)
+	_, err := ctx.Client.Get(baseApiPath[keyTrigger]).Expect(200).
+		ProjectToken(ctx.Profile, projectId).
+		ResponseBody(res).
 		ResponseBodyHandler(func(resp interface{}) error {
-			results := resp.(*triggersResult)
-			for _, t := range results.Triggers {
-				t.Print()
-			}
 			return nil
 		}).Execute()
 
-	return err
+	return res.Triggers, err
 }
 
 type triggerBaseArgs struct {
 	projectId   uint64
 	triggerId   uint64
 	triggerName string
+	// selectedByName is set by resolve when the trigger was selected by
+	// name, since resolving fills in triggerId.
+	selectedByName bool
 }
 
 func (a *triggerBaseArgs) IsValid() bool {
 	return a.projectId > 0 && (a.triggerId > 0 || len(a.triggerName) > 0)
 }
 
-func (a *triggerBaseArgs) getApiPath() string {
+// byName reports whether the trigger was selected by name rather than ID.
+func (a *triggerBaseArgs) byName() bool {
+	return a.selectedByName
+}
+
+// resolve looks up the ID of the trigger when it was selected by name.
+func (a *triggerBaseArgs) resolve(ctx *Context) error {
 	if a.triggerId > 0 {
-		return getUrlForTriggerId(a.triggerId)
+		return nil
+	}
+	a.selectedByName = true
+
+	id, err := resolveName(ctx, keyTrigger, a.projectId, a.triggerName, func() ([]resourceRef, error) {
+		triggers, err := _getTriggers(ctx, a.projectId)
+		refs := make([]resourceRef, len(triggers))
+		for i, t := range triggers {
+			refs[i] = resourceRef{id: strconv.FormatUint(t.TriggerId, 10), name: t.TriggerName}
+		}
+		return refs, err
+	})
+	if err != nil {
+		return err
 	}
-	return baseApiPath[keyTrigger]
+	a.triggerId, err = strconv.ParseUint(id, 10, 64)
+	return err
+}
+
+// confirmDestructive asks for confirmation before changing a trigger that
+// was selected by name.
+func (a *triggerBaseArgs) confirmDestructive(verb string, force bool) error {
+	if !a.byName() {
+		return nil
+	}
+	return confirmByName(verb, keyTrigger, a.triggerName, strconv.FormatUint(a.triggerId, 10), force)
 }
 
 // Single get data and functions
 
 type triggerGetArgs struct {
 	triggerBaseArgs
+	showSecrets bool
+	output      string
 }
 
 func (a *triggerGetArgs) IsValid() bool {
-	return a.triggerBaseArgs.IsValid()
+	return a.triggerBaseArgs.IsValid() && isInList(a.output, structuredOutputs)
 }
 
 func newGetTriggerCommand(ctx *Context) *Command {
@@ -225,6 +410,8 @@ func newGetTriggerCommand(ctx *Context) *Command {
 	flags.Uint64Var(&a.projectId, "projectId", ctx.Profile.ActiveProject, "Project ID to get trigger from.")
 	flags.Uint64Var(&a.triggerId, "id", 0, "Trigger ID to get (either this or -name must be set).")
 	flags.StringVar(&a.triggerName, "name", "", "Trigger name to get (either this or -id must be set).")
+	flags.BoolVar(&a.showSecrets, "show-secrets", false, descShowSecrets)
+	flags.StringVar(&a.output, "output", outputText, descOutput)
 
 	return cmd
 }
@@ -232,20 +419,26 @@ func newGetTriggerCommand(ctx *Context) *Command {
 func getTrigger(c *Command, ctx *Context) error {
 	args := c.Data.(*triggerGetArgs)
 	t, err := _getTrigger(ctx, &args.triggerBaseArgs)
-	if err == nil {
-		t.Print()
+	if err != nil {
+		return err
 	}
-	return err
+
+	list := []fullTrigger{*t}
+	prepareTriggers(ctx, list, args.showSecrets)
+	if args.output != outputText {
+		return printStructured(list[0], args.output)
+	}
+	list[0].Print()
+	return nil
 }
 
 func _getTrigger(ctx *Context, args *triggerBaseArgs) (*fullTrigger, error) {
-	req := ctx.Client.Get(args.getApiPath())
-	if args.triggerId <= 0 {
-		req.Param("name", args.triggerName)
+	if err := args.resolve(ctx); err != nil {
+		return nil, err
 	}
 
 	res := new(fullTrigger)
-	_, err := req.Expect(200).
+	_, err := ctx.Client.Get(getUrlForTriggerId(args.triggerId)).Expect(200).
 		ProjectToken(ctx.Profile, args.projectId).
 		ResponseBody(res).
 		ResponseBodyHandler(func(resp interface{}) error {
@@ -259,6 +452,7 @@ func _getTrigger(ctx *Context, args *triggerBaseArgs) (*fullTrigger, error) {
 
 type triggerDeleteArgs struct {
 	triggerBaseArgs
+	force bool
 }
 
 func (a *triggerDeleteArgs) IsValid() bool {
@@ -271,33 +465,40 @@ func newDeleteTriggerCommand(ctx *Context) *Command {
 	cmd := &Command{
 		Name: cmdStr,
 		// ApiPath determined by flags
-		Usage:  "Delete trigger by id",
+		Usage:  "Delete trigger by name or id",
 		Data:   a,
 		Action: deleteTrigger,
 	}
 
 	flags := cmd.newFlagSetTrigger(cmdStr)
 	flags.Uint64Var(&a.projectId, "projectId", ctx.Profile.ActiveProject, "Project ID to delete trigger from.")
-	flags.Uint64Var(&a.triggerId, "id", 0, "Trigger ID to delete.")
-	// TODO: Support delete by name eventually
-	//flags.StringVar(&a.triggerName, "name", "", "Trigger name to get (either this or -id must be set).")
+	flags.Uint64Var(&a.triggerId, "id", 0, "Trigger ID to delete (either this or -name must be set).")
+	flags.StringVar(&a.triggerName, "name", "", "Trigger name to delete (either this or -id must be set).")
+	flags.BoolVar(&a.force, "force", false, descForce)
 
 	return cmd
 }
 
 func deleteTrigger(c *Command, ctx *Context) error {
 	args := c.Data.(*triggerDeleteArgs)
-	req := ctx.Client.Delete(args.getApiPath())
-	if args.triggerId <= 0 {
-		req.Param("name", args.triggerName)
+	if err := args.resolve(ctx); err != nil {
+		return err
+	}
+	if err := args.confirmDestructive("delete", args.force); err != nil {
+		return err
 	}
 
-	_, err := req.Expect(204).
+	_, err := ctx.Client.Delete(getUrlForTriggerId(args.triggerId)).
+		Expect(204).
 		ProjectToken(ctx.Profile, args.projectId).
 		Execute()
 
 	if err == nil {
-		fmt.Println("Device successfully deleted")
+		ctx.forgetNames(keyTrigger)
+		if err := forgetTriggerState(ctx, args.triggerId); err != nil {
+			fmt.Fprintf(os.Stderr, "Could not update trigger state: %v\n", err)
+		}
+		fmt.Println("Trigger successfully deleted")
 	}
 
 	return err
@@ -311,6 +512,7 @@ type event struct {
 type triggerRemoveActionArgs struct {
 	triggerBaseArgs
 	index uint64
+	force bool
 }
 
 func (a *triggerRemoveActionArgs) IsValid() bool {
@@ -331,8 +533,9 @@ func newRemoveActionTriggerCommand(ctx *Context) *Command {
 	flags := cmd.newFlagSetTrigger(cmdStr)
 	flags.Uint64Var(&a.projectId, "projectId", ctx.Profile.ActiveProject, "Project ID of trigger.")
 	flags.Uint64Var(&a.triggerId, "triggerId", 0, "Trigger ID containing the action (either this or -name must be set).")
-	flags.StringVar(&a.triggerName, "triggerName", "", "Trigger name containing the action (either this or -id must be set).")
+	flags.StringVar(&a.triggerName, "triggerName", "", "Trigger name containing the action (either this or -triggerId must be set).")
 	flags.Uint64Var(&a.index, "num", 0, "Action number to remove (see output of 'iobeam trigger list').")
+	flags.BoolVar(&a.force, "force", false, descForce)
 
 	return cmd
 }
@@ -342,8 +545,13 @@ func _putTrigger(ctx *Context, trigger *fullTrigger) error {
 		Put(getUrlForTriggerId(trigger.TriggerId)).
 		Expect(200).
 		ProjectToken(ctx.Profile, trigger.ProjectId).
+		DumpRequest(trigger.dumpRequest).
+		DumpResponse(trigger.dumpResponse).
 		Body(trigger).
 		Execute()
+	if err == nil {
+		ctx.forgetNames(keyTrigger)
+	}
 
 	return err
 }
@@ -355,10 +563,12 @@ func delAction(c *Command, ctx *Context) error {
 		return err
 	}
 
-	idx := args.index - 1 // make index 0-based
-	lenActions := uint64(len(trigger.Actions))
-	if idx > lenActions {
-		return fmt.Errorf("Invalid action index: %d (only %d actions)", args.index, lenActions)
+	idx, err := trigger.actionIndex(args.index)
+	if err != nil {
+		return err
+	}
+	if err := args.confirmDestructive(fmt.Sprintf("remove action %d from", args.index), args.force); err != nil {
+		return err
 	}
 
 	trigger.Actions = append(trigger.Actions[:idx], trigger.Actions[idx+1:]...)
@@ -371,6 +581,223 @@ func delAction(c *Command, ctx *Context) error {
 	return err
 }
 
+// Update data and functions
+
+type triggerUpdateArgs struct {
+	triggerBaseArgs
+	newName      string
+	namespace    string
+	fireWhen     string
+	releaseWhen  string
+	noRelease    bool
+	dataExpiry   int64 // negative means unchanged
+	skipCheck    bool
+	dumpRequest  bool
+	dumpResponse bool
+}
+
+func (a *triggerUpdateArgs) IsValid() bool {
+	hasChange := len(a.newName) > 0 || len(a.namespace) > 0 ||
+		len(a.fireWhen) > 0 || len(a.releaseWhen) > 0 || a.noRelease ||
+		a.dataExpiry >= 0
+	releaseOk := !(a.noRelease && len(a.releaseWhen) > 0)
+	return a.triggerBaseArgs.IsValid() && hasChange && releaseOk
+}
+
+func newUpdateTriggerCommand(ctx *Context) *Command {
+	cmdStr := "update"
+	a := new(triggerUpdateArgs)
+	cmd := &Command{
+		Name: cmdStr,
+		// ApiPath determined by flags
+		Usage:  "Update the conditions, expiry or namespace of a trigger. Only provided fields are changed.",
+		Data:   a,
+		Action: updateTrigger,
+	}
+
+	flags := cmd.newFlagSetTrigger(cmdStr)
+	flags.Uint64Var(&a.projectId, "projectId", ctx.Profile.ActiveProject, "Project ID of trigger.")
+	flags.Uint64Var(&a.triggerId, "id", 0, "Trigger ID to update (either this or -name must be set).")
+	flags.StringVar(&a.triggerName, "name", "", "Trigger name to update (either this or -id must be set).")
+	flags.StringVar(&a.newName, "newName", "", "New name for the trigger.")
+	flags.StringVar(&a.namespace, "namespace", "", "Namespace the trigger reads from.")
+	flags.StringVar(&a.fireWhen, "fireWhen", "", descCreateFireWhen)
+	flags.StringVar(&a.releaseWhen, "releaseWhen", "", descCreateReleaseWhen)
+	flags.BoolVar(&a.noRelease, "noRelease", false, "Remove the release condition from the trigger.")
+	flags.Int64Var(&a.dataExpiry, "dataExpiry", -1, descCreateDataExpiry)
+	flags.BoolVar(&a.skipCheck, "skipFieldCheck", false, descSkipFieldCheck)
+	flags.BoolVar(&a.dumpRequest, "dumpRequest", false, "Dump the request to std out.")
+	flags.BoolVar(&a.dumpResponse, "dumpResponse", false, "Dump the response to std out.")
+
+	return cmd
+}
+
+func updateTrigger(c *Command, ctx *Context) error {
+	args := c.Data.(*triggerUpdateArgs)
+	trigger, err := _getTrigger(ctx, &args.triggerBaseArgs)
+	if err != nil {
+		return err
+	}
+
+	if len(args.newName) > 0 {
+		trigger.TriggerName = args.newName
+	}
+	if len(args.namespace) > 0 {
+		trigger.Namespace = args.namespace
+	}
+	if len(args.fireWhen) > 0 {
+		trigger.FireWhen = args.fireWhen
+	}
+	if len(args.releaseWhen) > 0 {
+		trigger.ReleaseWhenPtr = &args.releaseWhen
+	} else if args.noRelease {
+		trigger.ReleaseWhenPtr = nil
+	}
+	if args.dataExpiry >= 0 {
+		trigger.DataExpiry = uint64(args.dataExpiry)
+	}
+
+	if !args.skipCheck {
+		if err := validateTriggerFields(ctx, trigger); err != nil {
+			return err
+		}
+	}
+
+	trigger.dumpRequest = args.dumpRequest
+	trigger.dumpResponse = args.dumpResponse
+	err = _putTrigger(ctx, trigger)
+
+	if err == nil {
+		fmt.Printf("Trigger %d successfully updated.\n", trigger.TriggerId)
+	}
+
+	return err
+}
+
+// Update action data and functions
+
+// actionFieldFlags records the values of action flags given to update-action,
+// keyed by flag name. They are applied once the type of the action is known.
+type actionFieldFlags map[string][]string
+
+// actionFieldFlag is a flag.Value that records its values in an
+// actionFieldFlags.
+type actionFieldFlag struct {
+	name   string
+	values actionFieldFlags
+}
+
+func (f *actionFieldFlag) String() string {
+	return ""
+}
+
+func (f *actionFieldFlag) Set(value string) error {
+	f.values[f.name] = append(f.values[f.name], value)
+	return nil
+}
+
+type triggerUpdateActionArgs struct {
+	triggerBaseArgs
+	index     uint64
+	minDelay  int64 // negative means unchanged
+	fields    actionFieldFlags
+	skipCheck bool
+}
+
+func (a *triggerUpdateActionArgs) IsValid() bool {
+	hasChange := len(a.fields) > 0 || a.minDelay >= 0
+	return a.triggerBaseArgs.IsValid() && a.index > 0 && hasChange
+}
+
+// setActionFieldFlags adds the flags of every action type to flags. Each flag
+// notes which action types it applies to.
+func (a *triggerUpdateActionArgs) setActionFieldFlags(flags *flag.FlagSet) {
+	types := make([]string, 0, len(actionTypes))
+	for t := range actionTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	usages := make(map[string][]string)
+	var names []string
+	for _, t := range types {
+		typeFlags := flag.NewFlagSet(t, flag.ContinueOnError)
+		getActionArgs(t).setFlags(typeFlags)
+		typeFlags.VisitAll(func(f *flag.Flag) {
+			if _, ok := usages[f.Name]; !ok {
+				names = append(names, f.Name)
+			}
+			usages[f.Name] = append(usages[f.Name], fmt.Sprintf("[%s] %s", t, f.Usage))
+		})
+	}
+
+	for _, name := range names {
+		usage := strings.Join(usages[name], "\n")
+		flags.Var(&actionFieldFlag{name: name, values: a.fields}, name, usage)
+	}
+}
+
+func newUpdateActionTriggerCommand(ctx *Context) *Command {
+	cmdStr := "update-action"
+	a := &triggerUpdateActionArgs{fields: make(actionFieldFlags)}
+	cmd := &Command{
+		Name: cmdStr,
+		// ApiPath determined by flags
+		Usage:  "Update fields of a trigger action. Only provided fields are changed.",
+		Data:   a,
+		Action: updateAction,
+	}
+
+	flags := cmd.newFlagSetTrigger(cmdStr)
+	flags.Uint64Var(&a.projectId, "projectId", ctx.Profile.ActiveProject, "Project ID of trigger.")
+	flags.Uint64Var(&a.triggerId, "triggerId", 0, "Trigger ID containing the action (either this or -triggerName must be set).")
+	flags.StringVar(&a.triggerName, "triggerName", "", "Trigger name containing the action (either this or -triggerId must be set).")
+	flags.Uint64Var(&a.index, "num", 0, "Action number to update (see output of 'iobeam trigger list').")
+	flags.Int64Var(&a.minDelay, "minDelay", -1, descCreateMinDelay)
+	flags.BoolVar(&a.skipCheck, "skipFieldCheck", false, descSkipFieldCheck)
+	a.setActionFieldFlags(flags)
+
+	return cmd
+}
+
+func updateAction(c *Command, ctx *Context) error {
+	args := c.Data.(*triggerUpdateActionArgs)
+	trigger, err := _getTrigger(ctx, &args.triggerBaseArgs)
+	if err != nil {
+		return err
+	}
+
+	idx, err := trigger.actionIndex(args.index)
+	if err != nil {
+		return err
+	}
+
+	action := &trigger.Actions[idx]
+	if len(args.fields) > 0 {
+		typed, err := action.applyFlags(args.fields)
+		if err != nil {
+			return err
+		}
+		action.Args = typed
+	}
+	if args.minDelay >= 0 {
+		action.MinDelay = uint64(args.minDelay)
+	}
+
+	if !args.skipCheck {
+		if err := validateTriggerFields(ctx, trigger); err != nil {
+			return err
+		}
+	}
+
+	err = _putTrigger(ctx, trigger)
+	if err == nil {
+		fmt.Printf("Action %d of trigger successfully updated.\n", args.index)
+	}
+
+	return err
+}
+
 // actionFunc is a function that generates a command that is based on the type
 // of trigger action given.
 type actionFunc func(*Context, string) *Command
@@ -402,6 +829,12 @@ func newAddActionTriggerCommand(ctx *Context) *Command {
 type actionArgs interface {
 	Valid() bool
 	setFlags(flags *flag.FlagSet)
+	// redact masks any secrets (passwords, tokens, etc) in the args.
+	redact()
+	// Print prints the args as part of a trigger listing.
+	Print()
+	// templates returns the args that may reference fields, e.g. payloads.
+	templates() []string
 }
 
 type createArgs struct {
@@ -419,10 +852,11 @@ func (a *createArgs) setCommonFlags(flags *flag.FlagSet, ctx *Context) {
 	flags.StringVar(&a.triggerData.TriggerName, "name", "", descCreateTriggerName)
 	flags.Uint64Var(&a.triggerData.DataExpiry, "dataExpiry", 0, descCreateDataExpiry)
 	flags.StringVar(&a.triggerData.FireWhen, "fireWhen", "", descCreateFireWhen)
-	//flags.StringVar(&a.triggerData.releaseWhen, "releaseWhen", "", descCreateReleaseWhen)
+	flags.StringVar(&a.triggerData.releaseWhen, "releaseWhen", "", descCreateReleaseWhen)
 	flags.BoolVar(&a.triggerData.dumpRequest, "dumpRequest", false, "Dump the request to std out.")
 	flags.BoolVar(&a.triggerData.dumpResponse, "dumpResponse", false, "Dump the response to std out.")
 	flags.StringVar(&a.triggerData.Namespace, "namespace", "input", "Namespace to read to (Defaults to 'input')")
+	flags.BoolVar(&a.triggerData.skipFieldCheck, "skipFieldCheck", false, descSkipFieldCheck)
 
 	flags.Uint64Var(&a.minDelay, "minDelay", 0, descCreateMinDelay)
 
@@ -463,6 +897,12 @@ func createTrigger(c *Command, ctx *Context) error {
 	}
 
 	body := newTrigger(args.triggerData.TriggerName, args.triggerData.ProjectId, args.triggerData.DataExpiry, args.triggerData.FireWhen, releasePtr, args.Namespace, actions)
+	if !args.triggerData.skipFieldCheck {
+		if err := validateTriggerFields(ctx, body); err != nil {
+			return err
+		}
+	}
+
 	_, err := ctx.Client.Post(c.ApiPath).Expect(201).
 		ProjectToken(ctx.Profile, body.ProjectId).
 		DumpRequest(args.triggerData.dumpRequest).
@@ -482,8 +922,9 @@ func createTrigger(c *Command, ctx *Context) error {
 
 type addActionArgs struct {
 	triggerBaseArgs
-	minDelay uint64
-	data     actionArgs
+	minDelay  uint64
+	data      actionArgs
+	skipCheck bool
 }
 
 func (a *addActionArgs) IsValid() bool {
@@ -492,9 +933,11 @@ func (a *addActionArgs) IsValid() bool {
 
 func (a *addActionArgs) setCommonFlags(flags *flag.FlagSet, ctx *Context) {
 	flags.Uint64Var(&a.triggerBaseArgs.projectId, "projectId", ctx.Profile.ActiveProject, descCreateProjectId)
-	flags.StringVar(&a.triggerBaseArgs.triggerName, "triggerName", "", "Name of trigger to add action to")
+	flags.Uint64Var(&a.triggerBaseArgs.triggerId, "triggerId", 0, "ID of trigger to add action to (either this or -triggerName must be set)")
+	flags.StringVar(&a.triggerBaseArgs.triggerName, "triggerName", "", "Name of trigger to add action to (either this or -triggerId must be set)")
 
 	flags.Uint64Var(&a.minDelay, "minDelay", 0, descCreateMinDelay)
+	flags.BoolVar(&a.skipCheck, "skipFieldCheck", false, descSkipFieldCheck)
 }
 
 func newAddActionTypeCommand(ctx *Context, action string) *Command {
@@ -527,6 +970,11 @@ func addAction(c *Command, ctx *Context) error {
 
 	newAction := triggerAction{Type: getActionType(args.data), MinDelay: args.minDelay, Args: args.data}
 	trigger.Actions = append(trigger.Actions, newAction)
+	if !args.skipCheck {
+		if err := validateTriggerFields(ctx, trigger); err != nil {
+			return err
+		}
+	}
 	err = _putTrigger(ctx, trigger)
 
 	if err == nil {
@@ -541,7 +989,7 @@ func addAction(c *Command, ctx *Context) error {
 func getActionArgs(action string) actionArgs {
 	switch action {
 	case "email":
-		return &emailActionData{To: make([]string, 1)}
+		return &emailActionData{}
 	case "http":
 		return &httpActionData{}
 	case "mqtt":
@@ -590,6 +1038,21 @@ func (d *httpActionData) setFlags(flags *flag.FlagSet) {
 	flags.StringVar(&d.ContentType, "contentType", "text/plain", "Content type of payload.")
 }
 
+func (d *httpActionData) redact() {
+	d.AuthHeader = maskSecret(d.AuthHeader)
+}
+
+func (d *httpActionData) templates() []string {
+	return []string{d.URL, d.Payload}
+}
+
+func (d *httpActionData) Print() {
+	printActionField("URL", d.URL)
+	printActionField("Content type", d.ContentType)
+	printActionField("Auth header", d.AuthHeader)
+	printActionField("Payload", d.Payload)
+}
+
 //
 // MQTT data structures and functions
 //
@@ -615,6 +1078,23 @@ func (d *mqttActionData) setFlags(flags *flag.FlagSet) {
 	flags.StringVar(&d.Payload, "payload", "", "Body of the MQTT request.")
 }
 
+func (d *mqttActionData) redact() {
+	d.Password = maskSecret(d.Password)
+}
+
+func (d *mqttActionData) templates() []string {
+	return []string{d.Topic, d.Payload}
+}
+
+func (d *mqttActionData) Print() {
+	printActionField("Broker", d.Broker)
+	printActionField("Username", d.Username)
+	printActionField("Password", d.Password)
+	printActionField("QoS", d.QoS)
+	printActionField("Topic", d.Topic)
+	printActionField("Payload", d.Payload)
+}
+
 //
 // SMS data structures and functions
 //
@@ -639,6 +1119,22 @@ func (d *smsActionData) setFlags(flags *flag.FlagSet) {
 	flags.StringVar(&d.Payload, "payload", "", "SMS message body.")
 }
 
+func (d *smsActionData) redact() {
+	d.AuthToken = maskSecret(d.AuthToken)
+}
+
+func (d *smsActionData) templates() []string {
+	return []string{d.Payload}
+}
+
+func (d *smsActionData) Print() {
+	printActionField("Account SID", d.AccountSID)
+	printActionField("Auth token", d.AuthToken)
+	printActionField("From", d.From)
+	printActionField("To", d.To)
+	printActionField("Payload", d.Payload)
+}
+
 //
 // Email data structures and functions
 //
@@ -654,7 +1150,20 @@ func (d *emailActionData) Valid() bool {
 }
 
 func (d *emailActionData) setFlags(flags *flag.FlagSet) {
-	flags.StringVar(&d.To[0], "to", "", "Email address recipient.")
+	flags.Var(newListFlags(&d.To), "to", "Email address recipient (can occur multiple times for multiple recipients).")
 	flags.StringVar(&d.Subject, "subject", "", "Email subject line.")
 	flags.StringVar(&d.Payload, "payload", "", "Email message body.")
 }
+
+// Email actions contain no secrets.
+func (d *emailActionData) redact() {}
+
+func (d *emailActionData) templates() []string {
+	return []string{d.Subject, d.Payload}
+}
+
+func (d *emailActionData) Print() {
+	printActionField("To", strings.Join(d.To, ", "))
+	printActionField("Subject", d.Subject)
+	printActionField("Payload", d.Payload)
+}
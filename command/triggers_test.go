@@ -1,6 +1,10 @@
 package command
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
 	"strings"
 	"testing"
 )
@@ -69,7 +73,10 @@ func TestTriggerGetArgsValidity(t *testing.T) {
 	cases := make([]dataTestCase, len(casesBaseArgs))
 	for i, c := range casesBaseArgs {
 		cases[i].desc = strings.Replace(c.desc, "triggerBaseArgs", "triggerGetArgs", -1)
-		cases[i].in = &triggerGetArgs{*c.in.(*triggerBaseArgs)}
+		cases[i].in = &triggerGetArgs{
+			triggerBaseArgs: *c.in.(*triggerBaseArgs),
+			output:          outputText,
+		}
 		cases[i].want = c.want
 	}
 	runDataTestCase(t, cases)
@@ -79,7 +86,7 @@ func TestTriggerDeleteArgsValidity(t *testing.T) {
 	cases := make([]dataTestCase, len(casesBaseArgs))
 	for i, c := range casesBaseArgs {
 		cases[i].desc = strings.Replace(c.desc, "triggerBaseArgs", "triggerDeleteArgs", -1)
-		cases[i].in = &triggerDeleteArgs{*c.in.(*triggerBaseArgs)}
+		cases[i].in = &triggerDeleteArgs{triggerBaseArgs: *c.in.(*triggerBaseArgs)}
 		cases[i].want = c.want
 	}
 	runDataTestCase(t, cases)
@@ -311,3 +318,294 @@ func TestSMSDataValidity(t *testing.T) {
 		}
 	}
 }
+
+func TestTriggerUpdateArgsValidity(t *testing.T) {
+	base := triggerBaseArgs{projectId: 1, triggerId: 1}
+	cases := []dataTestCase{
+		{
+			desc: "a valid triggerUpdateArgs object w/ release condition",
+			in: &triggerUpdateArgs{
+				triggerBaseArgs: base,
+				releaseWhen:     "{{ temp }} < 22.0",
+				dataExpiry:      -1,
+			},
+			want: true,
+		},
+		{
+			desc: "a valid triggerUpdateArgs object w/ data expiry of 0",
+			in: &triggerUpdateArgs{
+				triggerBaseArgs: base,
+				dataExpiry:      0,
+			},
+			want: true,
+		},
+		{
+			desc: "a valid triggerUpdateArgs object removing release condition",
+			in: &triggerUpdateArgs{
+				triggerBaseArgs: base,
+				noRelease:       true,
+				dataExpiry:      -1,
+			},
+			want: true,
+		},
+		{
+			desc: "invalid, nothing to update",
+			in: &triggerUpdateArgs{
+				triggerBaseArgs: base,
+				dataExpiry:      -1,
+			},
+			want: false,
+		},
+		{
+			desc: "invalid, both setting and removing release condition",
+			in: &triggerUpdateArgs{
+				triggerBaseArgs: base,
+				releaseWhen:     "{{ temp }} < 22.0",
+				noRelease:       true,
+				dataExpiry:      -1,
+			},
+			want: false,
+		},
+		{
+			desc: testDescInvalidNoNameOrId,
+			in: &triggerUpdateArgs{
+				triggerBaseArgs: triggerBaseArgs{projectId: 1},
+				fireWhen:        "{{ temp }} > 25.0",
+				dataExpiry:      -1,
+			},
+			want: false,
+		},
+	}
+	runDataTestCase(t, cases)
+}
+
+func TestTriggerGetArgsOutputValidity(t *testing.T) {
+	base := triggerBaseArgs{projectId: 1, triggerId: 1}
+	cases := []dataTestCase{
+		{
+			desc: "a valid triggerGetArgs object w/ yaml output",
+			in:   &triggerGetArgs{triggerBaseArgs: base, output: outputYaml},
+			want: true,
+		},
+		{
+			desc: "invalid, unknown output format",
+			in:   &triggerGetArgs{triggerBaseArgs: base, output: "xml"},
+			want: false,
+		},
+	}
+	runDataTestCase(t, cases)
+}
+
+func TestPrepareOutputRedactsSecrets(t *testing.T) {
+	// Args as they are decoded from an API response
+	decoded := func() *fullTrigger {
+		return &fullTrigger{
+			Actions: []triggerAction{
+				{Type: "http", Args: map[string]interface{}{"url": "iobeam.com", "auth_header": "Bearer abc"}},
+				{Type: "mqtt", Args: map[string]interface{}{"broker_addr": "iobeam.com", "password": "hunter2"}},
+				{Type: "sms", Args: map[string]interface{}{"account_sid": "sid", "auth_token": "tok"}},
+				{Type: "email", Args: map[string]interface{}{"to": []interface{}{"a@iobeam.com"}}},
+				{Type: "pager", Args: map[string]interface{}{"key": "secret"}},
+			},
+		}
+	}
+
+	trigger := decoded()
+	trigger.prepareOutput(false)
+	if got := trigger.Actions[0].Args.(*httpActionData); got.AuthHeader != secretMask || got.URL != "iobeam.com" {
+		t.Errorf("http args not redacted correctly: %+v", got)
+	}
+	if got := trigger.Actions[1].Args.(*mqttActionData); got.Password != secretMask || got.Broker != "iobeam.com" {
+		t.Errorf("mqtt args not redacted correctly: %+v", got)
+	}
+	if got := trigger.Actions[2].Args.(*smsActionData); got.AuthToken != secretMask || got.AccountSID != "sid" {
+		t.Errorf("sms args not redacted correctly: %+v", got)
+	}
+	if got := trigger.Actions[3].Args.(*emailActionData); len(got.To) != 1 || got.To[0] != "a@iobeam.com" {
+		t.Errorf("email args not converted correctly: %+v", got)
+	}
+	if got := trigger.Actions[4].Args; got != secretMask {
+		t.Errorf("args of unknown action type not hidden: %v", got)
+	}
+
+	trigger = decoded()
+	trigger.prepareOutput(true)
+	if got := trigger.Actions[1].Args.(*mqttActionData); got.Password != "hunter2" {
+		t.Errorf("mqtt password hidden despite showSecrets: %+v", got)
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	if got := maskSecret(""); got != "" {
+		t.Errorf("maskSecret(\"\") == %q, want \"\"", got)
+	}
+	if got := maskSecret("secret"); got != secretMask {
+		t.Errorf("maskSecret(\"secret\") == %q, want %q", got, secretMask)
+	}
+}
+
+func TestToStructuredYaml(t *testing.T) {
+	trigger := &fullTrigger{triggerData: triggerData{TriggerId: 1, TriggerName: "hot"}}
+	out, err := toStructured(trigger, outputYaml)
+	if err != nil {
+		t.Fatalf("toStructured failed: %v", err)
+	}
+	if !strings.Contains(string(out), "trigger_name: hot\n") {
+		t.Errorf("unexpected YAML output:\n%s", out)
+	}
+}
+
+func TestTriggerUpdateActionArgsValidity(t *testing.T) {
+	base := triggerBaseArgs{projectId: 1, triggerId: 1}
+	cases := []dataTestCase{
+		{
+			desc: "a valid triggerUpdateActionArgs object w/ fields",
+			in: &triggerUpdateActionArgs{
+				triggerBaseArgs: base,
+				index:           1,
+				minDelay:        -1,
+				fields:          actionFieldFlags{"to": {"a@iobeam.com"}},
+			},
+			want: true,
+		},
+		{
+			desc: "a valid triggerUpdateActionArgs object w/ only min delay",
+			in: &triggerUpdateActionArgs{
+				triggerBaseArgs: base,
+				index:           1,
+				minDelay:        0,
+				fields:          actionFieldFlags{},
+			},
+			want: true,
+		},
+		{
+			desc: "invalid, action number must be > 0",
+			in: &triggerUpdateActionArgs{
+				triggerBaseArgs: base,
+				minDelay:        0,
+				fields:          actionFieldFlags{},
+			},
+			want: false,
+		},
+		{
+			desc: "invalid, nothing to update",
+			in: &triggerUpdateActionArgs{
+				triggerBaseArgs: base,
+				index:           1,
+				minDelay:        -1,
+				fields:          actionFieldFlags{},
+			},
+			want: false,
+		},
+	}
+	runDataTestCase(t, cases)
+}
+
+func TestActionApplyFlags(t *testing.T) {
+	action := &triggerAction{
+		Type: "email",
+		Args: map[string]interface{}{
+			"to":      []interface{}{"old@iobeam.com"},
+			"subject": "Too hot",
+			"payload": "It is {{ temp }} degrees",
+		},
+	}
+
+	typed, err := action.applyFlags(actionFieldFlags{"to": {"a@iobeam.com", "b@iobeam.com"}})
+	if err != nil {
+		t.Fatalf("applyFlags failed: %v", err)
+	}
+	email := typed.(*emailActionData)
+	if len(email.To) != 2 || email.To[0] != "a@iobeam.com" || email.To[1] != "b@iobeam.com" {
+		t.Errorf("recipients not replaced: %v", email.To)
+	}
+	if email.Subject != "Too hot" || email.Payload != "It is {{ temp }} degrees" {
+		t.Errorf("fields not given as flags were changed: %+v", email)
+	}
+
+	action = &triggerAction{
+		Type: "http",
+		Args: map[string]interface{}{"url": "iobeam.com", "content_type": "application/json"},
+	}
+	typed, err = action.applyFlags(actionFieldFlags{"payload": {"{}"}})
+	if err != nil {
+		t.Fatalf("applyFlags failed: %v", err)
+	}
+	if http := typed.(*httpActionData); http.ContentType != "application/json" || http.Payload != "{}" {
+		t.Errorf("http args not updated correctly: %+v", http)
+	}
+
+	if _, err = action.applyFlags(actionFieldFlags{"topic": {"alerts"}}); err == nil {
+		t.Errorf("applyFlags accepted a flag of another action type")
+	}
+	if _, err = action.applyFlags(actionFieldFlags{"url": {""}}); err == nil {
+		t.Errorf("applyFlags accepted an invalid action")
+	}
+}
+
+func TestActionIndex(t *testing.T) {
+	trigger := &fullTrigger{Actions: make([]triggerAction, 2)}
+	if idx, err := trigger.actionIndex(2); err != nil || idx != 1 {
+		t.Errorf("actionIndex(2) == %d, %v; want 1, nil", idx, err)
+	}
+	for _, num := range []uint64{0, 3} {
+		if _, err := trigger.actionIndex(num); err == nil {
+			t.Errorf("actionIndex(%d) should have failed", num)
+		}
+	}
+}
+
+// answerStdin makes the next confirmation prompts read answer, until the
+// returned function is called.
+func answerStdin(t *testing.T, answer string) func() {
+	f, err := ioutil.TempFile("", "iobeam-stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(answer)
+	f.Seek(0, 0)
+	saved := os.Stdin
+	os.Stdin = f
+	return func() {
+		os.Stdin = saved
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
+
+func TestDeclinedConfirmationKeepsTrigger(t *testing.T) {
+	const trigger = `{"trigger_id": 7, "project_id": 1, "trigger_name": "t", ` +
+		`"actions": [{"type": "http", "args": {"uri": "http://example.com"}}]}`
+	var changes []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/triggers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"triggers": [%s]}`, trigger)
+	})
+	mux.HandleFunc("/v1/triggers/7", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			changes = append(changes, r.Method)
+			w.WriteHeader(204)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, trigger)
+	})
+	ctx := newTestContext(t, mux)
+
+	defer answerStdin(t, "n\n")()
+	del := &Command{Data: &triggerDeleteArgs{triggerBaseArgs: triggerBaseArgs{projectId: 1, triggerName: "t"}}}
+	if err := deleteTrigger(del, ctx); err == nil || !strings.Contains(err.Error(), "Aborted") {
+		t.Errorf("expected delete to be aborted, got %v", err)
+	}
+
+	defer answerStdin(t, "n\n")()
+	rm := &Command{Data: &triggerRemoveActionArgs{triggerBaseArgs: triggerBaseArgs{projectId: 1, triggerName: "t"}, index: 1}}
+	if err := delAction(rm, ctx); err == nil || !strings.Contains(err.Error(), "Aborted") {
+		t.Errorf("expected remove-action to be aborted, got %v", err)
+	}
+
+	if len(changes) != 0 {
+		t.Errorf("trigger was changed after declined confirmations: %v", changes)
+	}
+}
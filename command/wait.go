@@ -0,0 +1,171 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// Exit codes used by the CLI so scripts can tell different failures apart.
+const (
+	ExitGeneral  = 1
+	ExitAppError = 3
+	ExitTimeout  = 4
+	ExitCanceled = 130
+)
+
+const (
+	defaultWaitTimeout = 5 * time.Minute
+	waitBackOffInitial = time.Second
+	waitBackOffMax     = 15 * time.Second
+)
+
+// ExitError is an error that should make the CLI exit with a specific code.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// ExitCode returns the code the CLI should exit with after err.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	return ExitGeneral
+}
+
+// waiter repeatedly checks a condition, backing off exponentially between
+// checks, until it holds or the context is done.
+type waiter struct {
+	initial time.Duration
+	max     time.Duration
+}
+
+func newWaiter() *waiter {
+	return &waiter{initial: waitBackOffInitial, max: waitBackOffMax}
+}
+
+// wait calls check until it returns true or an error. If ctx is done first,
+// an *ExitError with ExitTimeout or ExitCanceled is returned.
+func (w *waiter) wait(ctx context.Context, check func() (bool, error)) error {
+	delay := w.initial
+	for {
+		done, err := check()
+		if err != nil || done {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return &ExitError{Code: ExitTimeout, Err: errors.New("Timed out waiting.")}
+			}
+			return &ExitError{Code: ExitCanceled, Err: errors.New("Canceled while waiting.")}
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > w.max {
+			delay = w.max
+		}
+	}
+}
+
+// waitArgs are the arguments of commands that can wait for an app to reach
+// a status.
+type waitArgs struct {
+	wait    bool
+	noWait  bool
+	timeout time.Duration
+}
+
+func (a *waitArgs) IsValid() bool {
+	return a.timeout >= 0
+}
+
+func (a *waitArgs) shouldWait() bool {
+	return a.wait && !a.noWait
+}
+
+// setWaitFlags adds the -wait, -no-wait and -timeout flags. wait is whether
+// the command waits by default.
+func (a *waitArgs) setWaitFlags(flags *flag.FlagSet, wait bool) {
+	flags.BoolVar(&a.wait, "wait", wait, "Wait for the app to reach the requested status.")
+	flags.BoolVar(&a.noWait, "no-wait", false, "Return as soon as the request is accepted, without waiting.")
+	flags.DurationVar(&a.timeout, "timeout", defaultWaitTimeout, "How long to wait for the app status to change (ex. 90s, 5m; 0 = no limit).")
+}
+
+// appStatusWaiter is the waiter used for app status changes.
+var appStatusWaiter = newWaiter()
+
+// waitForAppStatus waits until the app reaches status wanted. It fails with
+// ExitAppError if the app ends up in the ERROR state, and can be canceled
+// with an interrupt.
+//
+// An app that is already in ERROR when the wait starts may still be in it
+// from before the request, so that ERROR is only a failure once the app has
+// left it or has been modified since.
+func waitForAppStatus(ctx *Context, args *baseAppArgs, wanted string, timeout time.Duration) error {
+	c, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		c, cancel = context.WithTimeout(c, timeout)
+		defer cancel()
+	}
+
+	fmt.Printf("Waiting for app status to become %s...\n", wanted)
+	first := true
+	staleError := false
+	var staleMod string
+	err := appStatusWaiter.wait(c, func() (bool, error) {
+		app, err := _getApp(ctx, args)
+		if err != nil {
+			return false, fmt.Errorf("Error while waiting for status change: %v", err)
+		}
+		fmt.Printf("Current status: %s\n", app.CurrentStatus)
+
+		// An app in the ERROR state is not running, so it counts as stopped.
+		if app.CurrentStatus == appStatusError && wanted == appStatusStopped {
+			return true, nil
+		}
+
+		if first {
+			first = false
+			staleError = app.CurrentStatus == appStatusError
+			staleMod = app.LastMod
+		} else if app.CurrentStatus != appStatusError || app.LastMod != staleMod {
+			staleError = false
+		}
+		if app.CurrentStatus == appStatusError && !staleError {
+			return false, &ExitError{
+				Code: ExitAppError,
+				Err: fmt.Errorf("App %d finished in error state: %s\nSee 'iobeam app logs -id %d' for details.",
+					app.AppId, app.Error, app.AppId),
+			}
+		}
+		return app.CurrentStatus == wanted, nil
+	})
+
+	if err == nil {
+		fmt.Println("Success!")
+	} else if ExitCode(err) == ExitTimeout && staleError {
+		err = &ExitError{Code: ExitTimeout, Err: fmt.Errorf("Timed out after %v waiting for app status %s, the app is still in %s state.",
+			timeout, wanted, appStatusError)}
+	} else if ExitCode(err) == ExitTimeout {
+		err = &ExitError{Code: ExitTimeout, Err: fmt.Errorf("Timed out after %v waiting for app status %s.", timeout, wanted)}
+	}
+	return err
+}
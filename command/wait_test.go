@@ -0,0 +1,90 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWaitArgsValidity(t *testing.T) {
+	cases := []dataTestCase{
+		{desc: "valid timeout", in: &waitArgs{timeout: time.Minute}, want: true},
+		{desc: "valid, no timeout", in: &waitArgs{}, want: true},
+		{desc: "invalid, negative timeout", in: &waitArgs{timeout: -time.Second}, want: false},
+	}
+	runDataTestCase(t, cases)
+}
+
+func TestWaitArgsShouldWait(t *testing.T) {
+	cases := []struct {
+		in   waitArgs
+		want bool
+	}{
+		{in: waitArgs{wait: true}, want: true},
+		{in: waitArgs{wait: false}, want: false},
+		{in: waitArgs{wait: true, noWait: true}, want: false},
+	}
+	for i, c := range cases {
+		if got := c.in.shouldWait(); got != c.want {
+			t.Errorf("case %d: got %v, want %v", i, got, c.want)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		in   error
+		want int
+	}{
+		{in: nil, want: 0},
+		{in: errors.New("failed"), want: ExitGeneral},
+		{in: &ExitError{Code: ExitTimeout, Err: errors.New("timeout")}, want: ExitTimeout},
+		{in: fmt.Errorf("wrapped: %w", &ExitError{Code: ExitAppError, Err: errors.New("error")}), want: ExitAppError},
+	}
+	for i, c := range cases {
+		if got := ExitCode(c.in); got != c.want {
+			t.Errorf("case %d: got %d, want %d", i, got, c.want)
+		}
+	}
+}
+
+func TestWaiter(t *testing.T) {
+	w := &waiter{initial: time.Millisecond, max: 2 * time.Millisecond}
+
+	calls := 0
+	err := w.wait(context.Background(), func() (bool, error) {
+		calls++
+		return calls == 3, nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("expected success after 3 calls, got %d calls and error %v", calls, err)
+	}
+
+	checkErr := errors.New("check failed")
+	err = w.wait(context.Background(), func() (bool, error) {
+		return false, checkErr
+	})
+	if err != checkErr {
+		t.Errorf("expected check error, got %v", err)
+	}
+
+	timeout, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	err = w.wait(timeout, func() (bool, error) {
+		return false, nil
+	})
+	if ExitCode(err) != ExitTimeout {
+		t.Errorf("expected timeout exit code, got %v", err)
+	}
+
+	canceled, cancel2 := context.WithCancel(context.Background())
+	cancel2()
+	err = w.wait(canceled, func() (bool, error) {
+		return false, nil
+	})
+	if ExitCode(err) != ExitCanceled {
+		t.Errorf("expected canceled exit code, got %v", err)
+	}
+}
@@ -174,6 +174,20 @@ func (p *Profile) GetFile() string {
 	return profilePath(p.Name)
 }
 
+// SaveData writes obj as JSON to the file called name in p's directory.
+func (p *Profile) SaveData(name string, obj interface{}) error {
+	err := makeAllOnPath(p.GetDir())
+	if err != nil {
+		return err
+	}
+	return saveJson(p.GetDir()+pathSeparator+name, obj)
+}
+
+// ReadData reads the JSON in the file called name in p's directory into obj.
+func (p *Profile) ReadData(name string, obj interface{}) error {
+	return readJson(p.GetDir()+pathSeparator+name, obj)
+}
+
 // UpdateActiveUser changes the active user id and email of p.
 func (p *Profile) UpdateActiveUser(uid uint64, email string) error {
 	p.ActiveUser = uid
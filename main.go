@@ -60,10 +60,13 @@ func main() {
 		Usage: "iobeam Command-Line Interface (CLI)\nUse the -help flag for usage flags and syntax.",
 		SubCommands: command.Mux{
 			"app":       command.NewAppsCommand(ctx),
+			"apply":     command.NewApplyCommand(ctx),
+			"data":      command.NewDataCommand(ctx),
 			"device":    command.NewDevicesCommand(ctx),
 			"file":      command.NewFilesCommand(ctx),
 			"import":    command.NewImportCommand(ctx),
 			"namespace": command.NewNamespaceCommand(ctx),
+			"plan":      command.NewPlanCommand(ctx),
 			"profile":   command.NewConfigCommand(),
 			"project":   command.NewProjectsCommand(ctx),
 			"query":     command.NewExportCommand(ctx),
@@ -86,5 +89,6 @@ func main() {
 
 	if err != nil {
 		fmt.Println(err)
+		os.Exit(command.ExitCode(err))
 	}
 }